@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	markerPrefix = "//saga:"
+
+	markerSagaStart   = "start"
+	markerCompensable = "compensable"
+	markerSagaEnd     = "end"
+
+	sagaImportPath = "github.com/jeremyxu2010/matrix-saga-go"
+
+	// localPrefix starts the names of the import and of the locals of the generated code,
+	// so that they are never shadowed by the parameters of the marked functions
+	localPrefix = "_saga"
+	sagaImport  = localPrefix
+)
+
+type param struct {
+	name     string
+	typ      string
+	variadic bool
+}
+
+type marked struct {
+	kind      string
+	name      string
+	params    []param
+	results   []string
+	timeout   int
+	autoClose bool
+	cancel    string
+}
+
+type generator struct {
+	fset       *token.FileSet
+	pkgName    string
+	pkgPath    string
+	funcs      map[string]*ast.FuncDecl
+	imports    map[string]string
+	markedList []*marked
+	buf        bytes.Buffer
+}
+
+// generate parses the package in dir and returns the source of the generated file,
+// or nil if the package has no saga marker.
+func generate(dir string, outputName string) ([]byte, error) {
+	g := &generator{
+		fset:    token.NewFileSet(),
+		funcs:   make(map[string]*ast.FuncDecl),
+		imports: make(map[string]string),
+	}
+	pkgs, err := parser.ParseDir(g.fset, dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go") && info.Name() != outputName
+	}, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		return nil, errors.New(fmt.Sprintf("expected one package in %s, found %d", dir, len(pkgs)))
+	}
+	for _, pkg := range pkgs {
+		g.pkgName = pkg.Name
+		g.pkgPath = packagePath(dir, pkg.Name)
+		for _, f := range sortedFiles(pkg) {
+			for _, decl := range f.Decls {
+				if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil {
+					g.funcs[fn.Name.Name] = fn
+				}
+			}
+		}
+		for _, f := range sortedFiles(pkg) {
+			if err := g.parseFile(f); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(g.markedList) == 0 {
+		return nil, nil
+	}
+	g.generate()
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("format generated code failed, %v", err))
+	}
+	return src, nil
+}
+
+// packagePath returns the path used by the runtime to name the functions of the package,
+// so that the generated code registers the same names as saga.DecorateXxxMethod does.
+func packagePath(dir string, pkgName string) string {
+	if pkgName == "main" {
+		return "main"
+	}
+	cmd := exec.Command("go", "list", "-e", "-f", "{{.ImportPath}}")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil || len(bytes.TrimSpace(out)) == 0 {
+		return pkgName
+	}
+	return string(bytes.TrimSpace(out))
+}
+
+func sortedFiles(pkg *ast.Package) []*ast.File {
+	names := make([]string, 0, len(pkg.Files))
+	for name := range pkg.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	files := make([]*ast.File, 0, len(names))
+	for _, name := range names {
+		files = append(files, pkg.Files[name])
+	}
+	return files
+}
+
+func (g *generator) parseFile(f *ast.File) error {
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Doc == nil {
+			continue
+		}
+		for _, comment := range fn.Doc.List {
+			if !strings.HasPrefix(comment.Text, markerPrefix) {
+				continue
+			}
+			pos := g.fset.Position(comment.Pos())
+			if fn.Recv != nil {
+				return errors.New(fmt.Sprintf("%v: %s is a method, register its receiver with saga.RegisterParticipant instead", pos, fn.Name.Name))
+			}
+			m, err := parseMarker(strings.TrimPrefix(comment.Text, markerPrefix))
+			if err != nil {
+				return errors.New(fmt.Sprintf("%v: %v", pos, err))
+			}
+			m.name = fn.Name.Name
+			if err := g.parseSignature(f, fn, m); err != nil {
+				return errors.New(fmt.Sprintf("%v: %v", pos, err))
+			}
+			if m.kind == markerCompensable {
+				if _, ok := g.funcs[m.cancel]; !ok {
+					return errors.New(fmt.Sprintf("%v: compensation function %s of %s is not found", pos, m.cancel, m.name))
+				}
+			}
+			g.markedList = append(g.markedList, m)
+		}
+	}
+	return nil
+}
+
+func parseMarker(text string) (*marked, error) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return nil, errors.New("empty saga marker")
+	}
+	m := &marked{
+		kind:      fields[0],
+		autoClose: true,
+	}
+	if m.kind != markerSagaStart && m.kind != markerCompensable && m.kind != markerSagaEnd {
+		return nil, errors.New(fmt.Sprintf("unknown saga marker %s", m.kind))
+	}
+	for _, field := range fields[1:] {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return nil, errors.New(fmt.Sprintf("malformed option %s, expected key=value", field))
+		}
+		var err error
+		switch kv[0] {
+		case "timeout":
+			m.timeout, err = strconv.Atoi(kv[1])
+		case "autoclose":
+			m.autoClose, err = strconv.ParseBool(kv[1])
+		case "cancel":
+			m.cancel = kv[1]
+		default:
+			err = errors.New("unknown option")
+		}
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid option %s, %v", field, err))
+		}
+	}
+	if m.kind == markerCompensable && m.cancel == "" {
+		return nil, errors.New("compensable marker requires the cancel option")
+	}
+	return m, nil
+}
+
+func (g *generator) parseSignature(f *ast.File, fn *ast.FuncDecl, m *marked) error {
+	for _, field := range fn.Type.Params.List {
+		typ := field.Type
+		variadic := false
+		if ellipsis, ok := typ.(*ast.Ellipsis); ok {
+			typ = ellipsis.Elt
+			variadic = true
+		}
+		names := field.Names
+		if len(names) == 0 {
+			names = []*ast.Ident{{Name: "_"}}
+		}
+		for _, name := range names {
+			if strings.HasPrefix(name.Name, localPrefix) {
+				return errors.New(fmt.Sprintf("parameter %s of %s starts with %s, which is reserved for the generated code", name.Name, m.name, localPrefix))
+			}
+			p := param{
+				name:     name.Name,
+				typ:      g.typeString(f, typ),
+				variadic: variadic,
+			}
+			if p.name == "_" {
+				p.name = fmt.Sprintf("%sArg%d", localPrefix, len(m.params))
+			}
+			m.params = append(m.params, p)
+		}
+	}
+	if fn.Type.Results != nil {
+		for _, field := range fn.Type.Results.List {
+			n := len(field.Names)
+			if n == 0 {
+				n = 1
+			}
+			for i := 0; i < n; i++ {
+				m.results = append(m.results, g.typeString(f, field.Type))
+			}
+		}
+	}
+	if len(m.results) == 0 || m.results[len(m.results)-1] != "error" {
+		return errors.New(fmt.Sprintf("%s must return error as its last result", m.name))
+	}
+	return nil
+}
+
+// typeString prints the type expression and records the imports it refers to.
+func (g *generator) typeString(f *ast.File, typ ast.Expr) string {
+	ast.Inspect(typ, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if x, ok := sel.X.(*ast.Ident); ok {
+			for _, spec := range f.Imports {
+				path, _ := strconv.Unquote(spec.Path.Value)
+				name := path[strings.LastIndex(path, "/")+1:]
+				if spec.Name != nil {
+					name = spec.Name.Name
+				}
+				if name == x.Name {
+					g.imports[path] = name
+				}
+			}
+		}
+		return false
+	})
+	var b bytes.Buffer
+	printer.Fprint(&b, g.fset, typ)
+	return b.String()
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) generate() {
+	g.printf("// Code generated by saga-gen. DO NOT EDIT.\n\n")
+	g.printf("package %s\n\n", g.pkgName)
+	g.printf("import (\n")
+	g.printf("\t%s %q\n", sagaImport, sagaImportPath)
+	paths := make([]string, 0, len(g.imports))
+	for path := range g.imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		g.printf("\t%s %q\n", g.imports[path], path)
+	}
+	g.printf(")\n\n")
+
+	registered := make(map[string]bool)
+	g.printf("func init() {\n")
+	for _, m := range g.markedList {
+		if m.kind == markerCompensable && !registered[m.cancel] {
+			registered[m.cancel] = true
+			g.printf("\t%s.RegisterCompensation(%q, %s)\n", sagaImport, g.qualified(m.cancel), m.cancel)
+		}
+	}
+	g.printf("}\n\n")
+
+	for _, m := range g.markedList {
+		switch m.kind {
+		case markerSagaStart:
+			g.generateSaga(m, "SagaStartDecorated", "saga start", m.autoClose)
+		case markerSagaEnd:
+			g.generateSaga(m, "SagaEndDecorated", "saga end", true)
+		case markerCompensable:
+			g.generateCompensable(m)
+		}
+	}
+}
+
+func (g *generator) qualified(name string) string {
+	return g.pkgPath + "." + name
+}
+
+func (g *generator) paramList(m *marked) string {
+	params := make([]string, 0, len(m.params))
+	for _, p := range m.params {
+		if p.variadic {
+			params = append(params, p.name+" ..."+p.typ)
+		} else {
+			params = append(params, p.name+" "+p.typ)
+		}
+	}
+	return strings.Join(params, ", ")
+}
+
+func (g *generator) signature(m *marked, wrapperName string) string {
+	results := make([]string, 0, len(m.results))
+	for i, r := range m.results {
+		results = append(results, fmt.Sprintf("%s %s", resultName(i), r))
+	}
+	return fmt.Sprintf("func %s(%s) (%s)", wrapperName, g.paramList(m), strings.Join(results, ", "))
+}
+
+func (g *generator) call(m *marked, fnName string) string {
+	args := make([]string, 0, len(m.params))
+	for _, p := range m.params {
+		if p.variadic {
+			args = append(args, p.name+"...")
+		} else {
+			args = append(args, p.name)
+		}
+	}
+	return fmt.Sprintf("%s(%s)", fnName, strings.Join(args, ", "))
+}
+
+func (g *generator) assignResults(m *marked) string {
+	results := make([]string, 0, len(m.results))
+	for i := range m.results {
+		results = append(results, resultName(i))
+	}
+	return strings.Join(results, ", ")
+}
+
+func resultName(i int) string {
+	return fmt.Sprintf("%sRet%d", localPrefix, i)
+}
+
+// deferFinish prints the deferred call of finish, which reports the panic of the marked function, or its exit by runtime.Goexit,
+// as the error _sagaErr to the saga agent and panics again. It does nothing once the marked function has returned,
+// whose outcome is reported by the code after the call.
+func (g *generator) deferFinish(finish string) {
+	g.printf("\t%sReturned := false\n", localPrefix)
+	g.printf("\tdefer func() {\n")
+	g.printf("\t\tif %sReturned {\n", localPrefix)
+	g.printf("\t\t\treturn\n")
+	g.printf("\t\t}\n")
+	g.printf("\t\t%sCause := recover()\n", localPrefix)
+	g.printf("\t\t%sErr := %s.PanicError(%sCause)\n", localPrefix, sagaImport, localPrefix)
+	g.printf("\t\t%s\n", finish)
+	g.printf("\t\tif %sCause != nil {\n", localPrefix)
+	g.printf("\t\t\tpanic(%sCause)\n", localPrefix)
+	g.printf("\t\t}\n")
+	g.printf("\t}()\n")
+}
+
+func (g *generator) generateSaga(m *marked, suffix string, kind string, autoClose bool) {
+	errRet := resultName(len(m.results) - 1)
+	wrapperName := m.name + suffix
+	g.printf("// %s is the %s wrapper of %s.\n", wrapperName, kind, m.name)
+	g.printf("%s {\n", g.signature(m, wrapperName))
+	if m.kind == markerSagaStart {
+		g.printf("\tif %sErr := %s.BeginSaga(%q, %d); %sErr != nil {\n", localPrefix, sagaImport, g.qualified(m.name), m.timeout, localPrefix)
+		g.printf("\t\t%s = %sErr\n", errRet, localPrefix)
+		g.printf("\t\treturn\n")
+		g.printf("\t}\n")
+	}
+	// the saga aborted by the panic is not left open
+	g.deferFinish(fmt.Sprintf("%s.FinishSaga(%q, %sErr, true)", sagaImport, g.qualified(m.name), localPrefix))
+	g.printf("\t%s = %s\n", g.assignResults(m), g.call(m, m.name))
+	g.printf("\t%sReturned = true\n", localPrefix)
+	g.printf("\tif %sErr := %s.FinishSaga(%q, %s, %t); %sErr != nil {\n", localPrefix, sagaImport, g.qualified(m.name), errRet, autoClose, localPrefix)
+	g.printf("\t\t%s = %sErr\n", errRet, localPrefix)
+	g.printf("\t}\n")
+	g.printf("\treturn\n")
+	g.printf("}\n\n")
+}
+
+func (g *generator) generateCompensable(m *marked) {
+	errRet := resultName(len(m.results) - 1)
+	wrapperName := m.name + "CompensableDecorated"
+	args := make([]string, 0, len(m.params))
+	for _, p := range m.params {
+		args = append(args, p.name)
+	}
+	g.printf("// %s is the compensable wrapper of %s, which is compensated by %s.\n", wrapperName, m.name, m.cancel)
+	g.printf("%s {\n", g.signature(m, wrapperName))
+	g.printf("\t%sTx, %sErr := %s.BeginCompensable(%q, %q, %d", localPrefix, localPrefix, sagaImport, g.qualified(m.name), g.qualified(m.cancel), m.timeout)
+	for _, arg := range args {
+		g.printf(", %s", arg)
+	}
+	g.printf(")\n")
+	g.printf("\tif %sErr != nil {\n", localPrefix)
+	g.printf("\t\t%s = %sErr\n", errRet, localPrefix)
+	g.printf("\t\treturn\n")
+	g.printf("\t}\n")
+	g.deferFinish(fmt.Sprintf("%sTx.Finish(%sErr)", localPrefix, localPrefix))
+	g.printf("\t%s = %s\n", g.assignResults(m), g.call(m, m.name))
+	g.printf("\t%sReturned = true\n", localPrefix)
+	g.printf("\tif %sErr = %sTx.Finish(%s); %sErr != nil {\n", localPrefix, localPrefix, errRet, localPrefix)
+	g.printf("\t\t%s = %sErr\n", errRet, localPrefix)
+	g.printf("\t}\n")
+	g.printf("\treturn\n")
+	g.printf("}\n\n")
+
+	// the compensation must accept the arguments of the compensable function,
+	// check it at compile time instead of failing on compensation
+	g.printf("var _ = func(%s) { %s }\n\n", g.paramList(m), g.call(m, m.cancel))
+}
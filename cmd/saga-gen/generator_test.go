@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files of the generated code")
+
+func TestGenerateGolden(t *testing.T) {
+	for _, pkg := range []string{"orders"} {
+		t.Run(pkg, func(t *testing.T) {
+			dir := filepath.Join("testdata", pkg)
+			src, err := generate(dir, "saga_gen.go")
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join(dir, "saga_gen.go.golden")
+			if *update {
+				if err := ioutil.WriteFile(golden, src, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(src, want) {
+				t.Errorf("generated code differs from %s, run go test -update to update it\n%s", golden, src)
+			}
+		})
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		src  string
+		err  string
+	}{
+		{"reserved parameter", "//saga:start\nfunc Place(_sagaErr string) error { return nil }\n", "parameter _sagaErr of Place starts with _saga"},
+		{"no error result", "//saga:start\nfunc Place() {}\n", "Place must return error as its last result"},
+		{"unknown marker", "//saga:begin\nfunc Place() error { return nil }\n", "unknown saga marker begin"},
+		{"missing cancel", "//saga:compensable\nfunc Reserve() error { return nil }\n", "compensable marker requires the cancel option"},
+		{"unknown compensation", "//saga:compensable cancel=Cancel\nfunc Reserve() error { return nil }\n", "compensation function Cancel of Reserve is not found"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "saga-gen")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			if err := ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\n"+c.src), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err = generate(dir, "saga_gen.go")
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("got error %v, want %q", err, c.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+// Command saga-gen generates strongly-typed saga wrappers for the functions marked with saga comments.
+//
+// Add a marker comment to the doc comment of a top-level function:
+//
+//	//saga:start timeout=20 autoclose=true
+//	func TransferMoney() error { ... }
+//
+//	//saga:compensable cancel=CancelTransferOut timeout=5
+//	func TransferOut(from string, amount int) error { ... }
+//
+//	//saga:end
+//	func TransferMoneyEnd() error { ... }
+//
+// and run saga-gen in the package directory, usually through go generate:
+//
+//	//go:generate go run github.com/jeremyxu2010/matrix-saga-go/cmd/saga-gen
+//
+// For each marked function a wrapper named XxxSagaStartDecorated, XxxCompensableDecorated or XxxSagaEndDecorated
+// is generated, which calls into the saga agent without reflection.
+// The compensation functions are registered in a generated init function.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var (
+	dir    = flag.String("dir", ".", "directory of the package to generate saga wrappers for")
+	output = flag.String("output", "saga_gen.go", "name of the generated file, relative to the package directory")
+)
+
+func main() {
+	flag.Parse()
+
+	outputPath := *output
+	if !filepath.IsAbs(outputPath) {
+		outputPath = filepath.Join(*dir, outputPath)
+	}
+
+	src, err := generate(*dir, filepath.Base(outputPath))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "saga-gen: %v\n", err)
+		os.Exit(1)
+	}
+	if src == nil {
+		fmt.Fprintf(os.Stderr, "saga-gen: no saga marker found in %s\n", *dir)
+		return
+	}
+	err = ioutil.WriteFile(outputPath, src, 0644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "saga-gen: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,30 @@
+package orders
+
+import (
+	"errors"
+	"time"
+)
+
+type Order struct {
+	No     string
+	Amount int
+}
+
+//saga:start timeout=20 autoclose=false
+func PlaceOrder(saga string, sagaErr *Order) (string, error) {
+	return saga, nil
+}
+
+//saga:compensable cancel=CancelReserve timeout=5
+func Reserve(p0 string, _ int, delay time.Duration, items ...string) error {
+	return nil
+}
+
+func CancelReserve(p0 string, _ int, delay time.Duration, items ...string) error {
+	return errors.New("not implemented")
+}
+
+//saga:end
+func ConfirmOrder() (n int, o *Order, err error) {
+	return 0, nil, nil
+}
@@ -0,0 +1,306 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jeremyxu2010/matrix-saga-go/constants"
+	"github.com/jeremyxu2010/matrix-saga-go/discovery"
+	"gopkg.in/yaml.v2"
+	"github.com/jeremyxu2010/matrix-saga-go/log"
+	"github.com/jeremyxu2010/matrix-saga-go/redact"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The properties of the agent, named after the properties of the java omega.
+const (
+	PROPERTY_SERVICE_NAME        = "spring.application.name"
+	PROPERTY_INSTANCE_ID         = "omega.instance.instanceId"
+	PROPERTY_ALPHA_ADDRESS       = "alpha.cluster.address"
+	PROPERTY_RESOLVE_INTERVAL    = "alpha.cluster.resolveInterval"
+	PROPERTY_SENDING_TIMEOUT     = "omega.connection.sending.timeout"
+	PROPERTY_RECONNECT_DELAY     = "omega.connection.reconnectDelay"
+	PROPERTY_PAYLOADS_MAX_LENGTH = "omega.payloads.maxLength"
+	PROPERTY_COMPRESS_THRESHOLD  = "omega.payloads.compressThreshold"
+	PROPERTY_OFFLOAD_DIR         = "omega.payloads.offloadDir"
+	PROPERTY_OFFLOAD_TTL         = "omega.payloads.offloadTTL"
+	PROPERTY_LOG_LEVEL           = "omega.log.level"
+	PROPERTY_RETRIES             = "omega.connection.retries"
+	PROPERTY_RETRY_BACKOFF       = "omega.connection.retryBackoff"
+	PROPERTY_DISABLED_METHODS    = "omega.saga.disabledMethods"
+	PROPERTY_REDACT_PATTERNS     = "omega.redact.patterns"
+)
+
+var properties = []string{PROPERTY_SERVICE_NAME, PROPERTY_INSTANCE_ID, PROPERTY_ALPHA_ADDRESS, PROPERTY_RESOLVE_INTERVAL,
+	PROPERTY_SENDING_TIMEOUT, PROPERTY_RECONNECT_DELAY, PROPERTY_PAYLOADS_MAX_LENGTH,
+	PROPERTY_COMPRESS_THRESHOLD, PROPERTY_OFFLOAD_DIR, PROPERTY_OFFLOAD_TTL,
+	PROPERTY_LOG_LEVEL, PROPERTY_RETRIES, PROPERTY_RETRY_BACKOFF, PROPERTY_DISABLED_METHODS, PROPERTY_REDACT_PATTERNS}
+
+// AgentConfig is the configuration of the saga agent.
+type AgentConfig struct {
+	ServiceName string
+	// InstanceId is derived from the service name and the instance id sources if empty, see NewServiceConfig.
+	InstanceId string
+	// Coordinators are the addresses of the alpha servers, or a single resolver address, see discovery.ParseResolver.
+	Coordinators []string
+	// Resolver resolves the addresses of the alpha servers, it overrides Coordinators.
+	Resolver discovery.Resolver
+	// ResolveInterval is the interval of resolving the addresses of the alpha servers.
+	ResolveInterval time.Duration
+	// Timeout is the timeout of the requests to the coordinator.
+	Timeout time.Duration
+	// ReconnectDelay is the delay before reconnecting to the coordinator.
+	ReconnectDelay time.Duration
+	// PayloadsMaxLength is the max length of the payloads sent to the coordinator when a transaction is started,
+	// and of the error message sent when a transaction is aborted.
+	PayloadsMaxLength int
+	// OffloadDir is the directory of the payloads longer than PayloadsMaxLength, they are sent as they are if it is empty.
+	OffloadDir string
+	// OffloadTTL is how long the payloads in OffloadDir are kept.
+	OffloadTTL time.Duration
+
+	// The settings below, as well as Timeout, ReconnectDelay and PayloadsMaxLength, can be changed at runtime by saga.UpdateConfig.
+
+	// CompressThreshold is the length above which the payloads are compressed, 0 disables the compression.
+	// The payloads of the JSON and the encrypting serializers are never compressed.
+	CompressThreshold int
+
+	// LogLevel is the level of the logs of the agent, one of debug, info, warn, error and fatal.
+	LogLevel string
+	// RetryAttempts is the number of retries of sending an event to the coordinator when it is unavailable,
+	// the events which are not idempotent, such as TxStartedEvent, are only retried if they were not sent.
+	RetryAttempts int
+	// RetryBackoff is the delay before the first retry, it doubles on every retry.
+	RetryBackoff time.Duration
+	// DisabledMethods are the patterns of the names of the saga start, saga end and compensable methods running without the saga,
+	// such as "main.TransferMoney" or "github.com/foo/order.*", see path.Match.
+	DisabledMethods []string
+	// RedactPatterns are the regular expressions of the secrets masked in the logs, the abort messages and the readable payloads,
+	// only the groups of a pattern are masked if it has any, such as `password=(\S+)`, see redact.New.
+	// The property lists them separated by commas, so a comma in a pattern is written as \x2c.
+	RedactPatterns []string
+}
+
+// NewAgentConfig returns the agent configuration with the default settings.
+func NewAgentConfig() *AgentConfig {
+	return &AgentConfig{
+		Timeout:           constants.GRPC_COMMUNICATE_TIMEOUT,
+		ReconnectDelay:    constants.GRPC_RECONNECT_DELAY,
+		ResolveInterval:   constants.COORDINATOR_RESOLVE_INTERVAL,
+		PayloadsMaxLength: constants.PAYLOADS_MAX_LENGTH,
+		OffloadTTL:        constants.PAYLOADS_OFFLOAD_TTL,
+		CompressThreshold: constants.PAYLOADS_COMPRESS_THRESHOLD,
+		LogLevel:          "debug",
+		RetryBackoff:      constants.GRPC_RETRY_BACKOFF,
+	}
+}
+
+// LoadAgentConfig returns the agent configuration loaded from the YAML file path, if path is not empty,
+// overridden by the environment variables.
+func LoadAgentConfig(path string) (*AgentConfig, error) {
+	c := NewAgentConfig()
+	if len(path) > 0 {
+		if err := c.LoadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.LoadEnv(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// LoadFile loads the settings from the YAML file path, the properties may be nested or dotted, such as
+//
+//	spring:
+//	  application:
+//	    name: saga-go-demo
+//	alpha.cluster.address: alpha-0:8080,alpha-1:8080
+func (c *AgentConfig) LoadFile(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	properties, err := ParseYAMLProperties(b)
+	if err != nil {
+		return errors.New(fmt.Sprintf("parse config file %s failed, %v", path, err))
+	}
+	return c.Apply(properties)
+}
+
+// LoadEnv loads the settings from the environment variables, whose names are the property names in upper case
+// with the dots replaced by underscores, such as ALPHA_CLUSTER_ADDRESS.
+func (c *AgentConfig) LoadEnv() error {
+	values := make(map[string]string)
+	for _, property := range properties {
+		if v, ok := os.LookupEnv(EnvName(property)); ok {
+			values[property] = v
+		}
+	}
+	return c.Apply(values)
+}
+
+// EnvName returns the name of the environment variable of property.
+func EnvName(property string) string {
+	return strings.ToUpper(strings.Replace(property, ".", "_", -1))
+}
+
+// Apply applies the properties, the unknown properties are ignored.
+// The timeouts are durations like "5s", or seconds for the sending timeout and milliseconds for the reconnect delay like the java omega,
+// the offload ttl is a duration or hours.
+func (c *AgentConfig) Apply(properties map[string]string) error {
+	for property, v := range properties {
+		v = strings.TrimSpace(v)
+		var err error
+		switch property {
+		case PROPERTY_SERVICE_NAME:
+			c.ServiceName = v
+		case PROPERTY_INSTANCE_ID:
+			c.InstanceId = v
+		case PROPERTY_ALPHA_ADDRESS:
+			c.Coordinators = splitList(v)
+		case PROPERTY_RESOLVE_INTERVAL:
+			c.ResolveInterval, err = parseDuration(v, time.Second)
+		case PROPERTY_SENDING_TIMEOUT:
+			c.Timeout, err = parseDuration(v, time.Second)
+		case PROPERTY_RECONNECT_DELAY:
+			c.ReconnectDelay, err = parseDuration(v, time.Millisecond)
+		case PROPERTY_PAYLOADS_MAX_LENGTH:
+			c.PayloadsMaxLength, err = strconv.Atoi(v)
+		case PROPERTY_COMPRESS_THRESHOLD:
+			c.CompressThreshold, err = strconv.Atoi(v)
+		case PROPERTY_OFFLOAD_DIR:
+			c.OffloadDir = v
+		case PROPERTY_OFFLOAD_TTL:
+			c.OffloadTTL, err = parseDuration(v, time.Hour)
+		case PROPERTY_LOG_LEVEL:
+			c.LogLevel = v
+		case PROPERTY_RETRIES:
+			c.RetryAttempts, err = strconv.Atoi(v)
+		case PROPERTY_RETRY_BACKOFF:
+			c.RetryBackoff, err = parseDuration(v, time.Millisecond)
+		case PROPERTY_DISABLED_METHODS:
+			c.DisabledMethods = splitList(v)
+		case PROPERTY_REDACT_PATTERNS:
+			c.RedactPatterns = splitList(v)
+		}
+		if err != nil {
+			return errors.New(fmt.Sprintf("invalid value %q of property %s, %v", v, property, err))
+		}
+	}
+	return nil
+}
+
+// Validate checks whether the configuration is complete.
+func (c *AgentConfig) Validate() error {
+	if len(c.ServiceName) == 0 {
+		return errors.New(fmt.Sprintf("service name is not configured, set %s or %s", PROPERTY_SERVICE_NAME, EnvName(PROPERTY_SERVICE_NAME)))
+	}
+	if len(c.Coordinators) == 0 && c.Resolver == nil {
+		return errors.New(fmt.Sprintf("coordinator address is not configured, set %s or %s", PROPERTY_ALPHA_ADDRESS, EnvName(PROPERTY_ALPHA_ADDRESS)))
+	}
+	if c.ResolveInterval <= 0 {
+		return errors.New("resolve interval must be positive")
+	}
+	if len(c.OffloadDir) > 0 && c.OffloadTTL <= 0 {
+		return errors.New("offload ttl must be positive")
+	}
+	return c.ValidateReloadable()
+}
+
+// ValidateReloadable validates the settings which can be changed at runtime by saga.UpdateConfig, the others are not checked.
+func (c *AgentConfig) ValidateReloadable() error {
+	if c.Timeout <= 0 || c.ReconnectDelay <= 0 || c.PayloadsMaxLength <= 0 {
+		return errors.New("timeout, reconnect delay and payloads max length must be positive")
+	}
+	if c.RetryAttempts < 0 || c.RetryBackoff < 0 || c.CompressThreshold < 0 {
+		return errors.New("retry attempts, retry backoff and compress threshold must not be negative")
+	}
+	if _, err := log.ParseLevel(c.LogLevel); err != nil {
+		return err
+	}
+	for _, pattern := range c.DisabledMethods {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.New(fmt.Sprintf("invalid disabled method pattern %s, %v", pattern, err))
+		}
+	}
+	if _, err := redact.New(c.RedactPatterns...); err != nil {
+		return err
+	}
+	return nil
+}
+
+// MethodEnabled returns whether the saga is enabled for method.
+func (c *AgentConfig) MethodEnabled(method string) bool {
+	for _, pattern := range c.DisabledMethods {
+		if matched, _ := path.Match(pattern, method); matched {
+			return false
+		}
+	}
+	return true
+}
+
+// CoordinatorResolver returns Resolver, or the resolver of Coordinators if it is nil.
+func (c *AgentConfig) CoordinatorResolver() (discovery.Resolver, error) {
+	if c.Resolver != nil {
+		return c.Resolver, nil
+	}
+	return discovery.ParseResolver(c.Coordinators)
+}
+
+// ParseYAMLProperties parses the YAML document b into properties with dotted names.
+// Lists are joined with commas.
+func ParseYAMLProperties(b []byte) (map[string]string, error) {
+	var doc map[interface{}]interface{}
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	properties := make(map[string]string)
+	flattenYAML("", doc, properties)
+	return properties, nil
+}
+
+func flattenYAML(prefix string, v interface{}, properties map[string]string) {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		for k, child := range v {
+			name := fmt.Sprintf("%v", k)
+			if len(prefix) > 0 {
+				name = prefix + "." + name
+			}
+			flattenYAML(name, child, properties)
+		}
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, fmt.Sprintf("%v", item))
+		}
+		properties[prefix] = strings.Join(items, ",")
+	case nil:
+		properties[prefix] = ""
+	default:
+		properties[prefix] = fmt.Sprintf("%v", v)
+	}
+}
+
+func splitList(v string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(v, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func parseDuration(v string, unit time.Duration) (time.Duration, error) {
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Duration(n) * unit, nil
+	}
+	return time.ParseDuration(v)
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/jeremyxu2010/matrix-saga-go/utils"
+	"os"
+)
+
+// InstanceIdSource returns the part of the instance id following the service name, such as a host address or a pod name.
+// An empty id makes NewServiceConfig try the next source.
+type InstanceIdSource func() (string, error)
+
+// DefaultInstanceIdSources returns the sources tried by default: the POD_NAME environment variable,
+// the first non loopback IPv4 address, the first global IPv6 address and the hostname.
+func DefaultInstanceIdSources() []InstanceIdSource {
+	return []InstanceIdSource{
+		EnvInstanceIdSource("POD_NAME"),
+		IPv4InstanceIdSource(),
+		IPv6InstanceIdSource(),
+		HostnameInstanceIdSource(),
+	}
+}
+
+// EnvInstanceIdSource returns the value of the environment variable name, such as the pod name exposed by the downward API.
+func EnvInstanceIdSource(name string) InstanceIdSource {
+	return func() (string, error) {
+		return os.Getenv(name), nil
+	}
+}
+
+// IPv4InstanceIdSource returns the first non loopback IPv4 address.
+func IPv4InstanceIdSource() InstanceIdSource {
+	return utils.GetFirstNotLoopbackIPv4Address
+}
+
+// IPv6InstanceIdSource returns the first global IPv6 address.
+func IPv6InstanceIdSource() InstanceIdSource {
+	return utils.GetFirstNotLoopbackIPv6Address
+}
+
+// HostnameInstanceIdSource returns the hostname.
+func HostnameInstanceIdSource() InstanceIdSource {
+	return os.Hostname
+}
+
+// StaticInstanceIdSource returns id.
+func StaticInstanceIdSource(id string) InstanceIdSource {
+	return func() (string, error) {
+		return id, nil
+	}
+}
+
+// RandomSuffixInstanceIdSource appends a random suffix to the id of source,
+// so that the instances sharing the network of a host get different ids.
+func RandomSuffixInstanceIdSource(source InstanceIdSource) InstanceIdSource {
+	return func() (string, error) {
+		id, err := source()
+		if err != nil || len(id) == 0 {
+			return id, err
+		}
+		b := make([]byte, 4)
+		if _, err := rand.Read(b); err != nil {
+			return "", errors.New(fmt.Sprintf("generate random suffix of instance id failed, %v", err))
+		}
+		return id + "-" + hex.EncodeToString(b), nil
+	}
+}
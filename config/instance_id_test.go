@@ -0,0 +1,129 @@
+package config
+
+import (
+	"errors"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func failingInstanceIdSource(message string) InstanceIdSource {
+	return func() (string, error) {
+		return "", errors.New(message)
+	}
+}
+
+func TestNewServiceConfig(t *testing.T) {
+	cases := []struct {
+		name    string
+		sources []InstanceIdSource
+		want    string
+		err     string
+	}{
+		{"static", []InstanceIdSource{StaticInstanceIdSource("pod-1")}, "orders-pod-1", ""},
+		{"first source that works", []InstanceIdSource{StaticInstanceIdSource("pod-1"), StaticInstanceIdSource("pod-2")}, "orders-pod-1", ""},
+		{"empty id", []InstanceIdSource{StaticInstanceIdSource(""), StaticInstanceIdSource("pod-2")}, "orders-pod-2", ""},
+		{"failed source", []InstanceIdSource{failingInstanceIdSource("no network"), StaticInstanceIdSource("pod-2")}, "orders-pod-2", ""},
+		{"all sources failed", []InstanceIdSource{failingInstanceIdSource("no network"), StaticInstanceIdSource(""), failingInstanceIdSource("no hostname")},
+			"", "can not derive the instance id of service orders, no network; no hostname"},
+		{"no id", []InstanceIdSource{StaticInstanceIdSource("")}, "", "can not derive the instance id of service orders"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sc, err := NewServiceConfig("orders", c.sources...)
+			if len(c.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Errorf("got error %v, want %q", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sc.ServiceName != "orders" || sc.InstanceId != c.want {
+				t.Errorf("got service config %+v, want instance id %s", sc, c.want)
+			}
+		})
+	}
+}
+
+func TestEnvInstanceIdSource(t *testing.T) {
+	const name = "SAGA_TEST_POD_NAME"
+	defer os.Unsetenv(name)
+	os.Unsetenv(name)
+	if id, err := EnvInstanceIdSource(name)(); err != nil || id != "" {
+		t.Errorf("got id %q and error %v of the unset variable", id, err)
+	}
+	os.Setenv(name, "orders-7d9f")
+	if id, err := EnvInstanceIdSource(name)(); err != nil || id != "orders-7d9f" {
+		t.Errorf("got id %q and error %v, want orders-7d9f", id, err)
+	}
+}
+
+func TestDefaultInstanceIdSourcesPreferThePodName(t *testing.T) {
+	defer os.Setenv("POD_NAME", os.Getenv("POD_NAME"))
+	os.Setenv("POD_NAME", "orders-7d9f")
+	sc, err := NewServiceConfig("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.InstanceId != "orders-orders-7d9f" {
+		t.Errorf("got instance id %s", sc.InstanceId)
+	}
+}
+
+func TestRandomSuffixInstanceIdSource(t *testing.T) {
+	source := RandomSuffixInstanceIdSource(StaticInstanceIdSource("10.0.0.1"))
+	first, err := source()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := source()
+	if err != nil {
+		t.Fatal(err)
+	}
+	suffixed := regexp.MustCompile(`^10\.0\.0\.1-[0-9a-f]{8}$`)
+	if !suffixed.MatchString(first) || !suffixed.MatchString(second) || first == second {
+		t.Errorf("got ids %s and %s", first, second)
+	}
+	// the failures and the empty ids of the source are passed on, so that the next source is tried
+	if id, err := RandomSuffixInstanceIdSource(failingInstanceIdSource("no network"))(); err == nil || id != "" {
+		t.Errorf("got id %q and error %v of the failed source", id, err)
+	}
+	if id, err := RandomSuffixInstanceIdSource(StaticInstanceIdSource(""))(); err != nil || id != "" {
+		t.Errorf("got id %q and error %v of the empty source", id, err)
+	}
+}
+
+func TestHostInstanceIdSources(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Skip(err)
+	}
+	if id, err := HostnameInstanceIdSource()(); err != nil || id != hostname {
+		t.Errorf("got id %q and error %v, want %s", id, err, hostname)
+	}
+	// the addresses depend on the network of the host, the sources return an error instead of panicking if there is none
+	cases := []struct {
+		name   string
+		source InstanceIdSource
+		ipv4   bool
+	}{
+		{"ipv4", IPv4InstanceIdSource(), true},
+		{"ipv6", IPv6InstanceIdSource(), false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			id, err := c.source()
+			if err != nil {
+				return
+			}
+			ip := net.ParseIP(id)
+			if ip == nil || ip.IsLoopback() || (ip.To4() != nil) != c.ipv4 {
+				t.Errorf("got id %s", id)
+			}
+		})
+	}
+}
@@ -1,20 +1,33 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"strings"
-	"github.com/jeremyxu2010/matrix-saga-go/utils"
 )
 
-func NewServiceConfig(serviceName string) *ServiceConfig{
-	hostAddress, err := utils.GetFirstNotLoopbackIPv4Address()
-	if err != nil {
-		panic(err)
+// NewServiceConfig returns the configuration of the service serviceName,
+// whose instance id is derived from the first one of sources that works, or the default sources if none is given.
+func NewServiceConfig(serviceName string, sources ...InstanceIdSource) (*ServiceConfig, error) {
+	if len(sources) == 0 {
+		sources = DefaultInstanceIdSources()
 	}
-	instanceId := strings.Join([]string{serviceName, hostAddress}, "-")
-	return &ServiceConfig{
-		ServiceName: serviceName,
-		InstanceId:  instanceId,
+	errs := make([]string, 0, len(sources))
+	for _, source := range sources {
+		id, err := source()
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if len(id) == 0 {
+			continue
+		}
+		return &ServiceConfig{
+			ServiceName: serviceName,
+			InstanceId:  strings.Join([]string{serviceName, id}, "-"),
+		}, nil
 	}
+	return nil, errors.New(fmt.Sprintf("can not derive the instance id of service %s, %s", serviceName, strings.Join(errs, "; ")))
 }
 
 type ServiceConfig struct{
@@ -5,6 +5,15 @@ import "time"
 const (
 	GRPC_COMMUNICATE_TIMEOUT = time.Second * 5
 	GRPC_RECONNECT_DELAY = time.Second * 10
+	COORDINATOR_RESOLVE_INTERVAL = time.Second * 30
+	GRPC_RETRY_BACKOFF = time.Millisecond * 200
 
 	PAYLOADS_MAX_LENGTH = 10240
+	PAYLOADS_COMPRESS_THRESHOLD = 4096
+	PAYLOADS_OFFLOAD_TTL = time.Hour * 24 * 7
+
+	BAGGAGE_MAX_ITEMS = 32
+	BAGGAGE_MAX_LENGTH = 4096
+
+	IDEMPOTENT_SAGA_TTL = time.Minute * 10
 )
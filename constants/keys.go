@@ -3,9 +3,20 @@ package constants
 const (
 	KEY_FUNCTION_CALL_ARGS = "KEY_FUNCTION_CALL_ARGS"
 	KEY_FUNCTION_CALL_ERROR = "KEY_FUNCTION_CALL_ERROR"
+	KEY_FUNCTION_CALL_RESULTS = "KEY_FUNCTION_CALL_RESULTS"
 	KEY_PARENT_LOCAL_TX_ID = "KEY_PARENT_LOCAL_TX_ID"
+	KEY_COMPENSABLE_TX = "KEY_COMPENSABLE_TX"
+	KEY_SAGA_START_RECORD = "KEY_SAGA_START_RECORD"
 	KEY_SAGA_AGENT_CONTEXT = "KEY_SAGA_AGENT_CONTEXT"
+	KEY_SAGA_DISABLED = "KEY_SAGA_DISABLED"
 
 	KEY_GLOBAL_TX_ID_KEY = "X-Pack-Global-Transaction-Id"
 	KEY_LOCAL_TX_ID_KEY = "X-Pack-Local-Transaction-Id"
+
+	KEY_SAGA_BAGGAGE_KEY = "X-Pack-Saga-Baggage"
+
+	KEY_BAGGAGE = "baggage"
+	BAGGAGE_KEY_GLOBAL_TX_ID = "saga-global-tx-id"
+	BAGGAGE_KEY_LOCAL_TX_ID = "saga-local-tx-id"
+	BAGGAGE_KEY_PREFIX = "saga."
 )
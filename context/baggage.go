@@ -0,0 +1,119 @@
+package context
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jeremyxu2010/matrix-saga-go/constants"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// SetBaggageItem attaches the business metadata key/value to the global transaction,
+// it travels through every propagation path and is available in the compensable and compensation methods.
+// The number of items and their total length are limited to protect the headers carrying them.
+func (c *SagaAgentContext) SetBaggageItem(key string, value string) error {
+	if err := checkBaggageKey(key); err != nil {
+		return err
+	}
+	baggage := make(map[string]string, len(c.Baggage)+1)
+	for k, v := range c.Baggage {
+		baggage[k] = v
+	}
+	baggage[key] = value
+	if err := checkBaggage(baggage); err != nil {
+		return err
+	}
+	c.Baggage = baggage
+	return nil
+}
+
+// BaggageItem returns the value of the baggage item key, or "" if there is no such item.
+func (c *SagaAgentContext) BaggageItem(key string) string {
+	return c.Baggage[key]
+}
+
+// SetBaggageItem attaches the baggage item to the saga agent context of the current goroutine.
+func SetBaggageItem(key string, value string) error {
+	c, err := GetSagaAgentContext()
+	if err != nil {
+		return err
+	}
+	return c.SetBaggageItem(key, value)
+}
+
+// BaggageItem returns the value of the baggage item key of the saga agent context of the current goroutine.
+func BaggageItem(key string) string {
+	c, err := GetSagaAgentContext()
+	if err != nil {
+		return ""
+	}
+	return c.BaggageItem(key)
+}
+
+func copyBaggage(baggage map[string]string) map[string]string {
+	if baggage == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(baggage))
+	for k, v := range baggage {
+		copied[k] = v
+	}
+	return copied
+}
+
+func checkBaggageKey(key string) error {
+	if len(key) == 0 {
+		return errors.New("baggage key is empty")
+	}
+	for _, r := range key {
+		if r <= ' ' || r >= 0x7f || strings.ContainsRune(`",;=\`, r) {
+			return errors.New(fmt.Sprintf("baggage key %q contains invalid character %q", key, r))
+		}
+	}
+	return nil
+}
+
+func checkBaggage(baggage map[string]string) error {
+	if len(baggage) > constants.BAGGAGE_MAX_ITEMS {
+		return errors.New(fmt.Sprintf("baggage has more than %d items", constants.BAGGAGE_MAX_ITEMS))
+	}
+	if length := len(EncodeBaggage(baggage)); length > constants.BAGGAGE_MAX_LENGTH {
+		return errors.New(fmt.Sprintf("baggage length %d exceeds %d", length, constants.BAGGAGE_MAX_LENGTH))
+	}
+	return nil
+}
+
+// EncodeBaggage encodes baggage in the list format of the W3C baggage header, such as "tenant=foo,user=bar".
+// The values are percent-encoded, a space is encoded as "%20" and a "+" is kept, as the W3C baggage header requires.
+func EncodeBaggage(baggage map[string]string) string {
+	keys := make([]string, 0, len(baggage))
+	for k := range baggage {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	members := make([]string, 0, len(keys))
+	for _, k := range keys {
+		members = append(members, k+"="+url.PathEscape(baggage[k]))
+	}
+	return strings.Join(members, ",")
+}
+
+// DecodeBaggage decodes baggage encoded by EncodeBaggage, invalid members and members beyond the limits are dropped.
+func DecodeBaggage(s string) map[string]string {
+	if len(s) > constants.BAGGAGE_MAX_LENGTH {
+		return nil
+	}
+	baggage := make(map[string]string)
+	for _, member := range splitBaggage(s) {
+		key, value := parseBaggageMember(member)
+		if checkBaggageKey(key) != nil || len(baggage) >= constants.BAGGAGE_MAX_ITEMS {
+			continue
+		}
+		baggage[key] = value
+	}
+	if len(baggage) == 0 {
+		return nil
+	}
+	return baggage
+}
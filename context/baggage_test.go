@@ -0,0 +1,115 @@
+package context
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jeremyxu2010/matrix-saga-go/constants"
+)
+
+func TestEncodeBaggage(t *testing.T) {
+	cases := []struct {
+		name    string
+		baggage map[string]string
+		want    string
+	}{
+		{"empty", nil, ""},
+		{"sorted", map[string]string{"user": "u", "tenant": "t"}, "tenant=t,user=u"},
+		{"space and plus", map[string]string{"k": "a b+c"}, "k=a%20b+c"},
+		{"separators", map[string]string{"k": "a,b;c"}, "k=a%2Cb%3Bc"},
+		{"percent", map[string]string{"k": "100%"}, "k=100%25"},
+		{"empty value", map[string]string{"k": ""}, "k="},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := EncodeBaggage(c.baggage)
+			if s != c.want {
+				t.Errorf("got %q, want %q", s, c.want)
+			}
+			if got := DecodeBaggage(s); len(c.baggage) > 0 && !reflect.DeepEqual(got, c.baggage) {
+				t.Errorf("decoded %v, want %v", got, c.baggage)
+			}
+		})
+	}
+}
+
+func TestDecodeBaggage(t *testing.T) {
+	tooMany := make([]string, 0, constants.BAGGAGE_MAX_ITEMS+1)
+	for i := 0; i <= constants.BAGGAGE_MAX_ITEMS; i++ {
+		tooMany = append(tooMany, "k"+strconv.Itoa(i)+"=v")
+	}
+	cases := []struct {
+		name string
+		s    string
+		want map[string]string
+	}{
+		{"empty", "", nil},
+		{"plus is not a space", "k=a+b", map[string]string{"k": "a+b"}},
+		{"whitespace and properties", " k = v ;p=1 , u=w", map[string]string{"k": "v", "u": "w"}},
+		{"no value", "k,u=w", map[string]string{"u": "w"}},
+		{"invalid escape", "k=%zz,u=w", map[string]string{"u": "w"}},
+		{"invalid key", "a b=v,u=w", map[string]string{"u": "w"}},
+		{"too long", "k=" + strings.Repeat("v", constants.BAGGAGE_MAX_LENGTH), nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := DecodeBaggage(c.s); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %v, want %v", got, c.want)
+			}
+		})
+	}
+	// the items beyond the limit are dropped
+	if got := DecodeBaggage(strings.Join(tooMany, ",")); len(got) != constants.BAGGAGE_MAX_ITEMS {
+		t.Errorf("got %d items", len(got))
+	}
+}
+
+func TestSetBaggageItem(t *testing.T) {
+	cases := []struct {
+		name  string
+		key   string
+		value string
+		err   string
+	}{
+		{"valid", "tenant", "a b+c", ""},
+		{"empty key", "", "v", "baggage key is empty"},
+		{"invalid key", "a=b", "v", "contains invalid character '='"},
+		{"too long", "k", strings.Repeat("v", constants.BAGGAGE_MAX_LENGTH), "exceeds"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := NewSagaAgentContext()
+			err := ctx.SetBaggageItem(c.key, c.value)
+			if len(c.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Errorf("got error %v, want %q", err, c.err)
+				}
+				if len(ctx.Baggage) > 0 {
+					t.Errorf("invalid item is set, %v", ctx.Baggage)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ctx.BaggageItem(c.key); got != c.value {
+				t.Errorf("got %q", got)
+			}
+		})
+	}
+}
+
+func TestXPackPropagatorBaggage(t *testing.T) {
+	ctx := NewSagaAgentContext()
+	ctx.GlobalTxId = "g"
+	ctx.LocalTxId = "l"
+	ctx.Baggage = map[string]string{"tenant": "a b+c,d"}
+	carrier := MapCarrier{}
+	NewXPackPropagator().Inject(ctx, carrier)
+	got, ok := NewXPackPropagator().Extract(carrier)
+	if !ok || !reflect.DeepEqual(got.Baggage, ctx.Baggage) {
+		t.Errorf("got %+v, %v", got, ok)
+	}
+}
@@ -0,0 +1,30 @@
+package context
+
+import (
+	gocontext "context"
+)
+
+type sagaAgentContextKey struct{}
+
+// WithSagaAgentContext returns a copy of ctx which carries the saga agent context c.
+func WithSagaAgentContext(ctx gocontext.Context, c *SagaAgentContext) gocontext.Context {
+	if ctx == nil {
+		ctx = gocontext.Background()
+	}
+	return gocontext.WithValue(ctx, sagaAgentContextKey{}, c)
+}
+
+// FromContext returns the saga agent context carried by ctx,
+// or the saga agent context of the current goroutine if ctx carries none.
+func FromContext(ctx gocontext.Context) (*SagaAgentContext, bool) {
+	if ctx != nil {
+		if c, ok := ctx.Value(sagaAgentContextKey{}).(*SagaAgentContext); ok && c != nil {
+			return c, true
+		}
+	}
+	c, err := GetSagaAgentContext()
+	if err != nil {
+		return nil, false
+	}
+	return c, true
+}
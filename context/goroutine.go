@@ -0,0 +1,90 @@
+package context
+
+import (
+	gocontext "context"
+	"github.com/cosmos72/gls"
+	"sync"
+)
+
+// Fork returns a copy of c for another goroutine.
+// Compensable methods invoked with the copy start their own LocalTxId chain,
+// whose parent is the current LocalTxId of c, without affecting c itself.
+func (c *SagaAgentContext) Fork() *SagaAgentContext {
+	return &SagaAgentContext{
+		GlobalTxId: c.GlobalTxId,
+		LocalTxId:  c.LocalTxId,
+		Baggage:    copyBaggage(c.Baggage),
+	}
+}
+
+// Go runs fn in a new goroutine with a fork of the saga agent context of the current goroutine,
+// so compensable methods can be invoked in fn.
+func Go(fn func()) {
+	goWithSagaAgentContext(forkCurrent(), fn)
+}
+
+func forkCurrent() *SagaAgentContext {
+	c, err := GetSagaAgentContext()
+	if err != nil {
+		return nil
+	}
+	return c.Fork()
+}
+
+// releaseGoroutineLocals releases all goroutine-local variables of the current goroutine, otherwise they leak when it exits.
+var releaseGoroutineLocals = gls.DelAll
+
+func goWithSagaAgentContext(c *SagaAgentContext, fn func()) {
+	go func() {
+		defer releaseGoroutineLocals()
+		if c != nil {
+			SetSagaAgentContext(c)
+		}
+		fn()
+	}()
+}
+
+// Group is a collection of goroutines working on subtasks of the same saga, like errgroup.Group.
+// Each goroutine started by Go gets a fork of the saga agent context of the goroutine calling Go.
+// A zero Group is valid and does not cancel on error.
+type Group struct {
+	cancel func()
+
+	wg sync.WaitGroup
+
+	errOnce sync.Once
+	err     error
+}
+
+// WithContext returns a new Group and an associated context derived from ctx,
+// which is canceled the first time a function passed to Go returns an error or Wait returns.
+func WithContext(ctx gocontext.Context) (*Group, gocontext.Context) {
+	ctx, cancel := gocontext.WithCancel(ctx)
+	return &Group{cancel: cancel}, ctx
+}
+
+// Go calls fn in a new goroutine with a fork of the saga agent context of the current goroutine.
+// The first call to return a non-nil error cancels the group, its error will be returned by Wait.
+func (g *Group) Go(fn func() error) {
+	g.wg.Add(1)
+	goWithSagaAgentContext(forkCurrent(), func() {
+		defer g.wg.Done()
+		if err := fn(); err != nil {
+			g.errOnce.Do(func() {
+				g.err = err
+				if g.cancel != nil {
+					g.cancel()
+				}
+			})
+		}
+	})
+}
+
+// Wait blocks until all function calls from Go have returned, then returns the first non-nil error (if any) from them.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	if g.cancel != nil {
+		g.cancel()
+	}
+	return g.err
+}
@@ -0,0 +1,156 @@
+package context
+
+import (
+	gocontext "context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordReleased records the saga agent contexts left on the goroutines started by Go after their goroutine-local variables are released,
+// until the returned function is called.
+func recordReleased() (func() []*SagaAgentContext, func()) {
+	var (
+		lock sync.Mutex
+		left []*SagaAgentContext
+	)
+	release := releaseGoroutineLocals
+	releaseGoroutineLocals = func() {
+		release()
+		c, _ := GetSagaAgentContext()
+		lock.Lock()
+		left = append(left, c)
+		lock.Unlock()
+	}
+	return func() []*SagaAgentContext {
+			lock.Lock()
+			defer lock.Unlock()
+			return append([]*SagaAgentContext(nil), left...)
+		}, func() {
+			releaseGoroutineLocals = release
+		}
+}
+
+// forked is the saga agent context of a goroutine started by Go.
+type forked struct {
+	globalTxId string
+	localTxId  string
+	baggage    map[string]string
+}
+
+func TestGoForksTheSagaAgentContext(t *testing.T) {
+	const branches = 3
+	cases := []struct {
+		name string
+		// start runs fn in branches goroutines and waits for them
+		start func(fn func(i int))
+	}{
+		{"go", func(fn func(i int)) {
+			var wg sync.WaitGroup
+			for i := 0; i < branches; i++ {
+				i := i
+				wg.Add(1)
+				Go(func() {
+					defer wg.Done()
+					fn(i)
+				})
+			}
+			wg.Wait()
+		}},
+		{"group", func(fn func(i int)) {
+			var g Group
+			for i := 0; i < branches; i++ {
+				i := i
+				g.Go(func() error {
+					fn(i)
+					return nil
+				})
+			}
+			g.Wait()
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			released, restore := recordReleased()
+			defer restore()
+			parent := NewSagaAgentContext()
+			parent.GlobalTxId = "g1"
+			parent.LocalTxId = "l1"
+			parent.Baggage = map[string]string{"tenant": "t1"}
+			unbind := BindSagaAgentContext(parent)
+			defer unbind()
+
+			var lock sync.Mutex
+			got := make([]forked, branches)
+			c.start(func(i int) {
+				sagaAgentCtx := MustGetSagaAgentContext()
+				lock.Lock()
+				got[i] = forked{sagaAgentCtx.GlobalTxId, sagaAgentCtx.LocalTxId, copyBaggage(sagaAgentCtx.Baggage)}
+				lock.Unlock()
+				// such as a compensable method and a baggage item of the branch
+				sagaAgentCtx.NewLocalTxId()
+				sagaAgentCtx.Baggage["branch"] = "b"
+			})
+
+			for i, f := range got {
+				// the compensable methods of every branch get l1 as their parent tx id
+				if want := (forked{"g1", "l1", map[string]string{"tenant": "t1"}}); !reflect.DeepEqual(f, want) {
+					t.Errorf("branch %d got context %+v, want %+v", i, f, want)
+				}
+			}
+			current, err := GetSagaAgentContext()
+			if err != nil || current != parent {
+				t.Fatalf("got context %v of the caller, want %v", current, parent)
+			}
+			if parent.GlobalTxId != "g1" || parent.LocalTxId != "l1" || !reflect.DeepEqual(parent.Baggage, map[string]string{"tenant": "t1"}) {
+				t.Errorf("context of the caller is changed to %+v", parent)
+			}
+			// the goroutine-local variables are released after the branch returns, so wait for them
+			deadline := time.Now().Add(5 * time.Second)
+			left := released()
+			for len(left) < branches && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+				left = released()
+			}
+			if len(left) != branches {
+				t.Fatalf("%d of %d goroutines released their goroutine-local variables", len(left), branches)
+			}
+			for i, sagaAgentCtx := range left {
+				if sagaAgentCtx != nil {
+					t.Errorf("context %v is left on goroutine %d", sagaAgentCtx, i)
+				}
+			}
+		})
+	}
+}
+
+func TestGoWithoutSagaAgentContext(t *testing.T) {
+	done := make(chan error)
+	Go(func() {
+		_, err := GetSagaAgentContext()
+		done <- err
+	})
+	if err := <-done; err == nil {
+		t.Error("goroutine got a saga agent context")
+	}
+}
+
+func TestGroupReturnsTheFirstError(t *testing.T) {
+	failed := errors.New("failed")
+	g, ctx := WithContext(gocontext.Background())
+	g.Go(func() error {
+		return failed
+	})
+	g.Go(func() error {
+		<-ctx.Done()
+		return errors.New("canceled")
+	})
+	if err := g.Wait(); err != failed {
+		t.Errorf("got error %v, want %v", err, failed)
+	}
+	if ctx.Err() == nil {
+		t.Error("context is not canceled")
+	}
+}
@@ -1,17 +1,255 @@
 package context
 
-import "github.com/satori/go.uuid"
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"hash/fnv"
+	"sync"
+	"time"
+)
 
-type IdGenerator struct{
+// IdGenerator generates the global and local tx ids, which must be unique and at most 36 characters long.
+type IdGenerator interface {
+	NextId() string
 }
 
-func (g *IdGenerator)NextId()string{
+var (
+	idGeneratorLock sync.RWMutex
+	idGenerator     = NewUUIDv4IdGenerator()
+)
+
+// SetIdGenerator sets the generator of the tx ids, defaults to the UUIDv4 generator.
+func SetIdGenerator(g IdGenerator) {
+	idGeneratorLock.Lock()
+	defer idGeneratorLock.Unlock()
+	idGenerator = g
+}
+
+// GetIdGenerator returns the generator of the tx ids.
+func GetIdGenerator() IdGenerator {
+	idGeneratorLock.RLock()
+	defer idGeneratorLock.RUnlock()
+	return idGenerator
+}
+
+func nextId() string {
+	return GetIdGenerator().NextId()
+}
+
+type uuidV4IdGenerator struct {
+}
+
+// NewUUIDv4IdGenerator returns the generator of random UUIDs, the ids of the java omega.
+func NewUUIDv4IdGenerator() IdGenerator {
+	return &uuidV4IdGenerator{}
+}
+
+func (g *uuidV4IdGenerator) NextId() string {
 	return uuid.NewV4().String()
 }
 
-var idGenerator *IdGenerator
+// monotonicClock returns increasing milliseconds for the time ordered generators,
+// it keeps using the last millisecond if the clock goes backwards and borrows the next one when the sequence of a millisecond overflows.
+type monotonicClock struct {
+	lastMs  int64
+	seq     uint64
+	maxSeq  uint64
+	nowFunc func() time.Time
+}
+
+func (c *monotonicClock) next() (int64, uint64) {
+	ms := c.nowFunc().UnixNano() / int64(time.Millisecond)
+	if ms > c.lastMs {
+		c.lastMs = ms
+		c.seq = 0
+		return c.lastMs, c.seq
+	}
+	if c.seq < c.maxSeq {
+		c.seq++
+	} else {
+		c.lastMs++
+		c.seq = 0
+	}
+	return c.lastMs, c.seq
+}
+
+type uuidV7IdGenerator struct {
+	lock  sync.Mutex
+	clock monotonicClock
+}
+
+// NewUUIDv7IdGenerator returns the generator of the time ordered UUIDs of version 7,
+// the ids generated by the same generator are strictly increasing.
+func NewUUIDv7IdGenerator() IdGenerator {
+	return &uuidV7IdGenerator{
+		clock: monotonicClock{maxSeq: 1<<12 - 1, nowFunc: time.Now},
+	}
+}
+
+func (g *uuidV7IdGenerator) NextId() string {
+	g.lock.Lock()
+	ms, seq := g.clock.next()
+	g.lock.Unlock()
+	var u uuid.UUID
+	mustReadRandom(u[8:])
+	// 48 bits unix milliseconds, 4 bits version, 12 bits sequence, 2 bits variant, 62 random bits
+	u[0] = byte(ms >> 40)
+	u[1] = byte(ms >> 32)
+	u[2] = byte(ms >> 24)
+	u[3] = byte(ms >> 16)
+	u[4] = byte(ms >> 8)
+	u[5] = byte(ms)
+	u[6] = 0x70 | byte(seq>>8)
+	u[7] = byte(seq)
+	u[8] = u[8]&0x3f | 0x80
+	return u.String()
+}
+
+const crockfordBase32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+type ulidIdGenerator struct {
+	lock    sync.Mutex
+	lastMs  int64
+	entropy [10]byte
+	nowFunc func() time.Time
+}
+
+// NewULIDIdGenerator returns the generator of ULIDs, the ids generated by the same generator are strictly increasing.
+func NewULIDIdGenerator() IdGenerator {
+	return &ulidIdGenerator{
+		nowFunc: time.Now,
+	}
+}
+
+func (g *ulidIdGenerator) NextId() string {
+	var id [16]byte
+	g.lock.Lock()
+	ms := g.nowFunc().UnixNano() / int64(time.Millisecond)
+	if ms > g.lastMs {
+		g.lastMs = ms
+		mustReadRandom(g.entropy[:])
+	} else if !increment(g.entropy[:]) {
+		// the entropy of the millisecond overflows, borrow the next millisecond
+		g.lastMs++
+		mustReadRandom(g.entropy[:])
+	}
+	binary.BigEndian.PutUint16(id[0:2], uint16(g.lastMs>>32))
+	binary.BigEndian.PutUint32(id[2:6], uint32(g.lastMs))
+	copy(id[6:], g.entropy[:])
+	g.lock.Unlock()
+
+	// 26 characters of 5 bits, the first one only carries 3 bits
+	s := make([]byte, 26)
+	hi := binary.BigEndian.Uint64(id[0:8])
+	lo := binary.BigEndian.Uint64(id[8:16])
+	for i := 25; i >= 0; i-- {
+		s[i] = crockfordBase32[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(s)
+}
+
+// increment increments the big endian number b, and returns false on overflow.
+func increment(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	snowflakeWorkerIdBits = 10
+	snowflakeSequenceBits = 12
+	// MaxSnowflakeWorkerId is the max worker id of the snowflake generator.
+	MaxSnowflakeWorkerId = 1<<snowflakeWorkerIdBits - 1
+)
+
+// snowflakeEpoch is the start of the timestamps of the snowflake ids, 2019-01-01T00:00:00Z.
+var snowflakeEpoch = time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type snowflakeIdGenerator struct {
+	lock     sync.Mutex
+	workerId int64
+	clock    monotonicClock
+}
+
+// NewSnowflakeIdGenerator returns the generator of the snowflake ids,
+// which consist of 41 bits milliseconds since 2019, 10 bits workerId and 12 bits sequence.
+// The ids are formatted as 19 decimal digits padded with zeros, so they sort by time as strings as well.
+// Every instance of the service must use a different workerId.
+func NewSnowflakeIdGenerator(workerId int64) (IdGenerator, error) {
+	if workerId < 0 || workerId > MaxSnowflakeWorkerId {
+		return nil, errors.New(fmt.Sprintf("snowflake worker id %d is out of range [0, %d]", workerId, MaxSnowflakeWorkerId))
+	}
+	return &snowflakeIdGenerator{
+		workerId: workerId,
+		clock:    monotonicClock{maxSeq: 1<<snowflakeSequenceBits - 1, nowFunc: time.Now},
+	}, nil
+}
+
+// NewSnowflakeIdGeneratorForInstance returns the snowflake generator whose worker id is derived from instanceId,
+// such as the pod name, by SnowflakeWorkerId.
+func NewSnowflakeIdGeneratorForInstance(instanceId string) IdGenerator {
+	g, _ := NewSnowflakeIdGenerator(SnowflakeWorkerId(instanceId))
+	return g
+}
 
-func init()  {
-	idGenerator = &IdGenerator{}
+// SnowflakeWorkerId derives a worker id from instanceId by hashing,
+// different instances may get the same worker id, assign the worker ids explicitly if that is not acceptable.
+func SnowflakeWorkerId(instanceId string) int64 {
+	h := fnv.New32a()
+	h.Write([]byte(instanceId))
+	return int64(h.Sum32() % (MaxSnowflakeWorkerId + 1))
 }
 
+func (g *snowflakeIdGenerator) NextId() string {
+	g.lock.Lock()
+	ms, seq := g.clock.next()
+	g.lock.Unlock()
+	elapsed := ms - snowflakeEpoch.UnixNano()/int64(time.Millisecond)
+	id := elapsed<<(snowflakeWorkerIdBits+snowflakeSequenceBits) | g.workerId<<snowflakeSequenceBits | int64(seq)
+	return fmt.Sprintf("%019d", id)
+}
+
+type deterministicIdGenerator struct {
+	lock   sync.Mutex
+	prefix string
+	seq    uint64
+}
+
+// NewDeterministicIdGenerator returns the generator of the ids prefix-000000000001, prefix-000000000002 and so on, for tests.
+func NewDeterministicIdGenerator(prefix string) IdGenerator {
+	return &deterministicIdGenerator{
+		prefix: prefix,
+	}
+}
+
+func (g *deterministicIdGenerator) NextId() string {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.seq++
+	return fmt.Sprintf("%s-%012d", g.prefix, g.seq)
+}
+
+func mustReadRandom(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+}
+
+// businessKeyNamespace is the namespace of the name based global tx ids.
+var businessKeyNamespace = uuid.Must(uuid.FromString("8c1d3c8e-4f57-4c55-9a3e-5b4f2c3f1e6a"))
+
+// GlobalTxIdFromBusinessKey derives a global tx id from the business key of a saga, such as an order number,
+// so that every start of the saga for the same business key gets the same global tx id.
+// The argument scope, such as the service name and the saga start method, keeps the same business key of different sagas apart.
+func GlobalTxIdFromBusinessKey(scope string, businessKey string) string {
+	return uuid.NewV5(businessKeyNamespace, scope+"/"+businessKey).String()
+}
@@ -0,0 +1,222 @@
+package context
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is the clock of the time ordered generators in the tests, it only moves when it is set.
+type fakeClock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) add(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// timeOrderedGenerators returns the time ordered generators whose clock is clock.
+func timeOrderedGenerators(clock func() time.Time) map[string]IdGenerator {
+	uuidV7 := NewUUIDv7IdGenerator().(*uuidV7IdGenerator)
+	uuidV7.clock.nowFunc = clock
+	ulid := NewULIDIdGenerator().(*ulidIdGenerator)
+	ulid.nowFunc = clock
+	snowflake, _ := NewSnowflakeIdGenerator(7)
+	snowflake.(*snowflakeIdGenerator).clock.nowFunc = clock
+	return map[string]IdGenerator{
+		"uuidv7":    uuidV7,
+		"ulid":      ulid,
+		"snowflake": snowflake,
+	}
+}
+
+func TestTimeOrderedIdsIncrease(t *testing.T) {
+	cases := []struct {
+		name string
+		n    int
+		// tick moves the clock before the id i is generated
+		tick func(c *fakeClock, i int)
+	}{
+		{"within a millisecond", 1000, func(c *fakeClock, i int) {}},
+		// more ids than the sequence of a millisecond holds
+		{"sequence overflow", 3 << snowflakeSequenceBits, func(c *fakeClock, i int) {}},
+		{"clock moving forwards", 1000, func(c *fakeClock, i int) {
+			if i%100 == 0 {
+				c.add(time.Millisecond)
+			}
+		}},
+		{"clock going backwards", 1000, func(c *fakeClock, i int) {
+			if i%100 == 0 {
+				c.add(-5 * time.Millisecond)
+			}
+		}},
+	}
+	for _, c := range cases {
+		for _, name := range []string{"uuidv7", "ulid", "snowflake"} {
+			t.Run(c.name+"/"+name, func(t *testing.T) {
+				clock := newFakeClock()
+				g := timeOrderedGenerators(clock.Now)[name]
+				last := ""
+				for i := 0; i < c.n; i++ {
+					c.tick(clock, i)
+					id := g.NextId()
+					if len(id) > 36 {
+						t.Fatalf("id %s is longer than 36 characters", id)
+					}
+					if id <= last {
+						t.Fatalf("id %d %s does not follow %s", i, id, last)
+					}
+					last = id
+				}
+			})
+		}
+	}
+}
+
+func TestIdsAreUniqueUnderConcurrency(t *testing.T) {
+	generators := timeOrderedGenerators(time.Now)
+	generators["uuidv4"] = NewUUIDv4IdGenerator()
+	generators["deterministic"] = NewDeterministicIdGenerator("test")
+	for name, g := range generators {
+		t.Run(name, func(t *testing.T) {
+			const goroutines, perGoroutine = 8, 2000
+			ids := make(chan string, goroutines*perGoroutine)
+			var wg sync.WaitGroup
+			for i := 0; i < goroutines; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < perGoroutine; j++ {
+						ids <- g.NextId()
+					}
+				}()
+			}
+			wg.Wait()
+			close(ids)
+			seen := make(map[string]bool, goroutines*perGoroutine)
+			for id := range ids {
+				if seen[id] {
+					t.Fatalf("id %s is generated twice", id)
+				}
+				seen[id] = true
+			}
+		})
+	}
+}
+
+// snowflakeFields splits the snowflake id into its milliseconds since the epoch, worker id and sequence.
+func snowflakeFields(t *testing.T, id string) (int64, int64, int64) {
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n >> (snowflakeWorkerIdBits + snowflakeSequenceBits), n >> snowflakeSequenceBits & MaxSnowflakeWorkerId, n & (1<<snowflakeSequenceBits - 1)
+}
+
+func TestSnowflakeIdGenerator(t *testing.T) {
+	clock := newFakeClock()
+	g, err := NewSnowflakeIdGenerator(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.(*snowflakeIdGenerator).clock.nowFunc = clock.Now
+	startMs := (clock.Now().UnixNano() - snowflakeEpoch.UnixNano()) / int64(time.Millisecond)
+
+	next := func() (int64, int64) {
+		id := g.NextId()
+		if len(id) != 19 {
+			t.Fatalf("id %s is not 19 digits", id)
+		}
+		ms, workerId, seq := snowflakeFields(t, id)
+		if workerId != 7 {
+			t.Fatalf("id %s has worker id %d, want 7", id, workerId)
+		}
+		return ms, seq
+	}
+
+	if ms, seq := next(); ms != startMs || seq != 0 {
+		t.Fatalf("first id at %d seq %d, want %d seq 0", ms, seq, startMs)
+	}
+	// the clock goes backwards, the last millisecond is kept
+	clock.add(-time.Second)
+	if ms, seq := next(); ms != startMs || seq != 1 {
+		t.Errorf("id after the clock rollback at %d seq %d, want %d seq 1", ms, seq, startMs)
+	}
+	// the sequence of the millisecond overflows, the next millisecond is borrowed
+	for i := 2; i < 1<<snowflakeSequenceBits; i++ {
+		next()
+	}
+	if ms, seq := next(); ms != startMs+1 || seq != 0 {
+		t.Errorf("id after the sequence overflow at %d seq %d, want %d seq 0", ms, seq, startMs+1)
+	}
+	// the clock catches up
+	clock.add(time.Second + 10*time.Millisecond)
+	if ms, seq := next(); ms != startMs+10 || seq != 0 {
+		t.Errorf("id after the clock catches up at %d seq %d, want %d seq 0", ms, seq, startMs+10)
+	}
+}
+
+func TestNewSnowflakeIdGenerator(t *testing.T) {
+	cases := []struct {
+		workerId int64
+		err      bool
+	}{
+		{0, false},
+		{MaxSnowflakeWorkerId, false},
+		{-1, true},
+		{MaxSnowflakeWorkerId + 1, true},
+	}
+	for _, c := range cases {
+		_, err := NewSnowflakeIdGenerator(c.workerId)
+		if err != nil != c.err {
+			t.Errorf("worker id %d: got error %v, want error %v", c.workerId, err, c.err)
+		}
+	}
+	for _, instanceId := range []string{"", "orders-0", "orders-1"} {
+		if workerId := SnowflakeWorkerId(instanceId); workerId < 0 || workerId > MaxSnowflakeWorkerId {
+			t.Errorf("worker id %d of instance %s is out of range", workerId, instanceId)
+		}
+	}
+}
+
+func TestUUIDv7Layout(t *testing.T) {
+	clock := newFakeClock()
+	g := timeOrderedGenerators(clock.Now)["uuidv7"]
+	id := g.NextId()
+	hex := strings.Replace(id, "-", "", -1)
+	ms, err := strconv.ParseInt(hex[:12], 16, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := clock.Now().UnixNano() / int64(time.Millisecond); ms != want {
+		t.Errorf("id %s has milliseconds %d, want %d", id, ms, want)
+	}
+	if hex[12] != '7' {
+		t.Errorf("id %s is not version 7", id)
+	}
+	if !strings.ContainsRune("89ab", rune(hex[16])) {
+		t.Errorf("id %s does not have the RFC 4122 variant", id)
+	}
+}
+
+func TestULIDLayout(t *testing.T) {
+	id := NewULIDIdGenerator().NextId()
+	if len(id) != 26 || strings.Trim(id, crockfordBase32) != "" || id[0] > '7' {
+		t.Errorf("id %s is not a ULID", id)
+	}
+}
@@ -0,0 +1,241 @@
+package context
+
+import (
+	"github.com/jeremyxu2010/matrix-saga-go/constants"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// TextMapCarrier carries the saga context as string key/value pairs,
+// such as HTTP headers, gRPC metadata or the headers of a message.
+type TextMapCarrier interface {
+	Get(key string) string
+	Set(key string, value string)
+	Keys() []string
+}
+
+// HttpHeadersCarrier adapts http.Header to TextMapCarrier.
+type HttpHeadersCarrier http.Header
+
+func (c HttpHeadersCarrier) Get(key string) string {
+	return http.Header(c).Get(key)
+}
+
+func (c HttpHeadersCarrier) Set(key string, value string) {
+	http.Header(c).Set(key, value)
+}
+
+func (c HttpHeadersCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// MapCarrier adapts map[string]string, such as the headers of a message, to TextMapCarrier.
+// Keys are matched case-insensitively on Get since some message brokers change the case of header names.
+type MapCarrier map[string]string
+
+func (c MapCarrier) Get(key string) string {
+	if v, ok := c[key]; ok {
+		return v
+	}
+	for k, v := range c {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+func (c MapCarrier) Set(key string, value string) {
+	c[key] = value
+}
+
+func (c MapCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Propagator injects the saga context into a carrier and extracts it from a carrier.
+type Propagator interface {
+	Inject(c *SagaAgentContext, carrier TextMapCarrier)
+	// Extract returns false if the carrier carries no saga context.
+	Extract(carrier TextMapCarrier) (*SagaAgentContext, bool)
+}
+
+type xPackPropagator struct {
+}
+
+// NewXPackPropagator returns the propagator of the X-Pack headers used by servicecomb-pack omega.
+func NewXPackPropagator() Propagator {
+	return &xPackPropagator{}
+}
+
+func (p *xPackPropagator) Inject(c *SagaAgentContext, carrier TextMapCarrier) {
+	carrier.Set(constants.KEY_GLOBAL_TX_ID_KEY, c.GlobalTxId)
+	carrier.Set(constants.KEY_LOCAL_TX_ID_KEY, c.LocalTxId)
+	if len(c.Baggage) > 0 {
+		carrier.Set(constants.KEY_SAGA_BAGGAGE_KEY, EncodeBaggage(c.Baggage))
+	}
+}
+
+func (p *xPackPropagator) Extract(carrier TextMapCarrier) (*SagaAgentContext, bool) {
+	globalTxId := carrier.Get(constants.KEY_GLOBAL_TX_ID_KEY)
+	if len(globalTxId) == 0 {
+		return nil, false
+	}
+	c := NewSagaAgentContext()
+	c.GlobalTxId = globalTxId
+	c.LocalTxId = carrier.Get(constants.KEY_LOCAL_TX_ID_KEY)
+	c.Baggage = DecodeBaggage(carrier.Get(constants.KEY_SAGA_BAGGAGE_KEY))
+	return c, true
+}
+
+type baggagePropagator struct {
+}
+
+// NewBaggagePropagator returns the propagator which carries the saga context as members of the W3C baggage header.
+// The baggage items of the saga context are carried as members prefixed with "saga.",
+// the other members of the baggage header are kept on injection.
+func NewBaggagePropagator() Propagator {
+	return &baggagePropagator{}
+}
+
+func (p *baggagePropagator) Inject(c *SagaAgentContext, carrier TextMapCarrier) {
+	members := make([]string, 0)
+	for _, member := range splitBaggage(carrier.Get(constants.KEY_BAGGAGE)) {
+		key, _ := parseBaggageMember(member)
+		if key != constants.BAGGAGE_KEY_GLOBAL_TX_ID && key != constants.BAGGAGE_KEY_LOCAL_TX_ID && !strings.HasPrefix(key, constants.BAGGAGE_KEY_PREFIX) {
+			members = append(members, member)
+		}
+	}
+	members = append(members,
+		constants.BAGGAGE_KEY_GLOBAL_TX_ID+"="+url.PathEscape(c.GlobalTxId),
+		constants.BAGGAGE_KEY_LOCAL_TX_ID+"="+url.PathEscape(c.LocalTxId))
+	prefixed := make(map[string]string, len(c.Baggage))
+	for k, v := range c.Baggage {
+		prefixed[constants.BAGGAGE_KEY_PREFIX+k] = v
+	}
+	if len(prefixed) > 0 {
+		members = append(members, EncodeBaggage(prefixed))
+	}
+	carrier.Set(constants.KEY_BAGGAGE, strings.Join(members, ","))
+}
+
+func (p *baggagePropagator) Extract(carrier TextMapCarrier) (*SagaAgentContext, bool) {
+	c := NewSagaAgentContext()
+	for _, member := range splitBaggage(carrier.Get(constants.KEY_BAGGAGE)) {
+		key, value := parseBaggageMember(member)
+		switch key {
+		case constants.BAGGAGE_KEY_GLOBAL_TX_ID:
+			c.GlobalTxId = value
+		case constants.BAGGAGE_KEY_LOCAL_TX_ID:
+			c.LocalTxId = value
+		default:
+			if strings.HasPrefix(key, constants.BAGGAGE_KEY_PREFIX) {
+				item := strings.TrimPrefix(key, constants.BAGGAGE_KEY_PREFIX)
+				if checkBaggageKey(item) == nil && len(c.Baggage) < constants.BAGGAGE_MAX_ITEMS {
+					if c.Baggage == nil {
+						c.Baggage = make(map[string]string)
+					}
+					c.Baggage[item] = value
+				}
+			}
+		}
+	}
+	if len(c.GlobalTxId) == 0 {
+		return nil, false
+	}
+	return c, true
+}
+
+func splitBaggage(baggage string) []string {
+	members := make([]string, 0)
+	for _, member := range strings.Split(baggage, ",") {
+		member = strings.TrimSpace(member)
+		if len(member) > 0 {
+			members = append(members, member)
+		}
+	}
+	return members
+}
+
+// parseBaggageMember parses a baggage member like "key=value;property", the properties are ignored.
+func parseBaggageMember(member string) (string, string) {
+	if i := strings.Index(member, ";"); i >= 0 {
+		member = member[:i]
+	}
+	kv := strings.SplitN(member, "=", 2)
+	if len(kv) != 2 {
+		return "", ""
+	}
+	value, err := url.PathUnescape(strings.TrimSpace(kv[1]))
+	if err != nil {
+		return "", ""
+	}
+	return strings.TrimSpace(kv[0]), value
+}
+
+type compositePropagator struct {
+	propagators []Propagator
+}
+
+// NewCompositePropagator returns a propagator which injects with all the propagators,
+// and extracts with the first propagator that finds the saga context.
+// It allows a service to accept several formats while migrating from one to another.
+func NewCompositePropagator(propagators ...Propagator) Propagator {
+	return &compositePropagator{
+		propagators: propagators,
+	}
+}
+
+func (p *compositePropagator) Inject(c *SagaAgentContext, carrier TextMapCarrier) {
+	for _, propagator := range p.propagators {
+		propagator.Inject(c, carrier)
+	}
+}
+
+func (p *compositePropagator) Extract(carrier TextMapCarrier) (*SagaAgentContext, bool) {
+	for _, propagator := range p.propagators {
+		if c, ok := propagator.Extract(carrier); ok {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+var (
+	propagatorLock sync.RWMutex
+	propagator     = NewXPackPropagator()
+)
+
+// SetPropagator sets the propagator used by the middlewares, defaults to the X-Pack propagator.
+func SetPropagator(p Propagator) {
+	propagatorLock.Lock()
+	defer propagatorLock.Unlock()
+	propagator = p
+}
+
+// GetPropagator returns the propagator used by the middlewares.
+func GetPropagator() Propagator {
+	propagatorLock.RLock()
+	defer propagatorLock.RUnlock()
+	return propagator
+}
+
+// Inject injects the saga context c into carrier with the propagator set by SetPropagator.
+func Inject(c *SagaAgentContext, carrier TextMapCarrier) {
+	GetPropagator().Inject(c, carrier)
+}
+
+// Extract extracts the saga context from carrier with the propagator set by SetPropagator.
+func Extract(carrier TextMapCarrier) (*SagaAgentContext, bool) {
+	return GetPropagator().Extract(carrier)
+}
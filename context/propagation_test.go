@@ -0,0 +1,83 @@
+package context
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBaggagePropagatorRoundTrip(t *testing.T) {
+	cases := []struct {
+		name  string
+		value string
+	}{
+		{"plain", "abc-123"},
+		{"plus", "a+b"},
+		{"space", "a b"},
+		{"separators", "a,b;c=d"},
+		{"percent", "100%"},
+		{"slash and question mark", "a/b?c"},
+		{"unicode", "中文"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := NewSagaAgentContext()
+			ctx.GlobalTxId = "g" + c.value
+			ctx.LocalTxId = "l" + c.value
+			ctx.Baggage = map[string]string{"tenant": c.value}
+			carrier := MapCarrier{}
+			NewBaggagePropagator().Inject(ctx, carrier)
+			if strings.Contains(carrier.Get("baggage"), " ") {
+				t.Errorf("baggage header %q contains spaces", carrier.Get("baggage"))
+			}
+			got, ok := NewBaggagePropagator().Extract(carrier)
+			if !ok {
+				t.Fatalf("no saga context is extracted from %q", carrier.Get("baggage"))
+			}
+			if got.GlobalTxId != ctx.GlobalTxId || got.LocalTxId != ctx.LocalTxId || !reflect.DeepEqual(got.Baggage, ctx.Baggage) {
+				t.Errorf("got %+v, want %+v", got, ctx)
+			}
+		})
+	}
+}
+
+func TestBaggagePropagatorExtract(t *testing.T) {
+	cases := []struct {
+		name       string
+		header     string
+		globalTxId string
+		localTxId  string
+		baggage    map[string]string
+	}{
+		{"plus is not a space", "saga-global-tx-id=a+b,saga-local-tx-id=c+d", "a+b", "c+d", nil},
+		{"percent-encoded", "saga-global-tx-id=a%20b,saga-local-tx-id=c%2Cd,saga.tenant=t%3B1", "a b", "c,d", map[string]string{"tenant": "t;1"}},
+		{"properties and other members", " other=x , saga-global-tx-id=g;p=1,saga.tenant=t;p", "g", "", map[string]string{"tenant": "t"}},
+		{"invalid escape", "saga-global-tx-id=g,saga.tenant=%zz,saga.user=u", "g", "", map[string]string{"user": "u"}},
+		{"no global tx id", "saga-local-tx-id=l,saga.tenant=t", "", "", nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, ok := NewBaggagePropagator().Extract(MapCarrier{"baggage": c.header})
+			if ok != (len(c.globalTxId) > 0) {
+				t.Fatalf("extracted %v", ok)
+			}
+			if !ok {
+				return
+			}
+			if got.GlobalTxId != c.globalTxId || got.LocalTxId != c.localTxId || !reflect.DeepEqual(got.Baggage, c.baggage) {
+				t.Errorf("got %+v", got)
+			}
+		})
+	}
+}
+
+func TestBaggagePropagatorKeepsOtherMembers(t *testing.T) {
+	ctx := NewSagaAgentContext()
+	ctx.GlobalTxId = "g"
+	ctx.LocalTxId = "l"
+	carrier := MapCarrier{"baggage": "other=x;p=1,saga-global-tx-id=old,saga.tenant=old"}
+	NewBaggagePropagator().Inject(ctx, carrier)
+	if got, want := carrier.Get("baggage"), "other=x;p=1,saga-global-tx-id=g,saga-local-tx-id=l"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
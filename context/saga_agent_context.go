@@ -10,6 +10,8 @@ import (
 type SagaAgentContext struct {
 	GlobalTxId string
 	LocalTxId string
+	// Baggage is the business metadata travelling with the global transaction, see SetBaggageItem.
+	Baggage map[string]string
 }
 
 func NewSagaAgentContext()*SagaAgentContext{
@@ -17,7 +19,15 @@ func NewSagaAgentContext()*SagaAgentContext{
 }
 
 func (c *SagaAgentContext) Initialize() {
-	c.GlobalTxId = idGenerator.NextId()
+	c.GlobalTxId = nextId()
+	c.LocalTxId = c.GlobalTxId
+	SetSagaAgentContext(c)
+}
+
+// InitializeWithGlobalTxId is like Initialize, but uses globalTxId instead of generating one,
+// see GlobalTxIdFromBusinessKey.
+func (c *SagaAgentContext) InitializeWithGlobalTxId(globalTxId string) {
+	c.GlobalTxId = globalTxId
 	c.LocalTxId = c.GlobalTxId
 	SetSagaAgentContext(c)
 }
@@ -30,8 +40,26 @@ func ClearSagaAgentContext(){
 	gls.Del(constants.KEY_SAGA_AGENT_CONTEXT)
 }
 
+// BindSagaAgentContext sets c as the saga agent context of the current goroutine, or clears it if c is nil,
+// and returns a function which restores the previous one.
+func BindSagaAgentContext(c *SagaAgentContext) func() {
+	previous, _ := GetSagaAgentContext()
+	if c != nil {
+		SetSagaAgentContext(c)
+	} else {
+		ClearSagaAgentContext()
+	}
+	return func() {
+		if previous != nil {
+			SetSagaAgentContext(previous)
+		} else {
+			ClearSagaAgentContext()
+		}
+	}
+}
+
 func (c *SagaAgentContext) NewLocalTxId() {
-	c.LocalTxId = idGenerator.NextId()
+	c.LocalTxId = nextId()
 }
 
 func GetSagaAgentContext()(*SagaAgentContext, error){
@@ -46,12 +74,11 @@ func GetSagaAgentContext()(*SagaAgentContext, error){
 	}
 }
 
+// ExtractFromHttpHeaders sets the saga agent context carried by headers to the current goroutine if it has none.
+// The saga agent context is never cleared, use the middlewares in package middleware for incoming requests instead.
 func ExtractFromHttpHeaders(headers http.Header){
 	if _, ok := gls.Get(constants.KEY_SAGA_AGENT_CONTEXT); !ok {
-		if len(headers.Get(constants.KEY_GLOBAL_TX_ID_KEY)) > 0 {
-			c := NewSagaAgentContext()
-			c.GlobalTxId = headers.Get(constants.KEY_GLOBAL_TX_ID_KEY)
-			c.LocalTxId = headers.Get(constants.KEY_LOCAL_TX_ID_KEY)
+		if c, ok := Extract(HttpHeadersCarrier(headers)); ok {
 			SetSagaAgentContext(c)
 		}
 	}
@@ -60,8 +87,7 @@ func ExtractFromHttpHeaders(headers http.Header){
 func InjectIntoHttpHeaders(headers http.Header){
 	c, _ := GetSagaAgentContext()
 	if c != nil {
-		headers.Set(constants.KEY_GLOBAL_TX_ID_KEY, c.GlobalTxId)
-		headers.Set(constants.KEY_GLOBAL_TX_ID_KEY, c.LocalTxId)
+		Inject(c, HttpHeadersCarrier(headers))
 	}
 }
 
@@ -0,0 +1,112 @@
+package context
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const tokenVersion = "v1"
+
+type tokenPayload struct {
+	GlobalTxId string            `json:"g"`
+	LocalTxId  string            `json:"l"`
+	Baggage    map[string]string `json:"b,omitempty"`
+}
+
+var (
+	tokenKeyLock sync.RWMutex
+	tokenKey     []byte
+)
+
+// SetTokenSigningKey sets the key to sign the tokens produced by Marshal with HMAC-SHA256.
+// When a key is set, Unmarshal only accepts tokens signed with it.
+func SetTokenSigningKey(key []byte) {
+	tokenKeyLock.Lock()
+	defer tokenKeyLock.Unlock()
+	tokenKey = key
+}
+
+func getTokenSigningKey() []byte {
+	tokenKeyLock.RLock()
+	defer tokenKeyLock.RUnlock()
+	return tokenKey
+}
+
+// Marshal encodes the saga agent context c, including its baggage, into a compact token, which can be stored in a job row or a message
+// and restored by Unmarshal in another process to continue the saga.
+// The token looks like "v1.<payload>" or "v1.<payload>.<signature>" if a signing key is set.
+func Marshal(c *SagaAgentContext) (string, error) {
+	if c == nil {
+		return "", errors.New("saga agent context is nil")
+	}
+	b, err := json.Marshal(&tokenPayload{
+		GlobalTxId: c.GlobalTxId,
+		LocalTxId:  c.LocalTxId,
+		Baggage:    c.Baggage,
+	})
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("encode saga agent context failed, %v", err))
+	}
+	token := tokenVersion + "." + base64.RawURLEncoding.EncodeToString(b)
+	if key := getTokenSigningKey(); len(key) > 0 {
+		token = token + "." + base64.RawURLEncoding.EncodeToString(signToken(key, token))
+	}
+	return token, nil
+}
+
+// Unmarshal decodes a token produced by Marshal into a saga agent context.
+// Bind the result to the current goroutine with BindSagaAgentContext to continue the saga.
+func Unmarshal(token string) (*SagaAgentContext, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil, errors.New("malformed saga context token")
+	}
+	if parts[0] != tokenVersion {
+		return nil, errors.New(fmt.Sprintf("unsupported saga context token version %s", parts[0]))
+	}
+	key := getTokenSigningKey()
+	if len(key) > 0 {
+		if len(parts) != 3 {
+			return nil, errors.New("saga context token is not signed")
+		}
+		signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+		if err != nil || !hmac.Equal(signature, signToken(key, parts[0]+"."+parts[1])) {
+			return nil, errors.New("invalid signature of saga context token")
+		}
+	} else if len(parts) == 3 {
+		return nil, errors.New("saga context token is signed, but no signing key is set")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("malformed saga context token, %v", err))
+	}
+	payload := &tokenPayload{}
+	if err := json.Unmarshal(b, payload); err != nil {
+		return nil, errors.New(fmt.Sprintf("malformed saga context token, %v", err))
+	}
+	if len(payload.GlobalTxId) == 0 {
+		return nil, errors.New("saga context token has no global transaction id")
+	}
+	c := NewSagaAgentContext()
+	c.GlobalTxId = payload.GlobalTxId
+	c.LocalTxId = payload.LocalTxId
+	if len(payload.Baggage) > 0 {
+		if err := checkBaggage(payload.Baggage); err != nil {
+			return nil, errors.New(fmt.Sprintf("malformed saga context token, %v", err))
+		}
+		c.Baggage = payload.Baggage
+	}
+	return c, nil
+}
+
+func signToken(key []byte, token string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(token))
+	return mac.Sum(nil)
+}
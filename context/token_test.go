@@ -0,0 +1,95 @@
+package context
+
+import (
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jeremyxu2010/matrix-saga-go/constants"
+)
+
+func TestTokenRoundTrip(t *testing.T) {
+	defer SetTokenSigningKey(nil)
+	cases := []struct {
+		name    string
+		key     []byte
+		baggage map[string]string
+		parts   int
+	}{
+		{"unsigned", nil, nil, 2},
+		{"unsigned with baggage", nil, map[string]string{"tenant": "t1"}, 2},
+		{"signed", []byte("secret"), nil, 3},
+		{"signed with baggage", []byte("secret"), map[string]string{"tenant": "t1", "user": "u1"}, 3},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			SetTokenSigningKey(c.key)
+			ctx := NewSagaAgentContext()
+			ctx.GlobalTxId = "g1"
+			ctx.LocalTxId = "l1"
+			ctx.Baggage = c.baggage
+			token, err := Marshal(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parts := strings.Split(token, "."); len(parts) != c.parts || parts[0] != tokenVersion {
+				t.Errorf("got token %s, want %d parts of version %s", token, c.parts, tokenVersion)
+			}
+			got, err := Unmarshal(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.GlobalTxId != "g1" || got.LocalTxId != "l1" || !reflect.DeepEqual(got.Baggage, c.baggage) {
+				t.Errorf("got context %+v", got)
+			}
+		})
+	}
+}
+
+func TestMarshalNilContext(t *testing.T) {
+	if _, err := Marshal(nil); err == nil {
+		t.Error("nil context is marshaled")
+	}
+}
+
+func TestUnmarshalInvalidToken(t *testing.T) {
+	defer SetTokenSigningKey(nil)
+	encode := func(payload string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(payload))
+	}
+	signed := func(key string, token string) string {
+		return token + "." + base64.RawURLEncoding.EncodeToString(signToken([]byte(key), token))
+	}
+	valid := tokenVersion + "." + encode(`{"g":"g1","l":"l1"}`)
+	cases := []struct {
+		name  string
+		key   []byte
+		token string
+		err   string
+	}{
+		{"empty", nil, "", "malformed saga context token"},
+		{"no payload", nil, tokenVersion, "malformed saga context token"},
+		{"too many parts", nil, valid + ".a.b", "malformed saga context token"},
+		{"unknown version", nil, "v2." + encode(`{"g":"g1"}`), "unsupported saga context token version v2"},
+		{"invalid base64", nil, tokenVersion + ".!!!", "malformed saga context token"},
+		{"truncated payload", nil, valid[:len(valid)-4], "malformed saga context token"},
+		{"malformed json", nil, tokenVersion + "." + encode(`{"g":`), "malformed saga context token"},
+		{"no global tx id", nil, tokenVersion + "." + encode(`{"l":"l1"}`), "has no global transaction id"},
+		{"baggage too long", nil, tokenVersion + "." + encode(`{"g":"g1","b":{"k":"`+strings.Repeat("v", constants.BAGGAGE_MAX_LENGTH)+`"}}`), "malformed saga context token"},
+		{"signed token without a key", nil, signed("secret", valid), "no signing key is set"},
+		{"unsigned token with a key", []byte("secret"), valid, "saga context token is not signed"},
+		{"bad signature", []byte("secret"), signed("other", valid), "invalid signature"},
+		{"invalid base64 signature", []byte("secret"), valid + ".!!!", "invalid signature"},
+		{"truncated signature", []byte("secret"), signed("secret", valid)[:len(signed("secret", valid))-2], "invalid signature"},
+		{"tampered payload", []byte("secret"), strings.Replace(signed("secret", valid), encode(`{"g":"g1","l":"l1"}`), encode(`{"g":"g2","l":"l1"}`), 1), "invalid signature"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			SetTokenSigningKey(c.key)
+			if _, err := Unmarshal(c.token); err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("got error %v, want %q", err, c.err)
+			}
+		})
+	}
+}
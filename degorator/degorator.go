@@ -17,6 +17,9 @@ var ERROR_TYPE_NAME = "error"
 // The argument target is the function to be decorated.
 // The argument before is the function to be injected before the target function.
 // The argument after is the function to be injected after the target function.
+// If the function injected before returns an error, the target function is not called and the error is returned as its trailing error result.
+// The function injected before may also set the results under constants.KEY_FUNCTION_CALL_RESULTS of the metadata to skip the target function,
+// and the function injected after finds the results of the target function there.
 func Decorate(decorated interface{}, target interface{}, before interface{}, after interface{}) (err error) {
 	var targetFunc reflect.Value
 	var decoratedFunc reflect.Value
@@ -47,17 +50,24 @@ func Decorate(decorated interface{}, target interface{}, before interface{}, aft
 				if m, ok := metadata.FromContext(ctx); ok {
 					m[constants.KEY_FUNCTION_CALL_ARGS] = in
 				}
-				beforeOut := beforeFunc.CallSlice([]reflect.Value{reflect.ValueOf(ctx)})
+				beforeOut := beforeFunc.Call([]reflect.Value{reflect.ValueOf(ctx)})
 				if !beforeOut[0].IsNil() {
-					return
+					return errorResults(targetFunc.Type(), beforeOut[0].Interface().(error))
+				}
+				if results, ok := shortCircuitResults(ctx); ok {
+					return results
 				}
 			}
 			out, err = safeCallSlice(targetFunc, in)
+			if out == nil {
+				out = errorResults(targetFunc.Type(), err)
+			}
 			if after != nil {
 				if m, ok := metadata.FromContext(ctx); ok {
 					m[constants.KEY_FUNCTION_CALL_ERROR] = err
+					m[constants.KEY_FUNCTION_CALL_RESULTS] = out
 				}
-				afterOut := afterFunc.CallSlice([]reflect.Value{reflect.ValueOf(ctx)})
+				afterOut := afterFunc.Call([]reflect.Value{reflect.ValueOf(ctx)})
 				if !afterOut[0].IsNil() {
 					return
 				}
@@ -69,13 +79,20 @@ func Decorate(decorated interface{}, target interface{}, before interface{}, aft
 				}
 				beforeOut := beforeFunc.Call([]reflect.Value{reflect.ValueOf(ctx)})
 				if !beforeOut[0].IsNil() {
-					return
+					return errorResults(targetFunc.Type(), beforeOut[0].Interface().(error))
+				}
+				if results, ok := shortCircuitResults(ctx); ok {
+					return results
 				}
 			}
 			out, err = safeCall(targetFunc, in)
+			if out == nil {
+				out = errorResults(targetFunc.Type(), err)
+			}
 			if after != nil {
 				if m, ok := metadata.FromContext(ctx); ok {
 					m[constants.KEY_FUNCTION_CALL_ERROR] = err
+					m[constants.KEY_FUNCTION_CALL_RESULTS] = out
 				}
 				afterOut := afterFunc.Call([]reflect.Value{reflect.ValueOf(ctx)})
 				if !afterOut[0].IsNil() {
@@ -88,6 +105,29 @@ func Decorate(decorated interface{}, target interface{}, before interface{}, aft
 	return
 }
 
+// errorResults returns the zero values of the results of a function of type fnType, with err as the trailing error result if there is one.
+func errorResults(fnType reflect.Type, err error) []reflect.Value {
+	out := make([]reflect.Value, fnType.NumOut())
+	for i := 0; i < fnType.NumOut(); i++ {
+		out[i] = reflect.Zero(fnType.Out(i))
+	}
+	if n := fnType.NumOut(); n > 0 && fnType.Out(n - 1).String() == ERROR_TYPE_NAME && err != nil {
+		out[n - 1] = reflect.ValueOf(err)
+	}
+	return out
+}
+
+// shortCircuitResults returns the results set by the function injected before into the metadata,
+// in which case neither the target function nor the function injected after is called.
+func shortCircuitResults(ctx context.Context) ([]reflect.Value, bool) {
+	if m, ok := metadata.FromContext(ctx); ok {
+		if results, ok := m[constants.KEY_FUNCTION_CALL_RESULTS].([]reflect.Value); ok {
+			return results, true
+		}
+	}
+	return nil, false
+}
+
 func safeCallSlice(targetFunc reflect.Value, in []reflect.Value) (out []reflect.Value, err error) {
 	defer func() {
 		cause := recover()
@@ -0,0 +1,155 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jeremyxu2010/matrix-saga-go/log"
+	"github.com/jeremyxu2010/matrix-saga-go/redact"
+	"google.golang.org/grpc/resolver"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var schemeSeq int64
+
+// minResolveNowInterval is the min interval between the resolutions asked by gRPC,
+// which asks for one whenever a connection fails, such as every reconnection while the coordinators are down.
+const minResolveNowInterval = time.Second
+
+// RegisterGrpcResolver registers a gRPC resolver builder of r under a unique scheme,
+// and returns the target to dial, such as "saga-discovery-1:///coordinators".
+// The coordinators are resolved every interval, and whenever gRPC asks for it because a connection fails, at most once a second.
+// The failed resolutions are logged by logger, the last addresses are kept.
+// The builder stays registered, so it should be called once per connection.
+func RegisterGrpcResolver(r Resolver, interval time.Duration, timeout time.Duration, logger log.Logger) string {
+	scheme := fmt.Sprintf("saga-discovery-%d", atomic.AddInt64(&schemeSeq, 1))
+	resolver.Register(newGrpcResolverBuilder(scheme, r, interval, timeout, logger))
+	return scheme + ":///coordinators"
+}
+
+type grpcResolverBuilder struct {
+	scheme             string
+	r                  Resolver
+	interval           time.Duration
+	timeout            time.Duration
+	resolveNowInterval time.Duration
+	logger             log.Logger
+}
+
+func newGrpcResolverBuilder(scheme string, r Resolver, interval time.Duration, timeout time.Duration, logger log.Logger) *grpcResolverBuilder {
+	if logger == nil {
+		logger = log.NewNoopLogger()
+	}
+	return &grpcResolverBuilder{
+		scheme:             scheme,
+		r:                  r,
+		interval:           interval,
+		timeout:            timeout,
+		resolveNowInterval: minResolveNowInterval,
+		logger:             logger,
+	}
+}
+
+func (b *grpcResolverBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOption) (resolver.Resolver, error) {
+	gr := &grpcResolver{
+		builder:    b,
+		cc:         cc,
+		resolveNow: make(chan struct{}, 1),
+		closed:     make(chan struct{}),
+	}
+	gr.wg.Add(1)
+	go gr.watch()
+	return gr, nil
+}
+
+func (b *grpcResolverBuilder) Scheme() string {
+	return b.scheme
+}
+
+type grpcResolver struct {
+	builder    *grpcResolverBuilder
+	cc         resolver.ClientConn
+	resolveNow chan struct{}
+	closed     chan struct{}
+	closeOnce  sync.Once
+	wg         sync.WaitGroup
+	last       []string
+}
+
+func (r *grpcResolver) watch() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.builder.interval)
+	defer ticker.Stop()
+	for {
+		resolved := time.Now()
+		r.resolve()
+		select {
+		case <-r.closed:
+			return
+		case <-ticker.C:
+		case <-r.resolveNow:
+			if wait := r.builder.resolveNowInterval - time.Since(resolved); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-r.closed:
+					timer.Stop()
+					return
+				case <-timer.C:
+				}
+			}
+		}
+	}
+}
+
+// resolve updates the addresses of the client connection, the last addresses are kept if the resolution fails.
+func (r *grpcResolver) resolve() {
+	ctx, cancel := context.WithTimeout(context.Background(), r.builder.timeout)
+	defer cancel()
+	addresses, err := r.builder.r.Resolve(ctx)
+	if err == nil && len(addresses) == 0 {
+		err = errors.New("no coordinator address")
+	}
+	if err != nil {
+		r.builder.logger.LogError(fmt.Sprintf("Failed to resolve the coordinators, keeping the addresses %v, %v", r.last, redact.Sprint(err)))
+		return
+	}
+	if equalAddresses(addresses, r.last) {
+		return
+	}
+	r.last = addresses
+	state := resolver.State{
+		Addresses: make([]resolver.Address, 0, len(addresses)),
+	}
+	for _, address := range addresses {
+		state.Addresses = append(state.Addresses, resolver.Address{Addr: address})
+	}
+	r.cc.UpdateState(state)
+}
+
+func (r *grpcResolver) ResolveNow(opts resolver.ResolveNowOption) {
+	select {
+	case r.resolveNow <- struct{}{}:
+	default:
+	}
+}
+
+func (r *grpcResolver) Close() {
+	r.closeOnce.Do(func() {
+		close(r.closed)
+	})
+	r.wg.Wait()
+}
+
+func equalAddresses(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,209 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+)
+
+// fakeClientConn records the addresses updated by the resolver.
+type fakeClientConn struct {
+	lock    sync.Mutex
+	updates [][]string
+}
+
+func (cc *fakeClientConn) UpdateState(state resolver.State) {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+	addresses := make([]string, 0, len(state.Addresses))
+	for _, address := range state.Addresses {
+		addresses = append(addresses, address.Addr)
+	}
+	cc.updates = append(cc.updates, addresses)
+}
+
+func (cc *fakeClientConn) NewAddress(addresses []resolver.Address) {
+}
+
+func (cc *fakeClientConn) NewServiceConfig(serviceConfig string) {
+}
+
+func (cc *fakeClientConn) updated() [][]string {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+	return append([][]string(nil), cc.updates...)
+}
+
+// errorLogger records the error logs.
+type errorLogger struct {
+	lock   sync.Mutex
+	errors []string
+}
+
+func (l *errorLogger) LogWarn(content string)  {}
+func (l *errorLogger) LogInfo(content string)  {}
+func (l *errorLogger) LogDebug(content string) {}
+func (l *errorLogger) LogFatal(content string) {}
+
+func (l *errorLogger) LogError(content string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.errors = append(l.errors, content)
+}
+
+func (l *errorLogger) logged() []string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return append([]string(nil), l.errors...)
+}
+
+// resolution is a result of a scriptedResolver.
+type resolution struct {
+	addresses []string
+	err       error
+}
+
+// scriptedResolver returns its resolutions in turn, then the last one, and records the times it is called.
+type scriptedResolver struct {
+	lock        sync.Mutex
+	resolutions []resolution
+	calls       []time.Time
+}
+
+func (r *scriptedResolver) Resolve(ctx context.Context) ([]string, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	i := len(r.calls)
+	if i >= len(r.resolutions) {
+		i = len(r.resolutions) - 1
+	}
+	r.calls = append(r.calls, time.Now())
+	return r.resolutions[i].addresses, r.resolutions[i].err
+}
+
+func (r *scriptedResolver) called() []time.Time {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]time.Time(nil), r.calls...)
+}
+
+// waitCalls waits until r is called n times.
+func waitCalls(t *testing.T, r *scriptedResolver, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for len(r.called()) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("resolver is called %d times, want %d", len(r.called()), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func buildTestResolver(t *testing.T, r Resolver, interval time.Duration, resolveNowInterval time.Duration) (resolver.Resolver, *fakeClientConn, *errorLogger) {
+	logger := &errorLogger{}
+	b := newGrpcResolverBuilder("saga-discovery-test", r, interval, time.Second, logger)
+	b.resolveNowInterval = resolveNowInterval
+	cc := &fakeClientConn{}
+	gr, err := b.Build(resolver.Target{Scheme: b.Scheme(), Endpoint: "coordinators"}, cc, resolver.BuildOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gr, cc, logger
+}
+
+func TestGrpcResolverUpdatesAddresses(t *testing.T) {
+	unavailable := errors.New("dns unavailable")
+	cases := []struct {
+		name        string
+		resolutions []resolution
+		want        [][]string
+		errors      int
+	}{
+		{"addresses", []resolution{{addresses: []string{"a:1", "b:1"}}}, [][]string{{"a:1", "b:1"}}, 0},
+		{"unchanged addresses", []resolution{{addresses: []string{"a:1"}}, {addresses: []string{"a:1"}}}, [][]string{{"a:1"}}, 0},
+		{"changed addresses", []resolution{{addresses: []string{"a:1"}}, {addresses: []string{"a:1", "b:1"}}}, [][]string{{"a:1"}, {"a:1", "b:1"}}, 0},
+		{"failed resolution", []resolution{{addresses: []string{"a:1"}}, {err: unavailable}, {addresses: []string{"a:1"}}}, [][]string{{"a:1"}}, 1},
+		{"no addresses", []resolution{{addresses: []string{"a:1"}}, {}, {addresses: []string{"b:1"}}}, [][]string{{"a:1"}, {"b:1"}}, 1},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// the last resolution is repeated, so the resolutions after it change nothing
+			r := &scriptedResolver{resolutions: c.resolutions}
+			gr, cc, logger := buildTestResolver(t, r, time.Millisecond, time.Second)
+			waitCalls(t, r, len(c.resolutions)+1)
+			gr.Close()
+			if got := cc.updated(); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got updates %v, want %v", got, c.want)
+			}
+			logged := logger.logged()
+			if len(logged) != c.errors {
+				t.Fatalf("got error logs %q, want %d", logged, c.errors)
+			}
+			for _, log := range logged {
+				if !strings.Contains(log, "Failed to resolve the coordinators, keeping the addresses [a:1]") {
+					t.Errorf("got error log %q", log)
+				}
+			}
+		})
+	}
+}
+
+func TestGrpcResolverRateLimitsResolveNow(t *testing.T) {
+	const resolveNowInterval = 100 * time.Millisecond
+	r := &scriptedResolver{resolutions: []resolution{{addresses: []string{"a:1"}}}}
+	gr, _, _ := buildTestResolver(t, r, time.Hour, resolveNowInterval)
+	defer gr.Close()
+	waitCalls(t, r, 1)
+	// such as the reconnections while the coordinators are down
+	for i := 0; i < 20; i++ {
+		gr.ResolveNow(resolver.ResolveNowOption{})
+	}
+	waitCalls(t, r, 2)
+	time.Sleep(3 * resolveNowInterval)
+	calls := r.called()
+	if len(calls) > 3 {
+		t.Errorf("resolver is called %d times for 20 ResolveNow", len(calls))
+	}
+	for i := 1; i < len(calls); i++ {
+		if gap := calls[i].Sub(calls[i-1]); gap < resolveNowInterval {
+			t.Errorf("resolution %d follows the previous one after %v, want at least %v", i, gap, resolveNowInterval)
+		}
+	}
+}
+
+func TestGrpcResolverCloseStopsWaiting(t *testing.T) {
+	r := &scriptedResolver{resolutions: []resolution{{addresses: []string{"a:1"}}}}
+	gr, _, _ := buildTestResolver(t, r, time.Hour, time.Hour)
+	waitCalls(t, r, 1)
+	gr.ResolveNow(resolver.ResolveNowOption{})
+	closed := make(chan struct{})
+	go func() {
+		gr.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("resolver is not closed while waiting to resolve")
+	}
+}
+
+func TestRegisterGrpcResolver(t *testing.T) {
+	r := NewStaticResolver("a:1")
+	first := RegisterGrpcResolver(r, time.Hour, time.Second, nil)
+	second := RegisterGrpcResolver(r, time.Hour, time.Second, nil)
+	if first == second {
+		t.Fatalf("both resolvers are registered as %s", first)
+	}
+	for _, target := range []string{first, second} {
+		scheme := strings.TrimSuffix(target, ":///coordinators")
+		if resolver.Get(scheme) == nil {
+			t.Errorf("resolver of %s is not registered", target)
+		}
+	}
+}
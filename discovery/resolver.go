@@ -0,0 +1,174 @@
+package discovery
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Resolver resolves the addresses of the coordinators, the alpha servers.
+// It is called periodically and whenever the connection to the coordinators fails,
+// so it reflects the changes of the coordinators, such as the pods behind a headless service.
+type Resolver interface {
+	// Resolve returns the addresses like host:port of the coordinators.
+	Resolve(ctx context.Context) ([]string, error)
+}
+
+// ResolverFunc adapts a function to Resolver.
+type ResolverFunc func(ctx context.Context) ([]string, error)
+
+func (f ResolverFunc) Resolve(ctx context.Context) ([]string, error) {
+	return f(ctx)
+}
+
+type staticResolver struct {
+	addresses []string
+}
+
+// NewStaticResolver returns the resolver of the fixed addresses.
+func NewStaticResolver(addresses ...string) Resolver {
+	return &staticResolver{
+		addresses: addresses,
+	}
+}
+
+func (r *staticResolver) Resolve(ctx context.Context) ([]string, error) {
+	return r.addresses, nil
+}
+
+type dnsResolver struct {
+	host string
+	port string
+}
+
+// NewDNSResolver returns the resolver of the A and AAAA records of the host of address, such as the name of a headless service.
+// The argument address is like host:port.
+func NewDNSResolver(address string) (Resolver, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	return &dnsResolver{
+		host: host,
+		port: port,
+	}, nil
+}
+
+func (r *dnsResolver) Resolve(ctx context.Context) ([]string, error) {
+	ips, err := net.DefaultResolver.LookupHost(ctx, r.host)
+	if err != nil {
+		return nil, err
+	}
+	addresses := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addresses = append(addresses, net.JoinHostPort(ip, r.port))
+	}
+	return addresses, nil
+}
+
+type dnsSRVResolver struct {
+	service string
+	proto   string
+	name    string
+}
+
+// NewDNSSRVResolver returns the resolver of the SRV records _service._proto.name, which carry the ports of the coordinators as well.
+// The records are ordered by priority and weight.
+func NewDNSSRVResolver(service string, proto string, name string) Resolver {
+	return &dnsSRVResolver{
+		service: service,
+		proto:   proto,
+		name:    name,
+	}
+}
+
+func (r *dnsSRVResolver) Resolve(ctx context.Context) ([]string, error) {
+	_, records, err := net.DefaultResolver.LookupSRV(ctx, r.service, r.proto, r.name)
+	if err != nil {
+		return nil, err
+	}
+	addresses := make([]string, 0, len(records))
+	for _, record := range records {
+		addresses = append(addresses, net.JoinHostPort(strings.TrimSuffix(record.Target, "."), strconv.Itoa(int(record.Port))))
+	}
+	return addresses, nil
+}
+
+type fileResolver struct {
+	path string
+}
+
+// NewFileResolver returns the resolver of the addresses listed in the file path, one per line or separated by commas.
+// Empty lines and lines starting with # are ignored. The file is read on every resolution,
+// so the changes of it, such as a mounted ConfigMap, are picked up.
+func NewFileResolver(path string) Resolver {
+	return &fileResolver{
+		path: path,
+	}
+}
+
+func (r *fileResolver) Resolve(ctx context.Context) ([]string, error) {
+	b, err := ioutil.ReadFile(r.path)
+	if err != nil {
+		return nil, err
+	}
+	addresses := make([]string, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, address := range strings.Split(line, ",") {
+			address = strings.TrimSpace(address)
+			if len(address) > 0 {
+				addresses = append(addresses, address)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return addresses, nil
+}
+
+// ParseResolver returns the resolver of the coordinator addresses as configured in alpha.cluster.address:
+//
+//	alpha-0:8080,alpha-1:8080          static addresses
+//	dns://alpha-headless:8080          the A and AAAA records of alpha-headless
+//	srv://_grpc._tcp.alpha-headless    the SRV records
+//	file:///etc/saga/alpha-addresses   the addresses listed in the file
+//
+// A resolver address must be the only address.
+func ParseResolver(addresses []string) (Resolver, error) {
+	if len(addresses) == 0 {
+		return nil, errors.New("no coordinator address")
+	}
+	for _, address := range addresses {
+		if strings.Contains(address, "://") && len(addresses) > 1 {
+			return nil, errors.New(fmt.Sprintf("coordinator address %s can not be used with other addresses", address))
+		}
+	}
+	address := addresses[0]
+	switch {
+	case strings.HasPrefix(address, "dns://"):
+		return NewDNSResolver(strings.TrimPrefix(address, "dns://"))
+	case strings.HasPrefix(address, "srv://"):
+		parts := strings.SplitN(strings.TrimPrefix(address, "srv://"), ".", 3)
+		if len(parts) != 3 || !strings.HasPrefix(parts[0], "_") || !strings.HasPrefix(parts[1], "_") {
+			return nil, errors.New(fmt.Sprintf("invalid SRV coordinator address %s, it should be like srv://_service._proto.name", address))
+		}
+		return NewDNSSRVResolver(strings.TrimPrefix(parts[0], "_"), strings.TrimPrefix(parts[1], "_"), parts[2]), nil
+	case strings.HasPrefix(address, "file://"):
+		return NewFileResolver(strings.TrimPrefix(address, "file://")), nil
+	case strings.Contains(address, "://"):
+		return nil, errors.New(fmt.Sprintf("unsupported coordinator address %s", address))
+	}
+	return NewStaticResolver(addresses...), nil
+}
@@ -0,0 +1,95 @@
+package discovery
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseResolver(t *testing.T) {
+	cases := []struct {
+		name      string
+		addresses []string
+		want      Resolver
+		err       string
+	}{
+		{"static address", []string{"alpha-0:8080"}, NewStaticResolver("alpha-0:8080"), ""},
+		{"static addresses", []string{"alpha-0:8080", "alpha-1:8080"}, NewStaticResolver("alpha-0:8080", "alpha-1:8080"), ""},
+		{"dns", []string{"dns://alpha-headless:8080"}, &dnsResolver{host: "alpha-headless", port: "8080"}, ""},
+		{"srv", []string{"srv://_grpc._tcp.alpha-headless.saga.svc"}, NewDNSSRVResolver("grpc", "tcp", "alpha-headless.saga.svc"), ""},
+		{"file", []string{"file:///etc/saga/alpha-addresses"}, NewFileResolver("/etc/saga/alpha-addresses"), ""},
+		{"no address", nil, nil, "no coordinator address"},
+		{"dns without port", []string{"dns://alpha-headless"}, nil, "missing port"},
+		{"srv without service", []string{"srv://grpc._tcp.alpha-headless"}, nil, "invalid SRV coordinator address"},
+		{"srv without name", []string{"srv://_grpc._tcp"}, nil, "invalid SRV coordinator address"},
+		{"unsupported scheme", []string{"consul://alpha"}, nil, "unsupported coordinator address consul://alpha"},
+		{"resolver with other addresses", []string{"alpha-0:8080", "dns://alpha-headless:8080"}, nil, "can not be used with other addresses"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r, err := ParseResolver(c.addresses)
+			if len(c.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Errorf("got error %v, want %q", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(r, c.want) {
+				t.Errorf("got resolver %#v, want %#v", r, c.want)
+			}
+		})
+	}
+}
+
+func TestStaticResolver(t *testing.T) {
+	addresses, err := NewStaticResolver("alpha-0:8080", "alpha-1:8080").Resolve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"alpha-0:8080", "alpha-1:8080"}; !reflect.DeepEqual(addresses, want) {
+		t.Errorf("got addresses %v, want %v", addresses, want)
+	}
+}
+
+func TestFileResolver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "saga-discovery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cases := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"one per line", "alpha-0:8080\nalpha-1:8080\n", []string{"alpha-0:8080", "alpha-1:8080"}},
+		{"separated by commas", "alpha-0:8080, alpha-1:8080,\nalpha-2:8080", []string{"alpha-0:8080", "alpha-1:8080", "alpha-2:8080"}},
+		{"comments and empty lines", "# coordinators\n\n  alpha-0:8080  \n#alpha-1:8080\n", []string{"alpha-0:8080"}},
+		{"empty file", "", []string{}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			path := filepath.Join(dir, "alpha-addresses")
+			if err := ioutil.WriteFile(path, []byte(c.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			addresses, err := NewFileResolver(path).Resolve(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(addresses, c.want) {
+				t.Errorf("got addresses %q, want %q", addresses, c.want)
+			}
+		})
+	}
+	if _, err := NewFileResolver(filepath.Join(dir, "missing")).Resolve(context.Background()); !os.IsNotExist(err) {
+		t.Errorf("got error %v, want the file not to exist", err)
+	}
+}
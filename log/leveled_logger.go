@@ -0,0 +1,85 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+	LevelFatal
+)
+
+// ParseLevel parses the level names debug, info, warn, error and fatal.
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	case "fatal":
+		return LevelFatal, nil
+	}
+	return LevelDebug, errors.New(fmt.Sprintf("unknown log level %s", name))
+}
+
+// LeveledLogger drops the logs below its level, which can be changed at any time.
+type LeveledLogger struct {
+	logger Logger
+	level  int32
+}
+
+func NewLeveledLogger(logger Logger, level Level) *LeveledLogger {
+	return &LeveledLogger{
+		logger: logger,
+		level:  int32(level),
+	}
+}
+
+func (l *LeveledLogger) SetLevel(level Level) {
+	atomic.StoreInt32(&l.level, int32(level))
+}
+
+func (l *LeveledLogger) Level() Level {
+	return Level(atomic.LoadInt32(&l.level))
+}
+
+func (l *LeveledLogger) LogWarn(content string) {
+	if l.Level() <= LevelWarn {
+		l.logger.LogWarn(content)
+	}
+}
+
+func (l *LeveledLogger) LogError(content string) {
+	if l.Level() <= LevelError {
+		l.logger.LogError(content)
+	}
+}
+
+func (l *LeveledLogger) LogInfo(content string) {
+	if l.Level() <= LevelInfo {
+		l.logger.LogInfo(content)
+	}
+}
+
+func (l *LeveledLogger) LogDebug(content string) {
+	if l.Level() <= LevelDebug {
+		l.logger.LogDebug(content)
+	}
+}
+
+// LogFatal is never dropped, since the underlying logger may exit the process.
+func (l *LeveledLogger) LogFatal(content string) {
+	l.logger.LogFatal(content)
+}
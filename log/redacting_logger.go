@@ -0,0 +1,35 @@
+package log
+
+// redactingLogger masks the secrets in the logs before they are written by the underlying logger.
+type redactingLogger struct {
+	logger Logger
+	redact func(content string) string
+}
+
+// NewRedactingLogger creates a logger masking the logs by redact, such as redact.String, before they are written by logger.
+func NewRedactingLogger(logger Logger, redact func(content string) string) Logger {
+	return &redactingLogger{
+		logger: logger,
+		redact: redact,
+	}
+}
+
+func (l *redactingLogger) LogWarn(content string) {
+	l.logger.LogWarn(l.redact(content))
+}
+
+func (l *redactingLogger) LogError(content string) {
+	l.logger.LogError(l.redact(content))
+}
+
+func (l *redactingLogger) LogInfo(content string) {
+	l.logger.LogInfo(l.redact(content))
+}
+
+func (l *redactingLogger) LogDebug(content string) {
+	l.logger.LogDebug(l.redact(content))
+}
+
+func (l *redactingLogger) LogFatal(content string) {
+	l.logger.LogFatal(l.redact(content))
+}
@@ -1,13 +1,17 @@
 package middleware
 
 import (
-	sagactx "github.com/jeremyxu2010/matrix-saga-go/context"
 	"github.com/gin-gonic/gin"
+	"net/http"
 )
 
+// ExtractSagaCtxMiddlewareForGin returns a gin middleware which owns the saga context of each request,
+// see ExtractSagaCtxMiddlewareForHandler.
 func ExtractSagaCtxMiddlewareForGin() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		sagactx.ExtractFromHttpHeaders(c.Request.Header)
-		c.Next()
+		serveWithSagaCtx(c.Request, func(r *http.Request) {
+			c.Request = r
+			c.Next()
+		})
 	}
 }
@@ -5,9 +5,33 @@ import (
 	sagactx "github.com/jeremyxu2010/matrix-saga-go/context"
 )
 
+// ExtractSagaCtxMiddlewareForHttp wraps a http.HandlerFunc, see ExtractSagaCtxMiddlewareForHandler.
 func ExtractSagaCtxMiddlewareForHttp(handler http.HandlerFunc)http.HandlerFunc{
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		sagactx.ExtractFromHttpHeaders(r.Header)
-		handler(w, r)
+		serveWithSagaCtx(r, func(r *http.Request) {
+			handler(w, r)
+		})
 	})
 }
+
+// ExtractSagaCtxMiddlewareForHandler wraps a http.Handler, it can be used as a chi style middleware directly,
+// and as an echo middleware with echo.WrapMiddleware.
+// The saga context extracted from the request headers is set to the goroutine serving the request and attached to the request's context,
+// and it is cleared when the handler returns, even on panic, so that a later request on a keep-alive connection never inherits it.
+func ExtractSagaCtxMiddlewareForHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveWithSagaCtx(r, func(r *http.Request) {
+			next.ServeHTTP(w, r)
+		})
+	})
+}
+
+func serveWithSagaCtx(r *http.Request, serve func(r *http.Request)) {
+	c, ok := sagactx.Extract(sagactx.HttpHeadersCarrier(r.Header))
+	unbind := sagactx.BindSagaAgentContext(c)
+	defer unbind()
+	if ok {
+		r = r.WithContext(sagactx.WithSagaAgentContext(r.Context(), c))
+	}
+	serve(r)
+}
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	sagactx "github.com/jeremyxu2010/matrix-saga-go/context"
+)
+
+// seen is the saga context seen by a handler, in its goroutine and in the context of its request.
+type seen struct {
+	remoteAddr string
+	bound      *sagactx.SagaAgentContext
+	ofRequest  *sagactx.SagaAgentContext
+}
+
+// sagaCtxHandlers returns the handlers wrapped by each middleware extracting the saga context, the handlers call serve.
+func sagaCtxHandlers(serve func(r *http.Request)) map[string]http.Handler {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(ExtractSagaCtxMiddlewareForGin())
+	engine.GET("/", func(c *gin.Context) {
+		serve(c.Request)
+	})
+	return map[string]http.Handler{
+		// a chi style middleware, and an echo middleware by echo.WrapMiddleware
+		"handler": ExtractSagaCtxMiddlewareForHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			serve(r)
+		})),
+		"http": ExtractSagaCtxMiddlewareForHttp(func(w http.ResponseWriter, r *http.Request) {
+			serve(r)
+		}),
+		"gin": engine,
+	}
+}
+
+func TestExtractSagaCtxOnKeepAliveConnection(t *testing.T) {
+	var (
+		lock  sync.Mutex
+		calls []seen
+	)
+	handlers := sagaCtxHandlers(func(r *http.Request) {
+		ofRequest, _ := sagactx.FromContext(r.Context())
+		lock.Lock()
+		calls = append(calls, seen{r.RemoteAddr, boundSagaAgentContext(), ofRequest})
+		lock.Unlock()
+	})
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			calls = nil
+			server := httptest.NewServer(handler)
+			defer server.Close()
+			client := server.Client()
+			sent := newTestSagaAgentContext("l1")
+			for _, c := range []*sagactx.SagaAgentContext{sent, nil} {
+				req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if c != nil {
+					sagactx.Inject(c, sagactx.HttpHeadersCarrier(req.Header))
+				}
+				resp, err := client.Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+			}
+			if len(calls) != 2 {
+				t.Fatalf("handler is called %d times, want 2", len(calls))
+			}
+			if calls[0].remoteAddr != calls[1].remoteAddr {
+				t.Fatalf("requests are sent on the connections %s and %s, want the same", calls[0].remoteAddr, calls[1].remoteAddr)
+			}
+			if !sameSagaAgentContext(calls[0].bound, sent) || !sameSagaAgentContext(calls[0].ofRequest, sent) {
+				t.Errorf("first request got context %v and %v of the request, want %v", calls[0].bound, calls[0].ofRequest, sent)
+			}
+			// the second request on the same connection carries no saga context
+			if calls[1].bound != nil || calls[1].ofRequest != nil {
+				t.Errorf("second request got context %v and %v of the request, want none", calls[1].bound, calls[1].ofRequest)
+			}
+		})
+	}
+}
+
+func TestExtractSagaCtxUnbindsOnPanic(t *testing.T) {
+	handlers := sagaCtxHandlers(func(r *http.Request) {
+		panic("boom")
+	})
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			previous := newTestSagaAgentContext("previous")
+			unbind := sagactx.BindSagaAgentContext(previous)
+			defer unbind()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			sagactx.Inject(newTestSagaAgentContext("l1"), sagactx.HttpHeadersCarrier(req.Header))
+			func() {
+				defer func() {
+					if cause := recover(); cause != "boom" {
+						t.Errorf("got panic %v, want boom", cause)
+					}
+				}()
+				handler.ServeHTTP(httptest.NewRecorder(), req)
+			}()
+			if c := boundSagaAgentContext(); c != previous {
+				t.Errorf("got context %v after the panic, want %v", c, previous)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"context"
+	sagactx "github.com/jeremyxu2010/matrix-saga-go/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// InjectSagaCtxUnaryClientInterceptorForGrpc returns a client interceptor which puts the saga context of the call's context,
+// or of the current goroutine, into the outgoing gRPC metadata with the propagator set by sagactx.SetPropagator.
+// The default X-Pack propagator uses the same keys as the Java omega.
+func InjectSagaCtxUnaryClientInterceptorForGrpc() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(injectIntoGrpcMetadata(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// InjectSagaCtxStreamClientInterceptorForGrpc is the streaming version of InjectSagaCtxUnaryClientInterceptorForGrpc.
+func InjectSagaCtxStreamClientInterceptorForGrpc() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(injectIntoGrpcMetadata(ctx), desc, cc, method, opts...)
+	}
+}
+
+// ExtractSagaCtxUnaryServerInterceptorForGrpc returns a server interceptor which restores the saga context from the incoming gRPC metadata
+// to the goroutine executing the handler and to the handler's context, and clears it after the handler returns, even on panic.
+func ExtractSagaCtxUnaryServerInterceptorForGrpc() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		c := extractFromGrpcMetadata(ctx)
+		unbind := sagactx.BindSagaAgentContext(c)
+		defer unbind()
+		if c != nil {
+			ctx = sagactx.WithSagaAgentContext(ctx, c)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// ExtractSagaCtxStreamServerInterceptorForGrpc is the streaming version of ExtractSagaCtxUnaryServerInterceptorForGrpc.
+// The saga context is only available in the goroutine executing the handler.
+func ExtractSagaCtxStreamServerInterceptorForGrpc() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		unbind := sagactx.BindSagaAgentContext(extractFromGrpcMetadata(ss.Context()))
+		defer unbind()
+		return handler(srv, ss)
+	}
+}
+
+func injectIntoGrpcMetadata(ctx context.Context) context.Context {
+	c, ok := sagactx.FromContext(ctx)
+	if !ok {
+		return ctx
+	}
+	md := metadata.MD{}
+	if outgoing, ok := metadata.FromOutgoingContext(ctx); ok {
+		md = outgoing.Copy()
+	}
+	sagactx.Inject(c, grpcMetadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+func extractFromGrpcMetadata(ctx context.Context) *sagactx.SagaAgentContext {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil
+	}
+	c, ok := sagactx.Extract(grpcMetadataCarrier(md))
+	if !ok {
+		return nil
+	}
+	return c
+}
+
+// grpcMetadataCarrier adapts gRPC metadata to sagactx.TextMapCarrier, gRPC lowercases the keys of metadata.
+type grpcMetadataCarrier metadata.MD
+
+func (c grpcMetadataCarrier) Get(key string) string {
+	values := metadata.MD(c).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (c grpcMetadataCarrier) Set(key string, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c grpcMetadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,206 @@
+package middleware
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	sagactx "github.com/jeremyxu2010/matrix-saga-go/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// newTestSagaAgentContext returns the saga agent context of the local tx id localTxId in the saga g1, with the baggage tenant=t1.
+func newTestSagaAgentContext(localTxId string) *sagactx.SagaAgentContext {
+	c := sagactx.NewSagaAgentContext()
+	c.GlobalTxId = "g1"
+	c.LocalTxId = localTxId
+	c.Baggage = map[string]string{"tenant": "t1"}
+	return c
+}
+
+// boundSagaAgentContext returns the saga agent context of the current goroutine, nil if there is none.
+func boundSagaAgentContext() *sagactx.SagaAgentContext {
+	c, _ := sagactx.GetSagaAgentContext()
+	return c
+}
+
+func sameSagaAgentContext(a *sagactx.SagaAgentContext, b *sagactx.SagaAgentContext) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.GlobalTxId == b.GlobalTxId && a.LocalTxId == b.LocalTxId && reflect.DeepEqual(a.Baggage, b.Baggage)
+}
+
+// invokeUnary calls the unary client interceptor and returns the outgoing metadata of the call.
+func invokeUnary(t *testing.T, ctx context.Context) metadata.MD {
+	var md metadata.MD
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	}
+	if err := InjectSagaCtxUnaryClientInterceptorForGrpc()(ctx, "/orders.Orders/Cancel", nil, nil, nil, invoker); err != nil {
+		t.Fatal(err)
+	}
+	return md
+}
+
+// invokeStream calls the stream client interceptor and returns the outgoing metadata of the stream.
+func invokeStream(t *testing.T, ctx context.Context) metadata.MD {
+	var md metadata.MD
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		md, _ = metadata.FromOutgoingContext(ctx)
+		return nil, nil
+	}
+	if _, err := InjectSagaCtxStreamClientInterceptorForGrpc()(ctx, &grpc.StreamDesc{}, nil, "/orders.Orders/Watch", streamer); err != nil {
+		t.Fatal(err)
+	}
+	return md
+}
+
+func TestInjectSagaCtxIntoGrpcMetadata(t *testing.T) {
+	carried := newTestSagaAgentContext("carried")
+	bound := newTestSagaAgentContext("bound")
+	cases := []struct {
+		name  string
+		ctx   context.Context
+		bound *sagactx.SagaAgentContext
+		// want are the outgoing metadata, the keys used by the Java omega lowercased by gRPC
+		want metadata.MD
+	}{
+		{"no saga context", context.Background(), nil, nil},
+		{"saga context of the goroutine", context.Background(), bound, metadata.MD{
+			"x-pack-global-transaction-id": {"g1"},
+			"x-pack-local-transaction-id":  {"bound"},
+			"x-pack-saga-baggage":          {"tenant=t1"},
+		}},
+		{"saga context of the call", sagactx.WithSagaAgentContext(context.Background(), carried), bound, metadata.MD{
+			"x-pack-global-transaction-id": {"g1"},
+			"x-pack-local-transaction-id":  {"carried"},
+			"x-pack-saga-baggage":          {"tenant=t1"},
+		}},
+		{"other metadata", metadata.AppendToOutgoingContext(context.Background(), "authorization", "token"), bound, metadata.MD{
+			"authorization":                {"token"},
+			"x-pack-global-transaction-id": {"g1"},
+			"x-pack-local-transaction-id":  {"bound"},
+			"x-pack-saga-baggage":          {"tenant=t1"},
+		}},
+	}
+	for _, c := range cases {
+		for name, invoke := range map[string]func(t *testing.T, ctx context.Context) metadata.MD{"unary": invokeUnary, "stream": invokeStream} {
+			t.Run(c.name+"/"+name, func(t *testing.T) {
+				unbind := sagactx.BindSagaAgentContext(c.bound)
+				defer unbind()
+				if md := invoke(t, c.ctx); !reflect.DeepEqual(md, c.want) {
+					t.Errorf("got metadata %v, want %v", md, c.want)
+				}
+			})
+		}
+	}
+}
+
+func TestGrpcInterceptorsRoundTrip(t *testing.T) {
+	sent := newTestSagaAgentContext("l1")
+	unbind := sagactx.BindSagaAgentContext(sent)
+	md := invokeUnary(t, context.Background())
+	unbind()
+
+	var inHandler, ofHandlerCtx *sagactx.SagaAgentContext
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		inHandler = boundSagaAgentContext()
+		ofHandlerCtx, _ = sagactx.FromContext(ctx)
+		return nil, nil
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), md)
+	if _, err := ExtractSagaCtxUnaryServerInterceptorForGrpc()(ctx, nil, &grpc.UnaryServerInfo{}, handler); err != nil {
+		t.Fatal(err)
+	}
+	if !sameSagaAgentContext(inHandler, sent) || !sameSagaAgentContext(ofHandlerCtx, sent) {
+		t.Errorf("got context %v of the handler and %v of its context, want %v", inHandler, ofHandlerCtx, sent)
+	}
+	if c := boundSagaAgentContext(); c != nil {
+		t.Errorf("context %v is left after the handler", c)
+	}
+
+	var inStreamHandler *sagactx.SagaAgentContext
+	streamHandler := func(srv interface{}, stream grpc.ServerStream) error {
+		inStreamHandler = boundSagaAgentContext()
+		return nil
+	}
+	if err := ExtractSagaCtxStreamServerInterceptorForGrpc()(nil, &fakeServerStream{ctx: ctx}, &grpc.StreamServerInfo{}, streamHandler); err != nil {
+		t.Fatal(err)
+	}
+	if !sameSagaAgentContext(inStreamHandler, sent) {
+		t.Errorf("got context %v of the stream handler, want %v", inStreamHandler, sent)
+	}
+	if c := boundSagaAgentContext(); c != nil {
+		t.Errorf("context %v is left after the stream handler", c)
+	}
+}
+
+// fakeServerStream is a grpc.ServerStream of the context ctx.
+type fakeServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *fakeServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestGrpcServerInterceptorsUnbindOnPanic(t *testing.T) {
+	md := metadata.MD{"x-pack-global-transaction-id": {"g1"}, "x-pack-local-transaction-id": {"l1"}}
+	ctx := metadata.NewIncomingContext(context.Background(), md)
+	cases := []struct {
+		name  string
+		serve func()
+	}{
+		{"unary", func() {
+			ExtractSagaCtxUnaryServerInterceptorForGrpc()(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+				panic("boom")
+			})
+		}},
+		{"stream", func() {
+			ExtractSagaCtxStreamServerInterceptorForGrpc()(nil, &fakeServerStream{ctx: ctx}, &grpc.StreamServerInfo{}, func(srv interface{}, stream grpc.ServerStream) error {
+				panic("boom")
+			})
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// the server goroutine may have served a call of another saga before
+			previous := newTestSagaAgentContext("previous")
+			unbind := sagactx.BindSagaAgentContext(previous)
+			defer unbind()
+			func() {
+				defer func() {
+					if cause := recover(); cause != "boom" {
+						t.Errorf("got panic %v, want boom", cause)
+					}
+				}()
+				c.serve()
+			}()
+			if c := boundSagaAgentContext(); c != previous {
+				t.Errorf("got context %v after the panic, want %v", c, previous)
+			}
+		})
+	}
+}
+
+func TestGrpcServerInterceptorWithoutSagaCtx(t *testing.T) {
+	// a call without the saga context does not inherit the context left on the goroutine
+	unbind := sagactx.BindSagaAgentContext(newTestSagaAgentContext("left"))
+	defer unbind()
+	var inHandler *sagactx.SagaAgentContext
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		inHandler = boundSagaAgentContext()
+		return nil, nil
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.MD{"authorization": {"token"}})
+	if _, err := ExtractSagaCtxUnaryServerInterceptorForGrpc()(ctx, nil, &grpc.UnaryServerInfo{}, handler); err != nil {
+		t.Fatal(err)
+	}
+	if inHandler != nil {
+		t.Errorf("handler got context %v", inHandler)
+	}
+}
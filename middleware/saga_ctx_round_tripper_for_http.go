@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	sagactx "github.com/jeremyxu2010/matrix-saga-go/context"
+	"net/http"
+)
+
+type sagaCtxRoundTripper struct {
+	next http.RoundTripper
+}
+
+// NewSagaCtxRoundTripperForHttp wraps next, which defaults to http.DefaultTransport, with a http.RoundTripper
+// that injects the saga context of each outgoing request into its headers with the propagator set by sagactx.SetPropagator.
+// The saga context is taken from the request's context, or from the current goroutine if the request's context carries none.
+func NewSagaCtxRoundTripperForHttp(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &sagaCtxRoundTripper{
+		next: next,
+	}
+}
+
+func (t *sagaCtxRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	c, ok := sagactx.FromContext(req.Context())
+	if !ok {
+		return t.next.RoundTrip(req)
+	}
+	// a RoundTripper must not modify the request, so inject into a copy of it
+	r := req.WithContext(req.Context())
+	r.Header = make(http.Header, len(req.Header)+2)
+	for k, v := range req.Header {
+		r.Header[k] = append([]string(nil), v...)
+	}
+	sagactx.Inject(c, sagactx.HttpHeadersCarrier(r.Header))
+	return t.next.RoundTrip(r)
+}
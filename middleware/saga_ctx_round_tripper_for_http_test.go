@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	sagactx "github.com/jeremyxu2010/matrix-saga-go/context"
+)
+
+// roundTripperFunc adapts a function to http.RoundTripper.
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestSagaCtxRoundTripperInjectsHeaders(t *testing.T) {
+	carried := newTestSagaAgentContext("carried")
+	bound := newTestSagaAgentContext("bound")
+	cases := []struct {
+		name    string
+		carried *sagactx.SagaAgentContext
+		bound   *sagactx.SagaAgentContext
+		// want are the headers sent, named as by the Java omega
+		want http.Header
+	}{
+		{"no saga context", nil, nil, http.Header{"Accept": {"application/json"}}},
+		{"saga context of the goroutine", nil, bound, http.Header{
+			"Accept":                       {"application/json"},
+			"X-Pack-Global-Transaction-Id": {"g1"},
+			"X-Pack-Local-Transaction-Id":  {"bound"},
+			"X-Pack-Saga-Baggage":          {"tenant=t1"},
+		}},
+		{"saga context of the request", carried, bound, http.Header{
+			"Accept":                       {"application/json"},
+			"X-Pack-Global-Transaction-Id": {"g1"},
+			"X-Pack-Local-Transaction-Id":  {"carried"},
+			"X-Pack-Saga-Baggage":          {"tenant=t1"},
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			unbind := sagactx.BindSagaAgentContext(c.bound)
+			defer unbind()
+			var sent http.Header
+			rt := NewSagaCtxRoundTripperForHttp(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				sent = req.Header
+				return &http.Response{StatusCode: http.StatusOK}, nil
+			}))
+			req := httptest.NewRequest(http.MethodGet, "http://orders/cancel", nil)
+			req.Header.Set("Accept", "application/json")
+			if c.carried != nil {
+				req = req.WithContext(sagactx.WithSagaAgentContext(req.Context(), c.carried))
+			}
+			if _, err := rt.RoundTrip(req); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(sent, c.want) {
+				t.Errorf("got headers %v, want %v", sent, c.want)
+			}
+			// a RoundTripper must not modify the request
+			if want := (http.Header{"Accept": {"application/json"}}); !reflect.DeepEqual(req.Header, want) {
+				t.Errorf("request headers are changed to %v", req.Header)
+			}
+		})
+	}
+}
+
+func TestSagaCtxRoundTripperRoundTrip(t *testing.T) {
+	var inHandler, ofRequest *sagactx.SagaAgentContext
+	server := httptest.NewServer(ExtractSagaCtxMiddlewareForHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inHandler = boundSagaAgentContext()
+		ofRequest, _ = sagactx.FromContext(r.Context())
+	})))
+	defer server.Close()
+	client := &http.Client{Transport: NewSagaCtxRoundTripperForHttp(nil)}
+
+	sent := newTestSagaAgentContext("l1")
+	unbind := sagactx.BindSagaAgentContext(sent)
+	defer unbind()
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !sameSagaAgentContext(inHandler, sent) || !sameSagaAgentContext(ofRequest, sent) {
+		t.Errorf("got context %v of the handler and %v of the request, want %v", inHandler, ofRequest, sent)
+	}
+}
@@ -0,0 +1,178 @@
+package saga
+
+import (
+	"errors"
+	"github.com/jeremyxu2010/matrix-saga-go/config"
+	sagactx "github.com/jeremyxu2010/matrix-saga-go/context"
+	"github.com/jeremyxu2010/matrix-saga-go/discovery"
+	"github.com/jeremyxu2010/matrix-saga-go/log"
+	"github.com/jeremyxu2010/matrix-saga-go/serializer"
+	"time"
+)
+
+// Option configures the saga agent initialized by InitSagaAgentWithOptions.
+type Option func(o *agentOptions)
+
+type agentOptions struct {
+	agentConfig *config.AgentConfig
+	serializer  serializer.Serializer
+	logger      log.Logger
+	idGenerator sagactx.IdGenerator
+	blobStore   serializer.BlobStore
+
+	instanceIdSources []config.InstanceIdSource
+
+	// err is the error of an invalid option, which is returned by InitSagaAgentWithOptions
+	err error
+}
+
+// WithConfig starts from the agent configuration c, such as the one loaded by config.LoadAgentConfig,
+// the options after it override its settings. InitSagaAgentWithOptions returns an error if c is nil.
+func WithConfig(c *config.AgentConfig) Option {
+	return func(o *agentOptions) {
+		if c == nil {
+			o.err = errors.New("agent config is nil")
+			return
+		}
+		copied := *c
+		o.agentConfig = &copied
+	}
+}
+
+// WithServiceName sets the name of the service.
+func WithServiceName(serviceName string) Option {
+	return func(o *agentOptions) {
+		o.agentConfig.ServiceName = serviceName
+	}
+}
+
+// WithInstanceId sets the id of the instance of the service, which is derived by the instance id sources by default.
+func WithInstanceId(instanceId string) Option {
+	return func(o *agentOptions) {
+		o.agentConfig.InstanceId = instanceId
+	}
+}
+
+// WithInstanceIdSources derives the instance id from the first one of sources that works,
+// defaults to config.DefaultInstanceIdSources. It is ignored if the instance id is set.
+func WithInstanceIdSources(sources ...config.InstanceIdSource) Option {
+	return func(o *agentOptions) {
+		o.instanceIdSources = sources
+	}
+}
+
+// WithCoordinators sets the addresses of the alpha servers, or a single resolver address like dns://alpha-headless:8080,
+// see discovery.ParseResolver.
+func WithCoordinators(addresses ...string) Option {
+	return func(o *agentOptions) {
+		o.agentConfig.Coordinators = addresses
+	}
+}
+
+// WithCoordinatorResolver resolves the addresses of the alpha servers with r, it overrides WithCoordinators.
+func WithCoordinatorResolver(r discovery.Resolver) Option {
+	return func(o *agentOptions) {
+		o.agentConfig.Resolver = r
+	}
+}
+
+// WithResolveInterval sets the interval of resolving the addresses of the alpha servers, defaults to constants.COORDINATOR_RESOLVE_INTERVAL.
+func WithResolveInterval(interval time.Duration) Option {
+	return func(o *agentOptions) {
+		o.agentConfig.ResolveInterval = interval
+	}
+}
+
+// WithTimeout sets the timeout of the requests to the coordinator, defaults to constants.GRPC_COMMUNICATE_TIMEOUT.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *agentOptions) {
+		o.agentConfig.Timeout = timeout
+	}
+}
+
+// WithReconnectDelay sets the delay before reconnecting to the coordinator, defaults to constants.GRPC_RECONNECT_DELAY.
+func WithReconnectDelay(delay time.Duration) Option {
+	return func(o *agentOptions) {
+		o.agentConfig.ReconnectDelay = delay
+	}
+}
+
+// WithPayloadsMaxLength sets the max length of the payloads and of the error message sent to the coordinator,
+// defaults to constants.PAYLOADS_MAX_LENGTH.
+func WithPayloadsMaxLength(length int) Option {
+	return func(o *agentOptions) {
+		o.agentConfig.PayloadsMaxLength = length
+	}
+}
+
+// WithCompressThreshold sets the length above which the payloads are compressed, defaults to constants.PAYLOADS_COMPRESS_THRESHOLD,
+// 0 disables the compression. The payloads of serializer.JsonSerializer and of the encrypting serializers are never compressed.
+func WithCompressThreshold(threshold int) Option {
+	return func(o *agentOptions) {
+		o.agentConfig.CompressThreshold = threshold
+	}
+}
+
+// WithRedactPatterns sets the regular expressions of the secrets masked in the logs, the abort messages and the readable payloads,
+// see config.AgentConfig.RedactPatterns.
+func WithRedactPatterns(patterns ...string) Option {
+	return func(o *agentOptions) {
+		o.agentConfig.RedactPatterns = patterns
+	}
+}
+
+// WithBlobStore keeps the payloads longer than the max length in blobs, which overrides the offload directory of the configuration.
+func WithBlobStore(blobs serializer.BlobStore) Option {
+	return func(o *agentOptions) {
+		o.blobStore = blobs
+	}
+}
+
+// WithSerializer sets the serializer of the arguments of the compensable methods, defaults to the gob serializer.
+func WithSerializer(s serializer.Serializer) Option {
+	return func(o *agentOptions) {
+		o.serializer = s
+	}
+}
+
+// WithLogger sets the logger of the agent, defaults to a logger discarding everything.
+func WithLogger(l log.Logger) Option {
+	return func(o *agentOptions) {
+		o.logger = l
+	}
+}
+
+// WithIdGenerator sets the generator of the tx ids, see sagactx.SetIdGenerator.
+func WithIdGenerator(g sagactx.IdGenerator) Option {
+	return func(o *agentOptions) {
+		o.idGenerator = g
+	}
+}
+
+func newAgentOptions(opts []Option) *agentOptions {
+	o := &agentOptions{
+		agentConfig: config.NewAgentConfig(),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// blobs returns the blob store set by WithBlobStore, or the file blob store in the offload directory if it is configured.
+func (o *agentOptions) blobs() (serializer.BlobStore, error) {
+	if o.blobStore != nil || len(o.agentConfig.OffloadDir) == 0 {
+		return o.blobStore, nil
+	}
+	return serializer.NewFileBlobStore(o.agentConfig.OffloadDir, o.agentConfig.OffloadTTL)
+}
+
+func (o *agentOptions) serviceConfig() (*config.ServiceConfig, error) {
+	if len(o.agentConfig.InstanceId) > 0 {
+		return &config.ServiceConfig{
+			ServiceName: o.agentConfig.ServiceName,
+			InstanceId:  o.agentConfig.InstanceId,
+		}, nil
+	}
+	return config.NewServiceConfig(o.agentConfig.ServiceName, o.instanceIdSources...)
+}
@@ -0,0 +1,67 @@
+package saga
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jeremyxu2010/matrix-saga-go/config"
+)
+
+func TestInitSagaAgentWithOptionsRejectsInvalidOptions(t *testing.T) {
+	cases := []struct {
+		name string
+		opts []Option
+	}{
+		{"nil config", []Option{WithConfig(nil), WithServiceName("saga-test")}},
+		{"invalid timeout", []Option{WithServiceName("saga-test"), WithTimeout(0)}},
+		{"no instance id", []Option{WithServiceName("saga-test"), WithCoordinators("127.0.0.1:8080"),
+			WithInstanceIdSources(config.StaticInstanceIdSource(""))}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := InitSagaAgentWithOptions(c.opts...); err == nil {
+				t.Fatal("options are accepted")
+			}
+			if transportContractor != nil {
+				t.Fatal("saga agent is initialized")
+			}
+		})
+	}
+}
+
+func TestInitSagaAgentKeepsResources(t *testing.T) {
+	oldLogger, oldServiceConfig := logger, serviceConfig
+	defer func() {
+		transportContractor, serviceConfig, logger = nil, oldServiceConfig, oldLogger
+		agentConfig.Store(config.NewAgentConfig())
+	}()
+	dir, err := ioutil.TempDir("", "saga-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	opts := func(offloadDir string) *agentOptions {
+		c := config.NewAgentConfig()
+		c.OffloadDir = offloadDir
+		return newAgentOptions([]Option{WithConfig(c), WithServiceName("saga-test"), WithInstanceId("saga-test-1"),
+			WithCoordinators("127.0.0.1:8080")})
+	}
+	if err := initSagaAgent(opts(filepath.Join(dir, "first"))); err != nil {
+		t.Fatal(err)
+	}
+	initialized := transportContractor
+	if _, err := os.Stat(filepath.Join(dir, "first")); err != nil {
+		t.Fatalf("offload directory is not created, %v", err)
+	}
+	if err := initSagaAgent(opts(filepath.Join(dir, "second"))); err != nil {
+		t.Fatal(err)
+	}
+	if transportContractor != initialized {
+		t.Fatal("transport contractor is created again")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "second")); !os.IsNotExist(err) {
+		t.Fatalf("offload directory is created again, %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package saga
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jeremyxu2010/matrix-saga-go/utils"
+	"reflect"
+	"sync"
+)
+
+type participant struct {
+	receiver      interface{}
+	compensations map[string]string
+}
+
+var (
+	participantsLock sync.Mutex
+	participants     = make(map[reflect.Type]*participant)
+)
+
+// RegisterParticipant registers a service instance whose methods take part in sagas.
+// The argument compensations maps the name of each compensable method of the participant to the name of its compensation method.
+// Compensations are invoked on the registered participant, so the receiver itself is never serialized.
+// Only one instance of a type can be registered as participant.
+func RegisterParticipant(participantInstance interface{}, compensations map[string]string) error {
+	if participantInstance == nil {
+		return errors.New("participant is nil")
+	}
+	receiver := reflect.ValueOf(participantInstance)
+	if !receiver.Type().Comparable() {
+		return errors.New(fmt.Sprintf("participant %v is not comparable, use a pointer instead", receiver.Type()))
+	}
+	for method, compensationMethod := range compensations {
+		methodFunc := receiver.MethodByName(method)
+		if !methodFunc.IsValid() {
+			return errors.New(fmt.Sprintf("participant %v has no exported method %s", receiver.Type(), method))
+		}
+		compensationFunc := receiver.MethodByName(compensationMethod)
+		if !compensationFunc.IsValid() {
+			return errors.New(fmt.Sprintf("participant %v has no exported method %s", receiver.Type(), compensationMethod))
+		}
+		if err := checkCompensationType(methodFunc.Type(), compensationFunc.Type()); err != nil {
+			return errors.New(fmt.Sprintf("compensation method %s of %v mismatches method %s, %v", compensationMethod, receiver.Type(), method, err))
+		}
+	}
+
+	participantsLock.Lock()
+	defer participantsLock.Unlock()
+	if p, ok := participants[receiver.Type()]; ok && p.receiver != participantInstance {
+		return errors.New(fmt.Sprintf("another instance of %v has already been registered as participant", receiver.Type()))
+	}
+	p := &participant{
+		receiver:      participantInstance,
+		compensations: make(map[string]string, len(compensations)),
+	}
+	for method, compensationMethod := range compensations {
+		p.compensations[method] = compensationMethod
+		compensationProcessor.RegisterCompensationFunc(utils.GetMethodName(participantInstance, compensationMethod), receiver.MethodByName(compensationMethod).Interface())
+	}
+	participants[receiver.Type()] = p
+	return nil
+}
+
+// DecorateParticipantMethod decorates a compensable method of a participant registered by RegisterParticipant.
+// The argument compensablePtr is a pointer to a function variable with the same signature as the method.
+func DecorateParticipantMethod(compensablePtr interface{}, participantInstance interface{}, method string, timeout int, opts ...CompensableOption) error {
+	if participantInstance == nil {
+		return errors.New("participant is nil")
+	}
+	receiver := reflect.ValueOf(participantInstance)
+
+	participantsLock.Lock()
+	p, ok := participants[receiver.Type()]
+	participantsLock.Unlock()
+	if !ok || p.receiver != participantInstance {
+		return errors.New(fmt.Sprintf("participant %v is not registered", receiver.Type()))
+	}
+	compensationMethod, ok := p.compensations[method]
+	if !ok {
+		return errors.New(fmt.Sprintf("method %s of participant %v has no registered compensation method", method, receiver.Type()))
+	}
+	target := receiver.MethodByName(method).Interface()
+	return decorateCompensableMethod(compensablePtr, target, utils.GetMethodName(participantInstance, compensationMethod), timeout, opts)
+}
+
+func checkCompensationType(targetType reflect.Type, compensationType reflect.Type) error {
+	if targetType.NumIn() != compensationType.NumIn() || targetType.IsVariadic() != compensationType.IsVariadic() {
+		return errors.New("input para number mismatch")
+	}
+	for i := 0; i < targetType.NumIn(); i++ {
+		if targetType.In(i) != compensationType.In(i) {
+			return errors.New(fmt.Sprintf("input para %d type mismatch, %v != %v", i, targetType.In(i), compensationType.In(i)))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package saga
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jeremyxu2010/matrix-saga-go/config"
+	"github.com/jeremyxu2010/matrix-saga-go/utils"
+)
+
+// orderParticipant records the orders it reserves and cancels.
+type orderParticipant struct {
+	name      string
+	reserved  []string
+	cancelled []string
+}
+
+func (p *orderParticipant) Reserve(orderNo string) error {
+	p.reserved = append(p.reserved, orderNo)
+	return nil
+}
+
+func (p *orderParticipant) CancelReserve(orderNo string) error {
+	p.cancelled = append(p.cancelled, orderNo)
+	return nil
+}
+
+func (p *orderParticipant) Ship(orderNo string, quantity int) error {
+	return nil
+}
+
+// The types below are registered by a single test each, since the participants stay registered.
+
+type duplicateParticipant struct {
+	orderParticipant
+}
+
+type unregisteredParticipant struct {
+	orderParticipant
+}
+
+type compensatedParticipant struct {
+	orderParticipant
+}
+
+type valueParticipant struct {
+	items []string
+}
+
+func (p valueParticipant) Reserve(orderNo string) error {
+	return nil
+}
+
+func (p valueParticipant) CancelReserve(orderNo string) error {
+	return nil
+}
+
+func TestRegisterParticipantRejectsInvalidParticipants(t *testing.T) {
+	cases := []struct {
+		name          string
+		participant   interface{}
+		compensations map[string]string
+		err           string
+	}{
+		{"nil", nil, nil, "participant is nil"},
+		{"not comparable", valueParticipant{}, map[string]string{"Reserve": "CancelReserve"}, "is not comparable, use a pointer instead"},
+		{"unknown method", &orderParticipant{}, map[string]string{"Reserve2": "CancelReserve"}, "has no exported method Reserve2"},
+		{"unknown compensation method", &orderParticipant{}, map[string]string{"Reserve": "Cancel"}, "has no exported method Cancel"},
+		{"mismatched compensation method", &orderParticipant{}, map[string]string{"Ship": "CancelReserve"}, "mismatches method Ship, input para number mismatch"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := RegisterParticipant(c.participant, c.compensations)
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("got error %v, want %q", err, c.err)
+			}
+		})
+	}
+}
+
+func TestRegisterParticipantTwice(t *testing.T) {
+	compensations := map[string]string{"Reserve": "CancelReserve"}
+	registered := &duplicateParticipant{}
+	if err := RegisterParticipant(registered, compensations); err != nil {
+		t.Fatal(err)
+	}
+	// registering the same instance again is harmless
+	if err := RegisterParticipant(registered, compensations); err != nil {
+		t.Errorf("same participant is rejected, %v", err)
+	}
+	err := RegisterParticipant(&duplicateParticipant{}, compensations)
+	if err == nil || !strings.Contains(err.Error(), "another instance of *saga.duplicateParticipant has already been registered") {
+		t.Errorf("got error %v for another instance of the same type", err)
+	}
+}
+
+func TestDecorateParticipantMethodRejectsInvalidMethods(t *testing.T) {
+	registered := &orderParticipant{name: "registered"}
+	if err := RegisterParticipant(registered, map[string]string{"Reserve": "CancelReserve"}); err != nil {
+		t.Fatal(err)
+	}
+	var reserve func(orderNo string) error
+	cases := []struct {
+		name        string
+		participant interface{}
+		method      string
+		err         string
+	}{
+		{"nil", nil, "Reserve", "participant is nil"},
+		{"not registered", &unregisteredParticipant{}, "Reserve", "participant *saga.unregisteredParticipant is not registered"},
+		{"another instance", &orderParticipant{}, "Reserve", "participant *saga.orderParticipant is not registered"},
+		{"unknown method", registered, "Reserve2", "method Reserve2 of participant *saga.orderParticipant has no registered compensation method"},
+		{"method without compensation", registered, "Ship", "method Ship of participant *saga.orderParticipant has no registered compensation method"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := DecorateParticipantMethod(&reserve, c.participant, c.method, 0)
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("got error %v, want %q", err, c.err)
+			}
+		})
+	}
+}
+
+func TestParticipantCompensationResolvesToTheReceiver(t *testing.T) {
+	const globalTxId = "saga-test-global-tx"
+	agentConfig.Store(config.NewAgentConfig())
+	stub, restore := useStubTransport()
+	defer restore()
+
+	registered := &compensatedParticipant{orderParticipant{name: "registered"}}
+	if err := RegisterParticipant(registered, map[string]string{"Reserve": "CancelReserve"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var reserve func(orderNo string) error
+	if err := DecorateParticipantMethod(&reserve, registered, "Reserve", 0); err != nil {
+		t.Fatal(err)
+	}
+	unbind := ResumeSaga(globalTxId)
+	err := reserve("order-1")
+	unbind()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(registered.reserved, []string{"order-1"}) {
+		t.Errorf("registered participant reserved %v", registered.reserved)
+	}
+	compensationMethod := utils.GetMethodName(registered, "CancelReserve")
+	events := stub.sent()
+	if len(events) == 0 || events[0].kind != "TxStartedEvent" || events[0].compensationMethod != compensationMethod {
+		t.Fatalf("got events %v, want a TxStartedEvent of %s", events, compensationMethod)
+	}
+
+	// the coordinator calls the compensation method on the registered participant, never on another instance
+	other := &compensatedParticipant{orderParticipant{name: "other"}}
+	payloads, err := compensationProcessor.EncodeArgs(compensationMethod, globalTxId, events[0].localTxId,
+		[]reflect.Value{reflect.ValueOf("order-1")}, nil, 0, 10240)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := compensationProcessor.ExecuteCompensate(globalTxId, events[0].localTxId, compensationMethod, payloads, 10240); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(registered.cancelled, []string{"order-1"}) || len(other.cancelled) > 0 {
+		t.Errorf("registered participant cancelled %v, another one %v", registered.cancelled, other.cancelled)
+	}
+}
@@ -1,6 +1,11 @@
 package processor
 
 import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
 	"reflect"
 	"github.com/jeremyxu2010/matrix-saga-go/log"
 	"fmt"
@@ -12,52 +17,350 @@ type CompensationProcessor struct {
 	funcs  map[string]interface{}
 	logger log.Logger
 	s      serializer.Serializer
+	// serializers are the serializers of the compensation functions using another serializer than s
+	serializers map[string]serializer.Serializer
+	// schemaVersions are the current versions of the arguments of the compensation functions, 1 by default
+	schemaVersions map[string]int
+	// upgrades are the upgrades of the payloads of the compensation functions by the versions they upgrade from
+	upgrades map[string]map[int]PayloadsUpgrade
+	// blobs keep the payloads longer than the max length, see EncodeArgs
+	blobs serializer.BlobStore
 }
 
+const payloadsCompressionGzip = "gzip"
+
+// maxCompressionRatio bounds the length of the decompressed payloads to maxCompressionRatio times the max length,
+// or the length of the compressed payloads if they are offloaded, which rejects the payloads decompressing to excessive lengths.
+const maxCompressionRatio = 100
+
+// PayloadsUpgrade migrates the serialized arguments of a compensation function from a schema version to the next one,
+// such as the payloads of the sagas started before a deploy which changed the arguments.
+// It gets the opened payloads of the serializers wrapping another one, see serializer.OpeningSerializer,
+// such as the decrypted payloads of serializer.EncryptingSerializer.
+type PayloadsUpgrade func(payloads []byte) ([]byte, error)
+
 func NewCompensationProcessor(s serializer.Serializer, logger log.Logger)*CompensationProcessor {
+	if logger == nil {
+		logger = log.NewNoopLogger()
+	}
 	return &CompensationProcessor{
 		funcs: make(map[string]interface{}, 0),
 		logger: logger,
 		s: s,
+		serializers: make(map[string]serializer.Serializer, 0),
+		schemaVersions: make(map[string]int, 0),
+		upgrades: make(map[string]map[int]PayloadsUpgrade, 0),
 	}
 }
 
+// SetSerializer sets the serializer of the arguments of the compensation functions.
+func (p *CompensationProcessor) SetSerializer(s serializer.Serializer) {
+	p.s = s
+}
+
+// SetBlobStore sets the blob store keeping the payloads longer than the max length.
+func (p *CompensationProcessor) SetBlobStore(blobs serializer.BlobStore) {
+	p.blobs = blobs
+}
+
+// SetLogger sets the logger of the processor.
+func (p *CompensationProcessor) SetLogger(logger log.Logger) {
+	p.logger = logger
+}
+
 func (p *CompensationProcessor)RegisterCompensationFunc(fnName string, fn interface{}){
 	p.funcs[fnName] = reflect.ValueOf(fn)
 }
 
-func (p *CompensationProcessor) ExecuteCompensate(globalTxId string, localTxId string, compensationMethod string, payloads []byte) {
-	args, err := p.s.Unserialize(payloads)
-	if err != nil {
-		p.logger.LogError(fmt.Sprintf("%v", err))
-		return
-	}
-	if v, ok := p.funcs[compensationMethod]; ok {
-		if targetFunc, ok := v.(reflect.Value); ok {
-			sagaAgentCtx, _ := context.GetSagaAgentContext()
-			if sagaAgentCtx == nil {
-				sagaAgentCtx = context.NewSagaAgentContext()
-				sagaAgentCtx.GlobalTxId = globalTxId
-				sagaAgentCtx.LocalTxId = localTxId
-				context.SetSagaAgentContext(sagaAgentCtx)
-				defer func() {
-					context.ClearSagaAgentContext()
-				}()
-			} else {
-				oldGlobalTxId := sagaAgentCtx.GlobalTxId
-				oldLocalTxId := sagaAgentCtx.LocalTxId
-				defer func() {
-					sagaAgentCtx.GlobalTxId = oldGlobalTxId
-					sagaAgentCtx.LocalTxId = oldLocalTxId
-				}()
-				sagaAgentCtx.GlobalTxId = globalTxId
-				sagaAgentCtx.LocalTxId = localTxId
-			}
-			if targetFunc.Type().IsVariadic() {
-				targetFunc.CallSlice(args)
-			} else {
-				targetFunc.Call(args)
-			}
+// RegisterCompensationSerializer sets the serializer of the arguments of the compensation function fnName,
+// which overrides the serializer of the processor.
+func (p *CompensationProcessor) RegisterCompensationSerializer(fnName string, s serializer.Serializer) {
+	p.serializers[fnName] = s
+}
+
+// SetSchemaVersion sets the current version of the arguments of the compensation function fnName, which is recorded in the payloads.
+func (p *CompensationProcessor) SetSchemaVersion(fnName string, version int) {
+	p.schemaVersions[fnName] = version
+}
+
+// RegisterPayloadsUpgrade registers the upgrade of the payloads of the compensation function fnName from the schema version fromVersion
+// to fromVersion + 1. The payloads of the older versions are upgraded version by version before they are decoded.
+func (p *CompensationProcessor) RegisterPayloadsUpgrade(fnName string, fromVersion int, upgrade PayloadsUpgrade) {
+	if _, ok := p.upgrades[fnName]; !ok {
+		p.upgrades[fnName] = make(map[int]PayloadsUpgrade)
+	}
+	p.upgrades[fnName][fromVersion] = upgrade
+}
+
+func (p *CompensationProcessor) schemaVersion(fnName string) int {
+	if version, ok := p.schemaVersions[fnName]; ok {
+		return version
+	}
+	return 1
+}
+
+// EncodeArgs serializes the arguments of the compensation function compensationMethod of the transaction localTxId
+// in the saga globalTxId into the payloads, and wraps them in an envelope recording the serializer, the schema version
+// and the baggage unless the serializer is raw. The payloads are bound to the transaction and to the envelope
+// if the serializer is a serializer.BindingSerializer, see serializer.Envelope.Binding.
+// The serialized arguments longer than compressThreshold are compressed, unless compressThreshold is 0 or the payloads are bound,
+// so the payloads of serializer.JsonSerializer stay readable in the coordinator whatever their length.
+// The payloads longer than maxLength are kept in the blob store and replaced by their reference,
+// or sent as they are with a warning if there is no blob store or the payloads are raw.
+func (p *CompensationProcessor) EncodeArgs(compensationMethod string, globalTxId string, localTxId string, args []reflect.Value,
+	baggage map[string]string, compressThreshold int, maxLength int) ([]byte, error) {
+	s := p.Serializer(compensationMethod)
+	// the envelope of the raw payloads is not written, it is empty when they are decoded
+	e := &serializer.Envelope{}
+	if !serializer.IsRaw(s) {
+		e = &serializer.Envelope{
+			SerializerId:  serializer.SerializerId(s),
+			SchemaVersion: p.schemaVersion(compensationMethod),
+			Compensation:  compensationMethod,
+			Baggage:       baggage,
+		}
+	}
+	binding, err := e.Binding(compensationMethod, globalTxId, localTxId)
+	if err != nil {
+		return nil, err
+	}
+	b, err := serializer.SerializeBound(s, args, binding)
+	if err != nil {
+		return nil, err
+	}
+	if serializer.IsRaw(s) {
+		if len(baggage) > 0 {
+			p.logger.LogWarn(fmt.Sprintf("Baggage of compensation method %s is dropped, its payloads are raw", compensationMethod))
+		}
+		if len(b) > maxLength {
+			p.logger.LogWarn(fmt.Sprintf("Payloads of compensation method %s are %d bytes, longer than the max length %d, they are raw and can not be offloaded", compensationMethod, len(b), maxLength))
+		}
+		return b, nil
+	}
+	// the payloads bound to their envelope are not compressed, such as the encrypted payloads, which do not compress,
+	// and the JSON payloads, which are kept readable
+	_, bound := s.(serializer.BindingSerializer)
+	if compressThreshold > 0 && len(b) > compressThreshold && !bound {
+		compressed, err := gzipPayloads(b)
+		if err != nil {
+			return nil, err
+		}
+		// the payloads which would exceed the bound of the decompressed payloads are not compressed
+		if len(compressed) < len(b) && len(b) <= decompressedMaxLength(len(compressed), maxLength) {
+			b = compressed
+			e.Compression = payloadsCompressionGzip
+		}
+	}
+	payloads, err := serializer.WrapPayloads(b, e)
+	if err != nil || len(payloads) <= maxLength {
+		return payloads, err
+	}
+	if p.blobs == nil {
+		p.logger.LogWarn(fmt.Sprintf("Payloads of compensation method %s are %d bytes, longer than the max length %d, configure a blob store to offload them", compensationMethod, len(payloads), maxLength))
+		return payloads, nil
+	}
+	ref, err := p.blobs.Put(payloads)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("offload payloads of compensation method %s failed, %v", compensationMethod, err))
+	}
+	p.logger.LogDebug(fmt.Sprintf("Offloaded payloads of compensation method %s of %d bytes to blob %s", compensationMethod, len(payloads), ref))
+	return serializer.WrapPayloads(nil, &serializer.Envelope{
+		Compensation: compensationMethod,
+		Blob:         ref,
+	})
+}
+
+// decodeArgs decodes the arguments of the compensation function compensationMethod of the transaction localTxId in the saga globalTxId
+// from payloads produced by EncodeArgs, the payloads of the older schema versions are opened and upgraded first.
+// The bound payloads are rejected if their envelope is changed, such as their baggage or schema version.
+// The compressed payloads are rejected if they decompress to more than maxCompressionRatio times maxLength.
+func (p *CompensationProcessor) decodeArgs(compensationMethod string, globalTxId string, localTxId string, paramTypes []reflect.Type,
+	payloads []byte, maxLength int) ([]reflect.Value, map[string]string, error) {
+	payloads, e, err := serializer.UnwrapPayloads(payloads)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(e.Blob) > 0 {
+		if payloads, e, err = p.loadBlob(e.Blob); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(e.Compensation) > 0 && e.Compensation != compensationMethod {
+		return nil, nil, errors.New(fmt.Sprintf("payloads of compensation method %s can not be used by %s", e.Compensation, compensationMethod))
+	}
+	binding, err := e.Binding(compensationMethod, globalTxId, localTxId)
+	if err != nil {
+		return nil, nil, err
+	}
+	s := p.Serializer(compensationMethod)
+	if len(e.SerializerId) > 0 && e.SerializerId != serializer.SerializerId(s) {
+		recorded, ok := serializer.LookupSerializer(e.SerializerId)
+		if !ok {
+			return nil, nil, errors.New(fmt.Sprintf("serializer %s is not registered, register it with serializer.RegisterSerializer", e.SerializerId))
+		}
+		if serializer.Authenticates(s) && !serializer.Authenticates(recorded) {
+			return nil, nil, errors.New(fmt.Sprintf("payloads of serializer %s are not authenticated, serializer %s is required", e.SerializerId, serializer.SerializerId(s)))
+		}
+		s = recorded
+	}
+	version := e.SchemaVersion
+	if version == 0 {
+		// the payloads without the schema version were produced by the versions of the saga agent before the envelope
+		version = 1
+	}
+	current := p.schemaVersion(compensationMethod)
+	if version > current {
+		return nil, nil, errors.New(fmt.Sprintf("schema version %d of the payloads is newer than the current version %d", version, current))
+	}
+	if len(e.Compression) > 0 {
+		// the JSON payloads compressed by the earlier versions of the saga agent are still decoded
+		if serializer.Authenticates(s) {
+			return nil, nil, errors.New(fmt.Sprintf("payloads of serializer %s are authenticated with their envelope, they are never compressed", serializer.SerializerId(s)))
+		}
+		if e.Compression != payloadsCompressionGzip {
+			return nil, nil, errors.New(fmt.Sprintf("unsupported payloads compression %s", e.Compression))
+		}
+		if payloads, err = gunzipPayloads(payloads, decompressedMaxLength(len(payloads), maxLength)); err != nil {
+			return nil, nil, err
+		}
+	}
+	if version < current {
+		// the upgrades run on the decrypted payloads, which are already checked against the binding
+		if payloads, s, err = serializer.Open(s, payloads, binding); err != nil {
+			return nil, nil, err
+		}
+	}
+	for ; version < current; version++ {
+		upgrade, ok := p.upgrades[compensationMethod][version]
+		if !ok {
+			return nil, nil, errors.New(fmt.Sprintf("no upgrade of the payloads from schema version %d", version))
+		}
+		if payloads, err = upgrade(payloads); err != nil {
+			return nil, nil, errors.New(fmt.Sprintf("upgrade the payloads from schema version %d failed, %v", version, err))
+		}
+	}
+	args, err := serializer.UnserializeBound(s, payloads, paramTypes, binding)
+	if err != nil {
+		return nil, nil, err
+	}
+	return args, e.Baggage, nil
+}
+
+// loadBlob returns the payloads offloaded to the blob ref and their envelope.
+func (p *CompensationProcessor) loadBlob(ref string) ([]byte, *serializer.Envelope, error) {
+	if p.blobs == nil {
+		return nil, nil, errors.New(fmt.Sprintf("payloads are offloaded to blob %s, but there is no blob store", ref))
+	}
+	b, err := p.blobs.Get(ref)
+	if err != nil {
+		return nil, nil, errors.New(fmt.Sprintf("load payloads from blob %s failed, %v", ref, err))
+	}
+	payloads, e, err := serializer.UnwrapPayloads(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(e.Blob) > 0 {
+		return nil, nil, errors.New(fmt.Sprintf("blob %s refers to another blob", ref))
+	}
+	return payloads, e, nil
+}
+
+// Serializer returns the serializer of the arguments of the compensation function fnName.
+func (p *CompensationProcessor) Serializer(fnName string) serializer.Serializer {
+	if s, ok := p.serializers[fnName]; ok {
+		return s
+	}
+	return p.s
+}
+
+// ExecuteCompensate calls the compensation function compensationMethod with the arguments decoded from payloads
+// into its parameter types, and returns an error if the arguments can not be decoded or the compensation fails.
+// maxLength is the max length of the payloads, which bounds the length of the decompressed payloads.
+func (p *CompensationProcessor) ExecuteCompensate(globalTxId string, localTxId string, compensationMethod string, payloads []byte, maxLength int) (err error) {
+	v, ok := p.funcs[compensationMethod]
+	if !ok {
+		return errors.New(fmt.Sprintf("compensation method %s is not registered", compensationMethod))
+	}
+	targetFunc := v.(reflect.Value)
+	args, baggage, err := p.decodeArgs(compensationMethod, globalTxId, localTxId, serializer.ParamTypes(targetFunc.Type()), payloads, maxLength)
+	if err != nil {
+		return errors.New(fmt.Sprintf("decode args of compensation method %s failed, %v", compensationMethod, err))
+	}
+	sagaAgentCtx, _ := context.GetSagaAgentContext()
+	if sagaAgentCtx == nil {
+		sagaAgentCtx = context.NewSagaAgentContext()
+		sagaAgentCtx.GlobalTxId = globalTxId
+		sagaAgentCtx.LocalTxId = localTxId
+		sagaAgentCtx.Baggage = baggage
+		context.SetSagaAgentContext(sagaAgentCtx)
+		defer func() {
+			context.ClearSagaAgentContext()
+		}()
+	} else {
+		oldGlobalTxId := sagaAgentCtx.GlobalTxId
+		oldLocalTxId := sagaAgentCtx.LocalTxId
+		oldBaggage := sagaAgentCtx.Baggage
+		defer func() {
+			sagaAgentCtx.GlobalTxId = oldGlobalTxId
+			sagaAgentCtx.LocalTxId = oldLocalTxId
+			sagaAgentCtx.Baggage = oldBaggage
+		}()
+		sagaAgentCtx.GlobalTxId = globalTxId
+		sagaAgentCtx.LocalTxId = localTxId
+		sagaAgentCtx.Baggage = baggage
+	}
+	defer func() {
+		if cause := recover(); cause != nil {
+			err = errors.New(fmt.Sprintf("compensation method %s panicked, %v", compensationMethod, cause))
+		}
+	}()
+	var out []reflect.Value
+	if targetFunc.Type().IsVariadic() {
+		out = targetFunc.CallSlice(args)
+	} else {
+		out = targetFunc.Call(args)
+	}
+	if len(out) > 0 {
+		if callErr, ok := out[len(out)-1].Interface().(error); ok && callErr != nil {
+			return errors.New(fmt.Sprintf("compensation method %s failed, %v", compensationMethod, callErr))
 		}
 	}
+	return nil
+}
+
+func gzipPayloads(payloads []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(payloads); err != nil {
+		return nil, errors.New(fmt.Sprintf("compress payloads failed, %v", err))
+	}
+	if err := w.Close(); err != nil {
+		return nil, errors.New(fmt.Sprintf("compress payloads failed, %v", err))
+	}
+	return buf.Bytes(), nil
+}
+
+// gunzipPayloads decompresses the payloads, and returns an error if they decompress to more than maxLength bytes.
+func gunzipPayloads(payloads []byte, maxLength int) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(payloads))
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("decompress payloads failed, %v", err))
+	}
+	defer r.Close()
+	b, err := ioutil.ReadAll(io.LimitReader(r, int64(maxLength)+1))
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("decompress payloads failed, %v", err))
+	}
+	if len(b) > maxLength {
+		return nil, errors.New(fmt.Sprintf("decompressed payloads are longer than %d bytes", maxLength))
+	}
+	return b, nil
+}
+
+// decompressedMaxLength returns the max length of the payloads decompressed from compressedLength bytes.
+func decompressedMaxLength(compressedLength int, maxLength int) int {
+	if compressedLength > maxLength {
+		maxLength = compressedLength
+	}
+	return maxCompressionRatio * maxLength
 }
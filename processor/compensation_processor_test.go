@@ -0,0 +1,639 @@
+package processor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jeremyxu2010/matrix-saga-go/serializer"
+)
+
+const maxLength = 10240
+
+func testKeys() serializer.KeyProvider {
+	return serializer.NewStaticKeyProvider("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+}
+
+// newTestProcessor returns a processor of the compensation functions cancel and refund recording their arguments in got.
+func newTestProcessor(s serializer.Serializer, got *[]string) *CompensationProcessor {
+	p := NewCompensationProcessor(s, nil)
+	p.RegisterCompensationFunc("cancel", func(id string) error {
+		*got = append(*got, "cancel "+id)
+		return nil
+	})
+	p.RegisterCompensationFunc("refund", func(id string) error {
+		*got = append(*got, "refund "+id)
+		return nil
+	})
+	return p
+}
+
+type order struct {
+	No     string
+	Amount int32
+}
+
+func TestExecuteCompensate(t *testing.T) {
+	var got []string
+	p := NewCompensationProcessor(serializer.NewGobSerializer(), nil)
+	p.RegisterCompensationFunc("cancel", func(no string, amount int32, o *order) error {
+		got = append(got, fmt.Sprintf("cancel %s %d %v", no, amount, o))
+		return nil
+	})
+	p.RegisterCompensationFunc("cancelAll", func(nos ...string) error {
+		got = append(got, fmt.Sprintf("cancelAll %v", nos))
+		return nil
+	})
+	p.RegisterCompensationFunc("fail", func(no string) error {
+		return errors.New("insufficient balance")
+	})
+	p.RegisterCompensationFunc("panic", func(no string) error {
+		panic("boom")
+	})
+	cases := []struct {
+		name         string
+		compensation string
+		args         []interface{}
+		want         string
+		err          string
+	}{
+		{"converted args", "cancel", []interface{}{"o1", 5, order{No: "o1", Amount: 5}}, "cancel o1 5 &{o1 5}", ""},
+		{"nil pointer", "cancel", []interface{}{"o1", int32(5), (*order)(nil)}, "cancel o1 5 <nil>", ""},
+		{"variadic", "cancelAll", []interface{}{[]string{"o1", "o2"}}, "cancelAll [o1 o2]", ""},
+		{"too few args", "cancel", []interface{}{"o1"}, "", "1 args for 3 params"},
+		{"mismatched arg", "cancel", []interface{}{5, 5, nil}, "", "decode arg 0 of type int into string failed"},
+		{"not registered", "refund", []interface{}{"o1"}, "", "compensation method refund is not registered"},
+		{"failed", "fail", []interface{}{"o1"}, "", "compensation method fail failed, insufficient balance"},
+		{"panicked", "panic", []interface{}{"o1"}, "", "compensation method panic panicked, boom"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got = nil
+			values := make([]reflect.Value, 0, len(c.args))
+			for _, arg := range c.args {
+				if arg == nil {
+					values = append(values, reflect.ValueOf((*interface{})(nil)).Elem())
+					continue
+				}
+				values = append(values, reflect.ValueOf(arg))
+			}
+			payloads, err := p.EncodeArgs(c.compensation, "g1", "l1", values, nil, 0, maxLength)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = p.ExecuteCompensate("g1", "l1", c.compensation, payloads, maxLength)
+			if len(c.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Errorf("got error %v, want %q", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 1 || got[0] != c.want {
+				t.Errorf("got %v, want %s", got, c.want)
+			}
+		})
+	}
+}
+
+// orderV1 is the argument of the compensation function cancel at schema version 1, its No is renamed to Id at version 2.
+type orderV1 struct {
+	No string
+}
+
+type orderV3 struct {
+	Id string
+}
+
+func TestPayloadsUpgrades(t *testing.T) {
+	renameNo := func(payloads []byte) ([]byte, error) {
+		return bytes.Replace(payloads, []byte(`"No"`), []byte(`"Id"`), 1), nil
+	}
+	upperId := func(payloads []byte) ([]byte, error) {
+		return bytes.Replace(payloads, []byte(`"o1"`), []byte(`"O1"`), 1), nil
+	}
+	failed := func(payloads []byte) ([]byte, error) {
+		return nil, errors.New("unknown field")
+	}
+	cases := []struct {
+		name         string
+		arg          interface{}
+		version      int
+		serializerId string
+		compensation string
+		current      int
+		upgrades     map[int]PayloadsUpgrade
+		want         string
+		err          string
+	}{
+		{"current version", orderV3{Id: "o1"}, 3, "json", "cancel", 3, nil, "cancel o1", ""},
+		{"upgraded", orderV1{No: "o1"}, 1, "json", "cancel", 3, map[int]PayloadsUpgrade{1: renameNo, 2: upperId}, "cancel O1", ""},
+		{"upgraded from version 2", orderV3{Id: "o1"}, 2, "json", "cancel", 3, map[int]PayloadsUpgrade{1: failed, 2: upperId}, "cancel O1", ""},
+		{"no version", orderV1{No: "o1"}, 0, "json", "cancel", 2, map[int]PayloadsUpgrade{1: renameNo}, "cancel o1", ""},
+		{"no serializer id", orderV3{Id: "o1"}, 1, "", "", 1, nil, "cancel o1", ""},
+		{"newer version", orderV3{Id: "o1"}, 4, "json", "cancel", 3, nil, "", "schema version 4 of the payloads is newer than the current version 3"},
+		{"missing upgrade", orderV1{No: "o1"}, 1, "json", "cancel", 3, map[int]PayloadsUpgrade{1: renameNo}, "", "no upgrade of the payloads from schema version 2"},
+		{"failed upgrade", orderV1{No: "o1"}, 1, "json", "cancel", 2, map[int]PayloadsUpgrade{1: failed}, "", "upgrade the payloads from schema version 1 failed, unknown field"},
+		{"unregistered serializer", orderV3{Id: "o1"}, 1, "xml", "cancel", 1, nil, "", "serializer xml is not registered"},
+		{"another compensation", orderV3{Id: "o1"}, 1, "json", "refund", 1, nil, "", "payloads of compensation method refund can not be used by cancel"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var got []string
+			p := NewCompensationProcessor(serializer.NewJsonSerializer(), nil)
+			p.RegisterCompensationFunc("cancel", func(o orderV3) error {
+				got = append(got, "cancel "+o.Id)
+				return nil
+			})
+			p.SetSchemaVersion("cancel", c.current)
+			for from, upgrade := range c.upgrades {
+				p.RegisterPayloadsUpgrade("cancel", from, upgrade)
+			}
+			b, err := serializer.NewJsonSerializer().Serialize([]reflect.Value{reflect.ValueOf(c.arg)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			payloads, err := serializer.WrapPayloads(b, &serializer.Envelope{
+				SerializerId:  c.serializerId,
+				SchemaVersion: c.version,
+				Compensation:  c.compensation,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = p.ExecuteCompensate("g1", "l1", "cancel", payloads, maxLength)
+			if len(c.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Errorf("got error %v, want %q", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 1 || got[0] != c.want {
+				t.Errorf("got %v, want %s", got, c.want)
+			}
+		})
+	}
+}
+
+func TestPayloadsUpgradesOfEncryptedPayloads(t *testing.T) {
+	renameNo := func(payloads []byte) ([]byte, error) {
+		if !bytes.Contains(payloads, []byte(`"No"`)) {
+			return nil, errors.New(fmt.Sprintf("field No is missing in %q", payloads))
+		}
+		return bytes.Replace(payloads, []byte(`"No"`), []byte(`"Id"`), 1), nil
+	}
+	for name, s := range map[string]serializer.Serializer{
+		"aes-gcm":     serializer.NewEncryptingSerializer(serializer.NewJsonSerializer(), testKeys()),
+		"sealed json": serializer.NewRedactingJsonSerializer(testKeys()),
+	} {
+		t.Run(name, func(t *testing.T) {
+			encoder := NewCompensationProcessor(s, nil)
+			payloads, err := encoder.EncodeArgs("cancel", "g1", "l1", []reflect.Value{reflect.ValueOf(orderV1{No: "o1"})}, nil, 0, maxLength)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			p := NewCompensationProcessor(s, nil)
+			p.RegisterCompensationFunc("cancel", func(o orderV3) error {
+				got = append(got, "cancel "+o.Id)
+				return nil
+			})
+			p.SetSchemaVersion("cancel", 2)
+			p.RegisterPayloadsUpgrade("cancel", 1, renameNo)
+			if err := p.ExecuteCompensate("g1", "l1", "cancel", payloads, maxLength); err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 1 || got[0] != "cancel o1" {
+				t.Errorf("got %v, want cancel o1", got)
+			}
+			// the payloads are checked against the binding before they are upgraded
+			if err := p.ExecuteCompensate("g2", "l1", "cancel", payloads, maxLength); err == nil || !strings.Contains(err.Error(), "bound to another compensation") {
+				t.Errorf("got error %v", err)
+			}
+		})
+	}
+}
+
+func TestEnvelopeRecordsTheSerializer(t *testing.T) {
+	var got []string
+	encoder := newTestProcessor(serializer.NewJsonSerializer(), &got)
+	encoder.SetSchemaVersion("cancel", 2)
+	payloads, err := encoder.EncodeArgs("cancel", "g1", "l1", []reflect.Value{reflect.ValueOf("o1")}, map[string]string{"tenant": "t1"}, 0, maxLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, e, err := serializer.UnwrapPayloads(payloads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &serializer.Envelope{SerializerId: "json", SchemaVersion: 2, Compensation: "cancel", Baggage: map[string]string{"tenant": "t1"}}
+	if !reflect.DeepEqual(e, want) {
+		t.Errorf("got envelope %+v, want %+v", e, want)
+	}
+	// the payloads are decoded by the serializer recorded in the envelope after the serializer is changed
+	decoder := newTestProcessor(serializer.NewGobSerializer(), &got)
+	decoder.SetSchemaVersion("cancel", 2)
+	if err := decoder.ExecuteCompensate("g1", "l1", "cancel", payloads, maxLength); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []string{"cancel o1"}) {
+		t.Errorf("got %v", got)
+	}
+}
+
+// memBlobStore keeps the blobs in memory, Put fails with err if it is not nil.
+type memBlobStore struct {
+	blobs map[string][]byte
+	err   error
+}
+
+func newMemBlobStore() *memBlobStore {
+	return &memBlobStore{blobs: make(map[string][]byte)}
+}
+
+func (s *memBlobStore) Put(payloads []byte) (string, error) {
+	if s.err != nil {
+		return "", s.err
+	}
+	ref := fmt.Sprintf("blob-%d", len(s.blobs))
+	s.blobs[ref] = payloads
+	return ref, nil
+}
+
+func (s *memBlobStore) Get(ref string) ([]byte, error) {
+	b, ok := s.blobs[ref]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return b, nil
+}
+
+// numbers returns the numbers below n separated by spaces, which gzip compresses a few times.
+func numbers(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "%d ", i)
+	}
+	return b.String()
+}
+
+func TestCompressPayloads(t *testing.T) {
+	cases := []struct {
+		name              string
+		arg               string
+		compressThreshold int
+		maxLength         int
+		compression       string
+		offloaded         bool
+	}{
+		{"shorter than the threshold", strings.Repeat("a", 100), 4096, maxLength, "", false},
+		{"longer than the threshold", strings.Repeat("a", 8192), 4096, maxLength, "gzip", false},
+		{"compression disabled", strings.Repeat("a", 8192), 0, maxLength, "", false},
+		{"incompressible", "abcdefghijklmnopqrstuvwxyz0123456789", 16, maxLength, "", false},
+		{"longer than the max length once compressed", numbers(5000), 4096, 512, "gzip", true},
+		{"compressed beyond the max ratio", strings.Repeat("a", 20000), 4096, 100, "", true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var got []string
+			p := newTestProcessor(serializer.NewGobSerializer(), &got)
+			blobs := newMemBlobStore()
+			p.SetBlobStore(blobs)
+			payloads, err := p.EncodeArgs("cancel", "g1", "l1", []reflect.Value{reflect.ValueOf(c.arg)}, nil, c.compressThreshold, c.maxLength)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, e, err := serializer.UnwrapPayloads(payloads)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if offloaded := len(e.Blob) > 0; offloaded != c.offloaded {
+				t.Fatalf("offloaded %v, want %v", offloaded, c.offloaded)
+			}
+			if c.offloaded {
+				if _, e, err = serializer.UnwrapPayloads(blobs.blobs[e.Blob]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if e.Compression != c.compression {
+				t.Errorf("got compression %q, want %q", e.Compression, c.compression)
+			}
+			if err := p.ExecuteCompensate("g1", "l1", "cancel", payloads, c.maxLength); err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 1 || got[0] != "cancel "+c.arg {
+				t.Error("arguments are not decoded")
+			}
+		})
+	}
+}
+
+func TestJsonPayloadsAreNotCompressed(t *testing.T) {
+	var got []string
+	p := newTestProcessor(serializer.NewJsonSerializer(), &got)
+	arg := numbers(2000)
+	payloads, err := p.EncodeArgs("cancel", "g1", "l1", []reflect.Value{reflect.ValueOf(arg)}, nil, 4096, maxLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, e, err := serializer.UnwrapPayloads(payloads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) <= 4096 || len(e.Compression) > 0 || !bytes.Contains(b, []byte(arg)) {
+		t.Errorf("payloads of %d bytes are compressed by %q or not readable", len(b), e.Compression)
+	}
+
+	// the JSON payloads compressed by the earlier versions of the saga agent
+	compressed, err := gzipPayloads(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Compression = payloadsCompressionGzip
+	if payloads, err = serializer.WrapPayloads(compressed, e); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.ExecuteCompensate("g1", "l1", "cancel", payloads, maxLength); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []string{"cancel " + arg}) {
+		t.Error("compressed JSON arguments are not decoded")
+	}
+}
+
+func TestDecompressPayloads(t *testing.T) {
+	var got []string
+	p := newTestProcessor(serializer.NewGobSerializer(), &got)
+	b, err := serializer.NewGobSerializer().Serialize([]reflect.Value{reflect.ValueOf("o1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed, err := gzipPayloads(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bomb, err := gzipPayloads(make([]byte, maxCompressionRatio*maxLength+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name        string
+		compression string
+		payloads    []byte
+		err         string
+	}{
+		{"gzip", "gzip", compressed, ""},
+		{"longer than the bound", "gzip", bomb, fmt.Sprintf("decompressed payloads are longer than %d bytes", maxCompressionRatio*maxLength)},
+		{"corrupted", "gzip", b, "decompress payloads failed"},
+		{"truncated", "gzip", compressed[:len(compressed)-4], "decompress payloads failed"},
+		{"unsupported", "zstd", compressed, "unsupported payloads compression zstd"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			payloads, err := serializer.WrapPayloads(c.payloads, &serializer.Envelope{
+				SerializerId: serializer.SerializerId(p.Serializer("cancel")),
+				Compression:  c.compression,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = p.ExecuteCompensate("g1", "l1", "cancel", payloads, maxLength)
+			if len(c.err) == 0 && err != nil || len(c.err) > 0 && (err == nil || !strings.Contains(err.Error(), c.err)) {
+				t.Errorf("got error %v, want %q", err, c.err)
+			}
+		})
+	}
+}
+
+func TestGunzipPayloads(t *testing.T) {
+	cases := []struct {
+		name      string
+		length    int
+		maxLength int
+		fails     bool
+	}{
+		{"empty", 0, 0, false},
+		{"shorter than the max length", 99, 100, false},
+		{"max length", 100, 100, false},
+		{"longer than the max length", 101, 100, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			compressed, err := gzipPayloads(bytes.Repeat([]byte{'a'}, c.length))
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := gunzipPayloads(compressed, c.maxLength)
+			if fails := err != nil; fails != c.fails {
+				t.Fatalf("got error %v", err)
+			}
+			if !c.fails && len(b) != c.length {
+				t.Errorf("got %d bytes, want %d", len(b), c.length)
+			}
+		})
+	}
+}
+
+func TestOffloadPayloads(t *testing.T) {
+	long := strings.Repeat("a", 2*maxLength)
+	cases := []struct {
+		name      string
+		arg       string
+		blobs     *memBlobStore
+		raw       bool
+		offloaded bool
+		// inline is true if the payloads longer than the max length are sent as they are
+		inline bool
+		err    string
+	}{
+		{"shorter than the max length", "o1", nil, false, false, false, ""},
+		{"offloaded", long, newMemBlobStore(), false, true, false, ""},
+		{"no blob store", long, nil, false, false, true, ""},
+		{"blob store failed", long, &memBlobStore{err: errors.New("disk full")}, false, false, false, "offload payloads of compensation method cancel failed, disk full"},
+		{"raw", long, newMemBlobStore(), true, false, true, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var got []string
+			s := serializer.NewGobSerializer()
+			if c.raw {
+				s = serializer.NewKryoSerializer()
+			}
+			p := newTestProcessor(s, &got)
+			if c.blobs != nil {
+				p.SetBlobStore(c.blobs)
+			}
+			payloads, err := p.EncodeArgs("cancel", "g1", "l1", []reflect.Value{reflect.ValueOf(c.arg)}, nil, 0, maxLength)
+			if len(c.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Errorf("got error %v, want %q", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if inline := len(payloads) > maxLength; inline != c.inline {
+				t.Errorf("payloads are %d bytes", len(payloads))
+			}
+			_, e, err := serializer.UnwrapPayloads(payloads)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if offloaded := len(e.Blob) > 0; offloaded != c.offloaded {
+				t.Errorf("offloaded %v, want %v", offloaded, c.offloaded)
+			}
+			if err := p.ExecuteCompensate("g1", "l1", "cancel", payloads, maxLength); err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 1 || got[0] != "cancel "+c.arg {
+				t.Error("arguments are not decoded")
+			}
+		})
+	}
+}
+
+func TestLoadBlob(t *testing.T) {
+	blobs := newMemBlobStore()
+	ref, _ := blobs.Put([]byte("x"))
+	nested, _ := serializer.WrapPayloads(nil, &serializer.Envelope{Blob: ref})
+	nestedRef, _ := blobs.Put(nested)
+	cases := []struct {
+		name  string
+		ref   string
+		blobs serializer.BlobStore
+		err   string
+	}{
+		{"no blob store", ref, nil, "payloads are offloaded to blob " + ref + ", but there is no blob store"},
+		{"missing blob", "blob-9", blobs, "load payloads from blob blob-9 failed, not found"},
+		{"blob referring to another blob", nestedRef, blobs, "blob " + nestedRef + " refers to another blob"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var got []string
+			p := newTestProcessor(serializer.NewGobSerializer(), &got)
+			if c.blobs != nil {
+				p.SetBlobStore(c.blobs)
+			}
+			payloads, err := serializer.WrapPayloads(nil, &serializer.Envelope{Compensation: "cancel", Blob: c.ref})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = p.ExecuteCompensate("g1", "l1", "cancel", payloads, maxLength)
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("got error %v, want %q", err, c.err)
+			}
+		})
+	}
+}
+
+func TestEncryptedPayloadsCanNotBeReplayed(t *testing.T) {
+	for name, s := range map[string]serializer.Serializer{
+		"aes-gcm":     serializer.NewEncryptingSerializer(serializer.NewGobSerializer(), testKeys()),
+		"sealed json": serializer.NewRedactingJsonSerializer(testKeys()),
+	} {
+		t.Run(name, func(t *testing.T) {
+			testPayloadsCanNotBeReplayed(t, s)
+		})
+	}
+}
+
+func testPayloadsCanNotBeReplayed(t *testing.T, s serializer.Serializer) {
+	var got []string
+	p := newTestProcessor(s, &got)
+	payloads, err := p.EncodeArgs("cancel", "g1", "l1", []reflect.Value{reflect.ValueOf("o1")}, map[string]string{"tenant": "t1"}, 0, maxLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.ExecuteCompensate("g1", "l1", "cancel", payloads, maxLength); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []string{"cancel o1"}) {
+		t.Fatalf("got %v", got)
+	}
+
+	// tampered returns the payloads whose envelope is changed by tamper
+	tampered := func(tamper func(e *serializer.Envelope)) []byte {
+		b, e, err := serializer.UnwrapPayloads(payloads)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tamper(e)
+		tampered, err := serializer.WrapPayloads(b, e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tampered
+	}
+	stripped := tampered(func(e *serializer.Envelope) { e.Compensation = "" })
+	const replayed = "bound to another compensation"
+	cases := []struct {
+		name         string
+		globalTxId   string
+		localTxId    string
+		compensation string
+		payloads     []byte
+		err          string
+	}{
+		{"another saga", "g2", "l1", "cancel", payloads, replayed},
+		{"another transaction", "g1", "l2", "cancel", payloads, replayed},
+		{"another method", "g1", "l1", "refund", stripped, replayed},
+		{"another method of another transaction", "g2", "l2", "refund", stripped, replayed},
+		{"tampered baggage", "g1", "l1", "cancel", tampered(func(e *serializer.Envelope) { e.Baggage["tenant"] = "t2" }), replayed},
+		{"stripped baggage", "g1", "l1", "cancel", tampered(func(e *serializer.Envelope) { e.Baggage = nil }), replayed},
+		{"tampered schema version", "g1", "l1", "cancel", tampered(func(e *serializer.Envelope) { e.SchemaVersion = 0 }), replayed},
+		{"tampered compression", "g1", "l1", "cancel", tampered(func(e *serializer.Envelope) { e.Compression = "gzip" }), "they are never compressed"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := p.ExecuteCompensate(c.globalTxId, c.localTxId, c.compensation, c.payloads, maxLength)
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("got error %v, want %q", err, c.err)
+			}
+		})
+	}
+	if len(got) != 1 {
+		t.Errorf("replayed payloads are compensated, %v", got)
+	}
+}
+
+func TestUnauthenticatedPayloadsAreRejected(t *testing.T) {
+	var got []string
+	plain := newTestProcessor(serializer.NewGobSerializer(), &got)
+	p := newTestProcessor(serializer.NewEncryptingSerializer(serializer.NewGobSerializer(), testKeys()), &got)
+	enveloped, err := plain.EncodeArgs("cancel", "g1", "l1", []reflect.Value{reflect.ValueOf("o1")}, nil, 0, maxLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _, err := serializer.UnwrapPayloads(enveloped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name     string
+		payloads []byte
+		err      string
+	}{
+		{"serializer downgraded", enveloped, "payloads of serializer gob are not authenticated, serializer aes-gcm+gob is required"},
+		{"no envelope", raw, "payloads are not encrypted"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := p.ExecuteCompensate("g1", "l1", "cancel", c.payloads, maxLength)
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("got error %v, want %q", err, c.err)
+			}
+		})
+	}
+	if len(got) > 0 {
+		t.Errorf("unauthenticated payloads are compensated, %v", got)
+	}
+}
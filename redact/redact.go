@@ -0,0 +1,225 @@
+package redact
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"unsafe"
+)
+
+// Mask replaces the redacted text.
+const Mask = "******"
+
+// maxDepth bounds the values masked by Value, the deeper values are kept as they are.
+const maxDepth = 32
+
+// Redactor masks the secrets in the texts matching its patterns, and in the fields of the structs tagged `saga:"redact"`.
+type Redactor struct {
+	patterns []*regexp.Regexp
+}
+
+// New creates a Redactor of the regular expressions patterns. The whole match of a pattern is masked,
+// or only its groups if it has any, such as `password=(\S+)` masking only the password.
+func New(patterns ...string) (*Redactor, error) {
+	r := &Redactor{
+		patterns: make([]*regexp.Regexp, 0, len(patterns)),
+	}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid redact pattern %s, %v", pattern, err))
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// String masks the matches of the patterns in s.
+func (r *Redactor) String(s string) string {
+	for _, re := range r.patterns {
+		matches := re.FindAllStringSubmatchIndex(s, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		var b strings.Builder
+		last := 0
+		for _, match := range matches {
+			spans := match[2:]
+			if len(spans) == 0 {
+				spans = match[:2]
+			}
+			for i := 0; i+1 < len(spans); i += 2 {
+				if spans[i] < last || spans[i+1] <= spans[i] {
+					// an unmatched, empty or nested group
+					continue
+				}
+				b.WriteString(s[last:spans[i]])
+				b.WriteString(Mask)
+				last = spans[i+1]
+			}
+		}
+		b.WriteString(s[last:])
+		s = b.String()
+	}
+	return s
+}
+
+// Value returns a copy of value with the secrets masked: the string fields of the structs tagged `saga:"redact"` are replaced by Mask,
+// the other tagged fields by their zero values, and the strings matching the patterns are masked. The empty tagged fields are kept.
+// The unexported fields tagged `saga:"redact"` are masked as well, the other unexported fields are kept as they are.
+func (r *Redactor) Value(value reflect.Value) reflect.Value {
+	return r.mask(value, 0)
+}
+
+// Sprint formats v like fmt.Sprintf("%+v", v), or v.Error() if v is an error, with the secrets masked, see Value.
+// The saga agent formats the contexts and the errors in the logs and the abort messages by Sprint of the default redactor.
+func (r *Redactor) Sprint(v interface{}) string {
+	value := r.Value(reflect.ValueOf(v))
+	if value.IsValid() {
+		v = value.Interface()
+	}
+	if err, ok := v.(error); ok {
+		return r.String(err.Error())
+	}
+	return r.String(fmt.Sprintf("%+v", v))
+}
+
+func (r *Redactor) mask(value reflect.Value, depth int) reflect.Value {
+	if !value.IsValid() || depth > maxDepth {
+		return value
+	}
+	switch value.Kind() {
+	case reflect.String:
+		s := r.String(value.String())
+		if s == value.String() {
+			return value
+		}
+		masked := reflect.New(value.Type()).Elem()
+		masked.SetString(s)
+		return masked
+	case reflect.Ptr:
+		if value.IsNil() {
+			return value
+		}
+		masked := reflect.New(value.Type().Elem())
+		masked.Elem().Set(r.mask(value.Elem(), depth+1))
+		return masked
+	case reflect.Interface:
+		if value.IsNil() {
+			return value
+		}
+		masked := reflect.New(value.Type()).Elem()
+		masked.Set(r.mask(value.Elem(), depth+1))
+		return masked
+	case reflect.Struct:
+		masked := reflect.New(value.Type()).Elem()
+		masked.Set(value)
+		for i := 0; i < value.NumField(); i++ {
+			field := masked.Field(i)
+			if tagged(value.Type().Field(i).Tag) {
+				if !field.CanSet() {
+					// masked is addressable, so is its unexported field
+					field = reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem()
+				}
+				// an empty field is not a secret, a nil pointer stays nil
+				if !isZero(field) {
+					field.Set(maskedValue(field.Type()))
+				}
+			} else if field.CanSet() {
+				field.Set(r.mask(field, depth+1))
+			}
+		}
+		return masked
+	case reflect.Slice:
+		if value.IsNil() {
+			return value
+		}
+		masked := reflect.MakeSlice(value.Type(), value.Len(), value.Len())
+		for i := 0; i < value.Len(); i++ {
+			masked.Index(i).Set(r.mask(value.Index(i), depth+1))
+		}
+		return masked
+	case reflect.Array:
+		masked := reflect.New(value.Type()).Elem()
+		for i := 0; i < value.Len(); i++ {
+			masked.Index(i).Set(r.mask(value.Index(i), depth+1))
+		}
+		return masked
+	case reflect.Map:
+		if value.IsNil() {
+			return value
+		}
+		masked := reflect.MakeMapWithSize(value.Type(), value.Len())
+		for _, key := range value.MapKeys() {
+			masked.SetMapIndex(key, r.mask(value.MapIndex(key), depth+1))
+		}
+		return masked
+	}
+	return value
+}
+
+// tagged returns whether the field of tag is tagged `saga:"redact"`.
+func tagged(tag reflect.StructTag) bool {
+	for _, option := range strings.Split(tag.Get("saga"), ",") {
+		if strings.TrimSpace(option) == "redact" {
+			return true
+		}
+	}
+	return false
+}
+
+func isZero(value reflect.Value) bool {
+	return reflect.DeepEqual(reflect.Zero(value.Type()).Interface(), value.Interface())
+}
+
+func maskedValue(t reflect.Type) reflect.Value {
+	switch {
+	case t.Kind() == reflect.String:
+		return reflect.ValueOf(Mask).Convert(t)
+	case t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.String:
+		masked := reflect.New(t.Elem())
+		masked.Elem().Set(reflect.ValueOf(Mask).Convert(t.Elem()))
+		return masked
+	}
+	return reflect.Zero(t)
+}
+
+var defaultRedactor atomic.Value
+
+func init() {
+	defaultRedactor.Store(&Redactor{})
+}
+
+// SetPatterns sets the patterns of the default redactor, which masks the logs and the abort messages of the saga agent,
+// and the readable payloads of serializer.NewRedactingJsonSerializer.
+func SetPatterns(patterns ...string) error {
+	r, err := New(patterns...)
+	if err != nil {
+		return err
+	}
+	defaultRedactor.Store(r)
+	return nil
+}
+
+// Default returns the default redactor.
+func Default() *Redactor {
+	return defaultRedactor.Load().(*Redactor)
+}
+
+// String masks s by the default redactor.
+func String(s string) string {
+	return Default().String(s)
+}
+
+// Value masks value by the default redactor.
+func Value(value reflect.Value) reflect.Value {
+	return Default().Value(value)
+}
+
+// Sprint formats v masked by the default redactor.
+func Sprint(v interface{}) string {
+	return Default().Sprint(v)
+}
@@ -0,0 +1,100 @@
+package saga
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jeremyxu2010/matrix-saga-go/config"
+	"github.com/jeremyxu2010/matrix-saga-go/log"
+	"github.com/jeremyxu2010/matrix-saga-go/redact"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// agentConfig holds the current *config.AgentConfig of the saga agent
+	agentConfig   atomic.Value
+	leveledLogger *log.LeveledLogger
+)
+
+// UpdateConfig changes the settings of the running saga agent to those of c: the log level, the timeouts, the retry policy,
+// the limits of the payloads, the disabled methods and the redact patterns. The connection to the coordinator and the sagas in flight are kept.
+// The service name, the instance id, the coordinators and the offload directory can not be changed at runtime, their changes are ignored.
+func UpdateConfig(c *config.AgentConfig) error {
+	current := currentConfig()
+	if current == nil || transportContractor == nil {
+		return errors.New("saga agent is not initialized")
+	}
+	if err := c.ValidateReloadable(); err != nil {
+		return err
+	}
+	level, _ := log.ParseLevel(c.LogLevel)
+	updated := *current
+	updated.Timeout = c.Timeout
+	updated.ReconnectDelay = c.ReconnectDelay
+	updated.PayloadsMaxLength = c.PayloadsMaxLength
+	updated.CompressThreshold = c.CompressThreshold
+	updated.LogLevel = c.LogLevel
+	updated.RetryAttempts = c.RetryAttempts
+	updated.RetryBackoff = c.RetryBackoff
+	updated.DisabledMethods = c.DisabledMethods
+	updated.RedactPatterns = c.RedactPatterns
+	agentConfig.Store(&updated)
+	transportContractor.UpdateConfig(&updated)
+	leveledLogger.SetLevel(level)
+	redact.SetPatterns(updated.RedactPatterns...)
+	logger.LogInfo(fmt.Sprintf("Updated config of saga agent, log level: %s, timeout: %v, reconnect delay: %v, retries: %d, disabled methods: %v",
+		updated.LogLevel, updated.Timeout, updated.ReconnectDelay, updated.RetryAttempts, updated.DisabledMethods))
+	return nil
+}
+
+// WatchConfigFile reloads the configuration from the YAML file path, overridden by the environment variables,
+// and applies it by UpdateConfig whenever the file is modified. It checks the file every interval until stop is called.
+func WatchConfigFile(path string, interval time.Duration) (stop func(), err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	modTime := info.ModTime()
+	stopped := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopped:
+				return
+			case <-ticker.C:
+			}
+			info, err := os.Stat(path)
+			if err != nil || info.ModTime().Equal(modTime) {
+				continue
+			}
+			modTime = info.ModTime()
+			c, err := config.LoadAgentConfig(path)
+			if err == nil {
+				err = UpdateConfig(c)
+			}
+			if err != nil {
+				logger.LogError(fmt.Sprintf("Failed to reload config file %s, %v", path, err))
+			}
+		}
+	}()
+	var once int32
+	return func() {
+		if atomic.CompareAndSwapInt32(&once, 0, 1) {
+			close(stopped)
+		}
+	}, nil
+}
+
+func currentConfig() *config.AgentConfig {
+	c, _ := agentConfig.Load().(*config.AgentConfig)
+	return c
+}
+
+// methodEnabled returns whether the saga is enabled for method, see config.AgentConfig.DisabledMethods.
+func methodEnabled(method string) bool {
+	c := currentConfig()
+	return c == nil || c.MethodEnabled(method)
+}
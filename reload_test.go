@@ -0,0 +1,122 @@
+package saga
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jeremyxu2010/matrix-saga-go/config"
+	"github.com/jeremyxu2010/matrix-saga-go/redact"
+)
+
+// recordingLogger records the logs written to it.
+type recordingLogger struct {
+	lock sync.Mutex
+	logs []string
+}
+
+func (l *recordingLogger) log(content string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.logs = append(l.logs, content)
+}
+
+func (l *recordingLogger) written() []string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return append([]string(nil), l.logs...)
+}
+
+func (l *recordingLogger) LogWarn(content string)  { l.log(content) }
+func (l *recordingLogger) LogError(content string) { l.log(content) }
+func (l *recordingLogger) LogInfo(content string)  { l.log(content) }
+func (l *recordingLogger) LogDebug(content string) { l.log(content) }
+func (l *recordingLogger) LogFatal(content string) { l.log(content) }
+
+// initRecordingSagaAgent initializes the saga agent writing its logs at the level info to the returned logger,
+// until the returned function is called.
+func initRecordingSagaAgent(t *testing.T) (*recordingLogger, func()) {
+	oldLogger, oldServiceConfig := logger, serviceConfig
+	rec := &recordingLogger{}
+	c := config.NewAgentConfig()
+	c.LogLevel = "info"
+	c.RedactPatterns = []string{`password=(\S+)`}
+	o := newAgentOptions([]Option{WithConfig(c), WithServiceName("saga-test"), WithInstanceId("saga-test-1"),
+		WithCoordinators("127.0.0.1:8080"), WithLogger(rec)})
+	if err := initSagaAgent(o); err != nil {
+		t.Fatal(err)
+	}
+	return rec, func() {
+		transportContractor, serviceConfig, logger = nil, oldServiceConfig, oldLogger
+		agentConfig.Store(config.NewAgentConfig())
+		redact.SetPatterns()
+	}
+}
+
+func TestUpdateConfig(t *testing.T) {
+	rec, restore := initRecordingSagaAgent(t)
+	defer restore()
+
+	logger.LogDebug("debug password=secret")
+	logger.LogInfo("info password=secret")
+	if logs := rec.written(); len(logs) != 1 || logs[0] != "info password="+redact.Mask {
+		t.Fatalf("got logs %q, want only the redacted info log", logs)
+	}
+
+	// the settings which can not be changed at runtime, such as the service name and the coordinators, are not required
+	c := config.NewAgentConfig()
+	c.LogLevel = "debug"
+	c.RetryAttempts = 3
+	c.DisabledMethods = []string{"main.*"}
+	if err := UpdateConfig(c); err != nil {
+		t.Fatal(err)
+	}
+	updated := currentConfig()
+	if updated.ServiceName != "saga-test" || len(updated.Coordinators) != 1 {
+		t.Errorf("service name %q and coordinators %v are changed", updated.ServiceName, updated.Coordinators)
+	}
+	if updated.RetryAttempts != 3 || methodEnabled("main.TransferMoney") {
+		t.Errorf("retries %d and disabled methods %v are not changed", updated.RetryAttempts, updated.DisabledMethods)
+	}
+	logger.LogDebug("debug password=secret")
+	logs := rec.written()
+	if last := logs[len(logs)-1]; last != "debug password=secret" {
+		t.Errorf("got log %q, want the debug log unredacted after the patterns are cleared", last)
+	}
+}
+
+func TestUpdateConfigRejectsInvalidSettings(t *testing.T) {
+	_, restore := initRecordingSagaAgent(t)
+	defer restore()
+
+	cases := []struct {
+		name   string
+		change func(c *config.AgentConfig)
+		err    string
+	}{
+		{"log level", func(c *config.AgentConfig) { c.LogLevel = "verbose" }, "unknown log level"},
+		{"timeout", func(c *config.AgentConfig) { c.Timeout = 0 }, "must be positive"},
+		{"retry attempts", func(c *config.AgentConfig) { c.RetryAttempts = -1 }, "must not be negative"},
+		{"disabled method", func(c *config.AgentConfig) { c.DisabledMethods = []string{"main.["} }, "invalid disabled method pattern"},
+		{"redact pattern", func(c *config.AgentConfig) { c.RedactPatterns = []string{"("} }, "("},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			updated := config.NewAgentConfig()
+			c.change(updated)
+			err := UpdateConfig(updated)
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Fatalf("got error %v, want %q", err, c.err)
+			}
+			if currentConfig().LogLevel != "info" {
+				t.Error("config is changed")
+			}
+		})
+	}
+}
+
+func TestUpdateConfigNotInitialized(t *testing.T) {
+	if err := UpdateConfig(config.NewAgentConfig()); err == nil {
+		t.Error("config is updated without the saga agent")
+	}
+}
@@ -0,0 +1,66 @@
+package saga
+
+import (
+	"errors"
+	"fmt"
+	sagactx "github.com/jeremyxu2010/matrix-saga-go/context"
+	"github.com/jeremyxu2010/matrix-saga-go/redact"
+)
+
+// The functions in this file control a long-running global transaction by its id from any process,
+// such as a saga started with autoClose=false and finished hours later on another instance.
+
+// EndSaga ends the global transaction globalTxId.
+func EndSaga(globalTxId string) error {
+	if transportContractor == nil {
+		return errors.New("saga agent is not initialized")
+	}
+	sagaAgentCtx := rootSagaAgentContext(globalTxId)
+	aborted, err := transportContractor.SendSagaEndedEvent(sagaAgentCtx)
+	if err != nil {
+		logger.LogError(fmt.Sprintf("Failed to end transaction %v, %v", sagaAgentCtx, redact.Sprint(err)))
+		return err
+	}
+	if aborted {
+		return errors.New(fmt.Sprintf("transaction %s is aborted", globalTxId))
+	}
+	logger.LogDebug(fmt.Sprintf("Transaction with context %v has finished.", sagaAgentCtx))
+	return nil
+}
+
+// AbortSaga aborts the global transaction globalTxId because of cause,
+// the coordinator compensates all the finished sub transactions of it.
+func AbortSaga(globalTxId string, cause error) error {
+	if transportContractor == nil {
+		return errors.New("saga agent is not initialized")
+	}
+	if cause == nil {
+		cause = errors.New(fmt.Sprintf("transaction %s is aborted", globalTxId))
+	}
+	sagaAgentCtx := rootSagaAgentContext(globalTxId)
+	_, err := transportContractor.SendTxAbortedEvent(sagaAgentCtx, "", "", cause)
+	if err != nil {
+		logger.LogError(fmt.Sprintf("Failed to abort transaction %v, %v", sagaAgentCtx, redact.Sprint(err)))
+		return err
+	}
+	logger.LogError(fmt.Sprintf("Transaction %v is aborted, %v", sagaAgentCtx, redact.Sprint(cause)))
+	return nil
+}
+
+// ResumeSaga binds the global transaction globalTxId to the current goroutine, so that more compensable methods can be added to it,
+// and returns a function which unbinds it. Use sagactx.Unmarshal instead to resume the saga with its baggage.
+//
+//	unbind := saga.ResumeSaga(globalTxId)
+//	defer unbind()
+//	err := ApproveCompensableDecorated(orderNo)
+func ResumeSaga(globalTxId string) func() {
+	return sagactx.BindSagaAgentContext(rootSagaAgentContext(globalTxId))
+}
+
+// rootSagaAgentContext returns the context of the saga start method, whose local tx id is the global tx id.
+func rootSagaAgentContext(globalTxId string) *sagactx.SagaAgentContext {
+	sagaAgentCtx := sagactx.NewSagaAgentContext()
+	sagaAgentCtx.GlobalTxId = globalTxId
+	sagaAgentCtx.LocalTxId = globalTxId
+	return sagaAgentCtx
+}
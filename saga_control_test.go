@@ -0,0 +1,156 @@
+package saga
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/jeremyxu2010/matrix-saga-go/config"
+	sagactx "github.com/jeremyxu2010/matrix-saga-go/context"
+)
+
+// sentEvent is an event sent by stubTransport.
+type sentEvent struct {
+	kind               string
+	globalTxId         string
+	localTxId          string
+	parentTxId         string
+	compensationMethod string
+}
+
+// stubTransport records the events instead of sending them to the coordinator.
+type stubTransport struct {
+	lock   sync.Mutex
+	events []sentEvent
+}
+
+func (t *stubTransport) record(kind string, sagaAgentCtx *sagactx.SagaAgentContext, parentTxId string, compensationMethod string) (bool, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.events = append(t.events, sentEvent{kind, sagaAgentCtx.GlobalTxId, sagaAgentCtx.LocalTxId, parentTxId, compensationMethod})
+	return false, nil
+}
+
+func (t *stubTransport) sent() []sentEvent {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return append([]sentEvent(nil), t.events...)
+}
+
+func (t *stubTransport) Connect() error {
+	return nil
+}
+
+func (t *stubTransport) UpdateConfig(agentConfig *config.AgentConfig) {
+}
+
+func (t *stubTransport) SendSagaStartedEvent(sagaAgentCtx *sagactx.SagaAgentContext, timeout int) (bool, error) {
+	return t.record("SagaStartedEvent", sagaAgentCtx, "", "")
+}
+
+func (t *stubTransport) SendSagaEndedEvent(sagaAgentCtx *sagactx.SagaAgentContext) (bool, error) {
+	return t.record("SagaEndedEvent", sagaAgentCtx, "", "")
+}
+
+func (t *stubTransport) SendTxStartedEvent(sagaAgentCtx *sagactx.SagaAgentContext, parentTxId string, compensationMethod string, timeout int, args []reflect.Value) (bool, error) {
+	return t.record("TxStartedEvent", sagaAgentCtx, parentTxId, compensationMethod)
+}
+
+func (t *stubTransport) SendTxEndedEvent(sagaAgentCtx *sagactx.SagaAgentContext, parentTxId string, compensationMethod string) (bool, error) {
+	return t.record("TxEndedEvent", sagaAgentCtx, parentTxId, compensationMethod)
+}
+
+func (t *stubTransport) SendTxAbortedEvent(sagaAgentCtx *sagactx.SagaAgentContext, parentTxId string, compensationMethod string, err error) (bool, error) {
+	return t.record("TxAbortedEvent", sagaAgentCtx, parentTxId, compensationMethod)
+}
+
+// useStubTransport replaces the transport of the saga agent with a stubTransport until the returned function is called.
+func useStubTransport() (*stubTransport, func()) {
+	stub := &stubTransport{}
+	transportContractor = stub
+	return stub, func() {
+		transportContractor = nil
+	}
+}
+
+func TestControlSaga(t *testing.T) {
+	const globalTxId = "saga-test-global-tx"
+	cases := []struct {
+		name    string
+		control func() error
+		want    []sentEvent
+	}{
+		{
+			"end", func() error { return EndSaga(globalTxId) },
+			[]sentEvent{{"SagaEndedEvent", globalTxId, globalTxId, "", ""}},
+		},
+		{
+			"abort", func() error { return AbortSaga(globalTxId, errors.New("cancelled")) },
+			[]sentEvent{{"TxAbortedEvent", globalTxId, globalTxId, "", ""}},
+		},
+		{
+			"abort without cause", func() error { return AbortSaga(globalTxId, nil) },
+			[]sentEvent{{"TxAbortedEvent", globalTxId, globalTxId, "", ""}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			stub, restore := useStubTransport()
+			defer restore()
+			if err := c.control(); err != nil {
+				t.Fatal(err)
+			}
+			if got := stub.sent(); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got events %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestControlSagaNotInitialized(t *testing.T) {
+	if err := EndSaga("saga-test-global-tx"); err == nil {
+		t.Error("saga is ended without the saga agent")
+	}
+	if err := AbortSaga("saga-test-global-tx", nil); err == nil {
+		t.Error("saga is aborted without the saga agent")
+	}
+}
+
+func TestResumeSaga(t *testing.T) {
+	const globalTxId = "saga-test-global-tx"
+	agentConfig.Store(config.NewAgentConfig())
+	stub, restore := useStubTransport()
+	defer restore()
+	unbind := ResumeSaga(globalTxId)
+	tx, err := BeginCompensable("main.Approve", "main.CancelApprove", 0, "order-1")
+	if err != nil {
+		unbind()
+		t.Fatal(err)
+	}
+	childLocalTxId := tx.sagaAgentCtx.LocalTxId
+	if err := tx.Finish(nil); err != nil {
+		t.Error(err)
+	}
+	sagaAgentCtx, err := sagactx.GetSagaAgentContext()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sagaAgentCtx.GlobalTxId != globalTxId || sagaAgentCtx.LocalTxId != globalTxId {
+		t.Errorf("got context %v after the compensable method, want the root of %s", sagaAgentCtx, globalTxId)
+	}
+	unbind()
+	if _, err := sagactx.GetSagaAgentContext(); err == nil {
+		t.Error("saga agent context is still bound")
+	}
+	if childLocalTxId == globalTxId || len(childLocalTxId) == 0 {
+		t.Fatalf("got local tx id %q of the compensable method", childLocalTxId)
+	}
+	want := []sentEvent{
+		{"TxStartedEvent", globalTxId, childLocalTxId, globalTxId, "main.CancelApprove"},
+		{"TxEndedEvent", globalTxId, childLocalTxId, globalTxId, "main.CancelApprove"},
+	}
+	if got := stub.sent(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got events %v, want %v", got, want)
+	}
+}
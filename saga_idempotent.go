@@ -0,0 +1,204 @@
+package saga
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jeremyxu2010/matrix-saga-go/constants"
+	sagactx "github.com/jeremyxu2010/matrix-saga-go/context"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// SagaStartOption configures the saga start method decorated by DecorateSagaStartMethod.
+type SagaStartOption func(o *sagaStartOptions)
+
+type sagaStartOptions struct {
+	businessKeyFunc reflect.Value
+	globalTxIdFunc  reflect.Value
+	ttl             time.Duration
+}
+
+// WithBusinessKey derives the global tx id of the saga from its business key, such as an order number,
+// and makes the saga start idempotent: a start with the business key of a saga started within the idempotent ttl
+// returns the outcome of the original start instead of running the saga twice.
+// The argument keyFunc is a function with the same parameters as the saga start method returning the business key, such as
+//
+//	saga.WithBusinessKey(func(orderNo string, amount int) string { return orderNo })
+func WithBusinessKey(keyFunc interface{}) SagaStartOption {
+	return func(o *sagaStartOptions) {
+		o.businessKeyFunc = reflect.ValueOf(keyFunc)
+	}
+}
+
+// WithGlobalTxId is like WithBusinessKey, but idFunc returns the global tx id itself, which must be unique in the coordinator.
+func WithGlobalTxId(idFunc interface{}) SagaStartOption {
+	return func(o *sagaStartOptions) {
+		o.globalTxIdFunc = reflect.ValueOf(idFunc)
+	}
+}
+
+// WithIdempotentTTL sets how long the outcome of an idempotent saga start is kept, defaults to constants.IDEMPOTENT_SAGA_TTL.
+func WithIdempotentTTL(ttl time.Duration) SagaStartOption {
+	return func(o *sagaStartOptions) {
+		o.ttl = ttl
+	}
+}
+
+func newSagaStartOptions(targetType reflect.Type, opts []SagaStartOption) (*sagaStartOptions, error) {
+	o := &sagaStartOptions{
+		ttl: constants.IDEMPOTENT_SAGA_TTL,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.businessKeyFunc.IsValid() && o.globalTxIdFunc.IsValid() {
+		return nil, errors.New("WithBusinessKey and WithGlobalTxId can not be used together")
+	}
+	if err := checkKeyFunc(targetType, o.keyFunc()); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func (o *sagaStartOptions) keyFunc() reflect.Value {
+	if o.businessKeyFunc.IsValid() {
+		return o.businessKeyFunc
+	}
+	return o.globalTxIdFunc
+}
+
+func (o *sagaStartOptions) idempotent() bool {
+	return o.keyFunc().IsValid()
+}
+
+// globalTxId returns the global tx id of the saga start method targetName with the arguments args.
+// The id derived from the business key is scoped by the service and the method, so the sagas of different methods
+// with the same business key, such as placing and cancelling an order, get different ids.
+func (o *sagaStartOptions) globalTxId(targetName string, targetType reflect.Type, args []reflect.Value) (string, error) {
+	var out []reflect.Value
+	if targetType.IsVariadic() {
+		out = o.keyFunc().CallSlice(args)
+	} else {
+		out = o.keyFunc().Call(args)
+	}
+	key := out[0].String()
+	if len(key) == 0 {
+		return "", errors.New("business key of the saga is empty")
+	}
+	if o.businessKeyFunc.IsValid() {
+		return sagactx.GlobalTxIdFromBusinessKey(sagaStartScope(targetName), key), nil
+	}
+	return key, nil
+}
+
+// sagaStartScope returns the scope of the business keys of the saga start method targetName.
+func sagaStartScope(targetName string) string {
+	var serviceName string
+	if serviceConfig != nil {
+		serviceName = serviceConfig.ServiceName
+	}
+	return serviceName + "/" + targetName
+}
+
+func checkKeyFunc(targetType reflect.Type, keyFunc reflect.Value) error {
+	if !keyFunc.IsValid() {
+		return nil
+	}
+	if keyFunc.Kind() != reflect.Func {
+		return errors.New("the business key of the saga must be a function")
+	}
+	keyType := keyFunc.Type()
+	if keyType.NumIn() != targetType.NumIn() || keyType.IsVariadic() != targetType.IsVariadic() {
+		return errors.New(fmt.Sprintf("the business key function %v must have the same parameters as the saga start method %v", keyType, targetType))
+	}
+	for i := 0; i < keyType.NumIn(); i++ {
+		if keyType.In(i) != targetType.In(i) {
+			return errors.New(fmt.Sprintf("the business key function %v must have the same parameters as the saga start method %v", keyType, targetType))
+		}
+	}
+	if keyType.NumOut() != 1 || keyType.Out(0).Kind() != reflect.String {
+		return errors.New(fmt.Sprintf("the business key function %v must return a string", keyType))
+	}
+	return nil
+}
+
+// sagaStartRecord is the outcome of an idempotent saga start.
+type sagaStartRecord struct {
+	done chan struct{}
+	// results are the results of the saga start method, nil if the saga failed to start
+	results []reflect.Value
+	err     error
+	// expiresAt is zero while the saga start method is running
+	expiresAt time.Time
+}
+
+// sagaStartCache detects the duplicate starts of the idempotent sagas in this process,
+// the records are kept by the saga start method and the global tx id.
+type sagaStartCache struct {
+	lock      sync.Mutex
+	records   map[string]*sagaStartRecord
+	lastSweep time.Time
+}
+
+var sagaStarts = &sagaStartCache{
+	records: make(map[string]*sagaStartRecord),
+}
+
+// start returns the record of the saga globalTxId started by the method targetName, and true if the saga has already been started.
+func (c *sagaStartCache) start(targetName string, globalTxId string) (*sagaStartRecord, bool) {
+	key := sagaStartKey(targetName, globalTxId)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	now := time.Now()
+	if now.Sub(c.lastSweep) > time.Minute {
+		for id, record := range c.records {
+			if !record.expiresAt.IsZero() && now.After(record.expiresAt) {
+				delete(c.records, id)
+			}
+		}
+		c.lastSweep = now
+	}
+	if record, ok := c.records[key]; ok && (record.expiresAt.IsZero() || now.Before(record.expiresAt)) {
+		return record, true
+	}
+	record := &sagaStartRecord{
+		done: make(chan struct{}),
+	}
+	c.records[key] = record
+	return record, false
+}
+
+// finish keeps the results of the saga start method for ttl.
+func (c *sagaStartCache) finish(record *sagaStartRecord, results []reflect.Value, ttl time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	record.results = results
+	record.expiresAt = time.Now().Add(ttl)
+	close(record.done)
+}
+
+// abandon forgets the saga globalTxId of the method targetName which failed to start, so that it can be started again.
+func (c *sagaStartCache) abandon(targetName string, globalTxId string, record *sagaStartRecord, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	key := sagaStartKey(targetName, globalTxId)
+	if c.records[key] == record {
+		delete(c.records, key)
+	}
+	record.err = err
+	close(record.done)
+}
+
+func sagaStartKey(targetName string, globalTxId string) string {
+	return targetName + "/" + globalTxId
+}
+
+// wait waits for the original saga start to finish and returns its results.
+func (r *sagaStartRecord) wait() ([]reflect.Value, error) {
+	<-r.done
+	if r.results == nil {
+		return nil, r.err
+	}
+	return r.results, nil
+}
@@ -0,0 +1,158 @@
+package saga
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jeremyxu2010/matrix-saga-go/config"
+)
+
+var (
+	placeOrderCalls  int32
+	cancelOrderCalls int32
+	placeOrderGate   chan struct{}
+)
+
+func placeOrder(orderNo string, amount int) (string, error) {
+	atomic.AddInt32(&placeOrderCalls, 1)
+	if placeOrderGate != nil {
+		<-placeOrderGate
+	}
+	return "placed " + orderNo, nil
+}
+
+func cancelOrder(orderNo string) (int, error) {
+	atomic.AddInt32(&cancelOrderCalls, 1)
+	return len(orderNo), nil
+}
+
+func orderNoOfPlaceOrder(orderNo string, amount int) string {
+	return orderNo
+}
+
+func orderNoOfCancelOrder(orderNo string) string {
+	return orderNo
+}
+
+// useIdempotentSagas decorates placeOrder and cancelOrder keyed by the order number with a stub transport.
+func useIdempotentSagas(t *testing.T, ttl time.Duration) (func(string, int) (string, error), func(string) (int, error), *stubTransport, func()) {
+	agentConfig.Store(config.NewAgentConfig())
+	stub, restore := useStubTransport()
+	atomic.StoreInt32(&placeOrderCalls, 0)
+	atomic.StoreInt32(&cancelOrderCalls, 0)
+	var place func(string, int) (string, error)
+	var cancel func(string) (int, error)
+	if err := DecorateSagaStartMethod(&place, placeOrder, 0, true, WithBusinessKey(orderNoOfPlaceOrder), WithIdempotentTTL(ttl)); err != nil {
+		t.Fatal(err)
+	}
+	if err := DecorateSagaStartMethod(&cancel, cancelOrder, 0, true, WithBusinessKey(orderNoOfCancelOrder), WithIdempotentTTL(ttl)); err != nil {
+		t.Fatal(err)
+	}
+	return place, cancel, stub, restore
+}
+
+// startedSagas returns the global tx ids of the sagas started through stub.
+func startedSagas(stub *stubTransport) []string {
+	var globalTxIds []string
+	for _, e := range stub.sent() {
+		if e.kind == "SagaStartedEvent" {
+			globalTxIds = append(globalTxIds, e.globalTxId)
+		}
+	}
+	return globalTxIds
+}
+
+func TestIdempotentSagaStartScopedByMethod(t *testing.T) {
+	place, cancel, stub, restore := useIdempotentSagas(t, time.Minute)
+	defer restore()
+	if got, err := place("order-scope", 10); err != nil || got != "placed order-scope" {
+		t.Fatalf("got %q, %v of placing the order", got, err)
+	}
+	if got, err := cancel("order-scope"); err != nil || got != len("order-scope") {
+		t.Fatalf("got %d, %v of cancelling the order", got, err)
+	}
+	if placeOrderCalls != 1 || cancelOrderCalls != 1 {
+		t.Errorf("got %d calls of placeOrder and %d calls of cancelOrder, want 1 and 1", placeOrderCalls, cancelOrderCalls)
+	}
+	globalTxIds := startedSagas(stub)
+	if len(globalTxIds) != 2 || globalTxIds[0] == globalTxIds[1] {
+		t.Errorf("got started sagas %v, want 2 sagas with different global tx ids", globalTxIds)
+	}
+}
+
+func TestIdempotentSagaStartReplay(t *testing.T) {
+	cases := []struct {
+		name      string
+		ttl       time.Duration
+		wait      time.Duration
+		wantCalls int32
+	}{
+		{"within ttl", time.Minute, 0, 1},
+		{"after ttl", time.Millisecond, 10 * time.Millisecond, 2},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			place, _, stub, restore := useIdempotentSagas(t, c.ttl)
+			defer restore()
+			orderNo := "order-replay-" + c.name
+			for i := 0; i < 2; i++ {
+				if got, err := place(orderNo, 10); err != nil || got != "placed "+orderNo {
+					t.Fatalf("got %q, %v of placing the order", got, err)
+				}
+				time.Sleep(c.wait)
+			}
+			if placeOrderCalls != c.wantCalls {
+				t.Errorf("got %d calls of placeOrder, want %d", placeOrderCalls, c.wantCalls)
+			}
+			globalTxIds := startedSagas(stub)
+			if len(globalTxIds) != int(c.wantCalls) {
+				t.Fatalf("got started sagas %v, want %d", globalTxIds, c.wantCalls)
+			}
+			for _, globalTxId := range globalTxIds {
+				if globalTxId != globalTxIds[0] {
+					t.Errorf("got started sagas %v, want the same global tx id", globalTxIds)
+				}
+			}
+		})
+	}
+}
+
+func TestIdempotentSagaStartConcurrentDuplicates(t *testing.T) {
+	place, _, stub, restore := useIdempotentSagas(t, time.Minute)
+	defer restore()
+	placeOrderGate = make(chan struct{})
+	defer func() {
+		placeOrderGate = nil
+	}()
+	const duplicates = 8
+	results := make([]string, duplicates)
+	errs := make([]error, duplicates)
+	var wg sync.WaitGroup
+	for i := 0; i < duplicates; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = place("order-concurrent", 10)
+		}(i)
+	}
+	// the duplicates wait for the original start, which is blocked until the gate is closed
+	for atomic.LoadInt32(&placeOrderCalls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(placeOrderGate)
+	wg.Wait()
+	for i := 0; i < duplicates; i++ {
+		if errs[i] != nil || results[i] != "placed order-concurrent" {
+			t.Errorf("got %q, %v of start %d", results[i], errs[i], i)
+		}
+	}
+	if placeOrderCalls != 1 {
+		t.Errorf("got %d calls of placeOrder, want 1", placeOrderCalls)
+	}
+	if globalTxIds := startedSagas(stub); len(globalTxIds) != 1 {
+		t.Errorf("got started sagas %v, want 1", globalTxIds)
+	}
+}
@@ -0,0 +1,195 @@
+package saga
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cosmos72/gls"
+	"github.com/jeremyxu2010/matrix-saga-go/constants"
+	sagactx "github.com/jeremyxu2010/matrix-saga-go/context"
+	"github.com/jeremyxu2010/matrix-saga-go/redact"
+	"reflect"
+)
+
+// The functions in this file drive the saga protocol without reflection.
+// They are used by the decorators of this package and by the code generated by cmd/saga-gen.
+
+// BeginSaga starts a global transaction in the current goroutine before the saga start method is executed.
+// The argument method is the name of the saga start method.
+func BeginSaga(method string, timeout int) error {
+	return beginSaga(method, "", timeout)
+}
+
+// BeginSagaWithGlobalTxId is like BeginSaga, but starts the global transaction globalTxId,
+// such as the one derived from a business key by sagactx.GlobalTxIdFromBusinessKey.
+func BeginSagaWithGlobalTxId(method string, globalTxId string, timeout int) error {
+	return beginSaga(method, globalTxId, timeout)
+}
+
+func beginSaga(method string, globalTxId string, timeout int) error {
+	if !methodEnabled(method) {
+		// FinishSaga follows the decision, even if the disabled methods are changed by UpdateConfig meanwhile
+		gls.Set(constants.KEY_SAGA_DISABLED, true)
+		return nil
+	}
+	gls.Del(constants.KEY_SAGA_DISABLED)
+	sagaAgentCtx := sagactx.NewSagaAgentContext()
+	if len(globalTxId) > 0 {
+		sagaAgentCtx.InitializeWithGlobalTxId(globalTxId)
+	} else {
+		sagaAgentCtx.Initialize()
+	}
+	_, err := transportContractor.SendSagaStartedEvent(sagaAgentCtx, timeout)
+	if err != nil {
+		transportContractor.SendTxAbortedEvent(sagaAgentCtx, "", method, err)
+		return err
+	}
+	logger.LogDebug(fmt.Sprintf("Initialized context %v before execution of method %v", sagaAgentCtx, method))
+	return nil
+}
+
+// FinishSaga finishes the global transaction of the current goroutine after the saga start or saga end method is executed.
+// The argument callErr is the error returned by the method.
+// The global transaction is only ended when autoClose is true, otherwise it is left open for a saga end method.
+func FinishSaga(method string, callErr error, autoClose bool) error {
+	_, disabled := gls.Get(constants.KEY_SAGA_DISABLED)
+	defer func() {
+		if autoClose {
+			sagactx.ClearSagaAgentContext()
+			gls.Del(constants.KEY_SAGA_DISABLED)
+		}
+	}()
+	if disabled {
+		// the saga was disabled for the saga start method, BeginSaga started no global transaction
+		return callErr
+	}
+	sagaAgentCtx, err := sagactx.GetSagaAgentContext()
+	if err != nil {
+		if !methodEnabled(method) {
+			// the saga is disabled for the saga end method, which is not called after a saga start method in this goroutine
+			return callErr
+		}
+		logger.LogError(fmt.Sprintf("Transaction of method %s failed, %v", method, redact.Sprint(err)))
+		return err
+	}
+	if callErr != nil {
+		transportContractor.SendTxAbortedEvent(sagaAgentCtx, "", method, callErr)
+		logger.LogError(fmt.Sprintf("Transaction %v failed, %v", sagaAgentCtx, redact.Sprint(callErr)))
+		return callErr
+	}
+	if !autoClose {
+		logger.LogDebug(fmt.Sprintf("Transaction with context %v is not finished in the SagaStarted annotated method.", sagaAgentCtx))
+		return nil
+	}
+	aborted, err := transportContractor.SendSagaEndedEvent(sagaAgentCtx)
+	if err != nil {
+		transportContractor.SendTxAbortedEvent(sagaAgentCtx, "", method, err)
+		logger.LogError(fmt.Sprintf("Transaction %v failed, %v", sagaAgentCtx, redact.Sprint(err)))
+		return err
+	}
+
+	if aborted {
+		return errors.New(fmt.Sprintf("transaction %s is aborted", sagaAgentCtx.GlobalTxId))
+	}
+	logger.LogDebug(fmt.Sprintf("Transaction with context %v has finished.", sagaAgentCtx))
+	return nil
+}
+
+// PanicError returns the error reporting the panic cause of a saga method to FinishSaga or CompensableTx.Finish,
+// or the exit of the method by runtime.Goexit if cause is nil. It is used by the code generated by cmd/saga-gen.
+func PanicError(cause interface{}) error {
+	switch c := cause.(type) {
+	case nil:
+		return errors.New("method exited without returning")
+	case error:
+		return c
+	default:
+		return errors.New(fmt.Sprintf("method panicked, %v", c))
+	}
+}
+
+// CompensableTx is a sub transaction started by BeginCompensable.
+type CompensableTx struct {
+	method             string
+	compensationMethod string
+	parentLocalTxId    string
+	sagaAgentCtx       *sagactx.SagaAgentContext
+	// disabled is true if the saga is disabled for the method, the method runs without a sub transaction
+	disabled bool
+}
+
+// RegisterCompensation registers the compensation function fn with the name used by BeginCompensable.
+func RegisterCompensation(compensationMethod string, fn interface{}, opts ...CompensableOption) {
+	compensationProcessor.RegisterCompensationFunc(compensationMethod, fn)
+	applyCompensableOptions(compensationMethod, opts)
+}
+
+// BeginCompensable starts a sub transaction of the global transaction in the current goroutine before the compensable method is executed.
+// The argument args is the argument list of the compensable method, which is passed to the compensation method on compensation.
+// The arguments of a variadic parameter must be passed as a slice.
+func BeginCompensable(method string, compensationMethod string, timeout int, args ...interface{}) (*CompensableTx, error) {
+	values := make([]reflect.Value, 0, len(args))
+	for _, arg := range args {
+		values = append(values, reflect.ValueOf(arg))
+	}
+	return beginCompensable(method, compensationMethod, timeout, values)
+}
+
+func beginCompensable(method string, compensationMethod string, timeout int, args []reflect.Value) (*CompensableTx, error) {
+	if !methodEnabled(method) {
+		return &CompensableTx{method: method, compensationMethod: compensationMethod, disabled: true}, nil
+	}
+	sagaAgentCtx, err := sagactx.GetSagaAgentContext()
+	if err != nil {
+		return nil, err
+	}
+	parentLocalTxId := sagaAgentCtx.LocalTxId
+	sagaAgentCtx.NewLocalTxId()
+	logger.LogDebug(fmt.Sprintf("Updated context %v for compensable method %v", sagaAgentCtx, method))
+	logger.LogDebug(fmt.Sprintf("Intercepting compensable method %v with context %v", method, sagaAgentCtx))
+	aborted, err := transportContractor.SendTxStartedEvent(sagaAgentCtx, parentLocalTxId, compensationMethod, timeout, args)
+	if err != nil {
+		sagaAgentCtx.LocalTxId = parentLocalTxId
+		logger.LogDebug(fmt.Sprintf("Restored context back to %v", sagaAgentCtx))
+		return nil, err
+	}
+	if aborted {
+		abortedLocalTxId := sagaAgentCtx.LocalTxId
+		sagaAgentCtx.LocalTxId = parentLocalTxId
+		logger.LogDebug(fmt.Sprintf("Restored context back to %v", sagaAgentCtx))
+		return nil, errors.New(fmt.Sprintf("Abort sub transaction %s because global transaction %s has already aborted.", abortedLocalTxId, sagaAgentCtx.GlobalTxId))
+	}
+	return &CompensableTx{
+		method:             method,
+		compensationMethod: compensationMethod,
+		parentLocalTxId:    parentLocalTxId,
+		sagaAgentCtx:       sagaAgentCtx,
+	}, nil
+}
+
+// Finish finishes the sub transaction after the compensable method is executed.
+// The argument callErr is the error returned by the compensable method.
+func (tx *CompensableTx) Finish(callErr error) error {
+	if tx.disabled {
+		return callErr
+	}
+	sagaAgentCtx := tx.sagaAgentCtx
+	defer func() {
+		sagaAgentCtx.LocalTxId = tx.parentLocalTxId
+		logger.LogDebug(fmt.Sprintf("Restored context back to %v", sagaAgentCtx))
+	}()
+	if callErr != nil {
+		transportContractor.SendTxAbortedEvent(sagaAgentCtx, "", tx.method, callErr)
+		logger.LogError(fmt.Sprintf("Transaction %v failed, %v", sagaAgentCtx, redact.Sprint(callErr)))
+		return callErr
+	}
+	aborted, err := transportContractor.SendTxEndedEvent(sagaAgentCtx, tx.parentLocalTxId, tx.compensationMethod)
+	if err != nil {
+		transportContractor.SendTxAbortedEvent(sagaAgentCtx, "", tx.method, err)
+		logger.LogError(fmt.Sprintf("Transaction %v failed, %v", sagaAgentCtx, redact.Sprint(err)))
+		return err
+	}
+	if aborted {
+		return errors.New(fmt.Sprintf("transaction %s is aborted", tx.parentLocalTxId))
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package saga
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jeremyxu2010/matrix-saga-go/config"
+	sagactx "github.com/jeremyxu2010/matrix-saga-go/context"
+	"github.com/jeremyxu2010/matrix-saga-go/log"
+)
+
+func init() {
+	logger = log.NewNoopLogger()
+}
+
+func setDisabledMethods(methods ...string) {
+	c := config.NewAgentConfig()
+	c.DisabledMethods = methods
+	agentConfig.Store(c)
+}
+
+func TestFinishSagaFollowsBeginSaga(t *testing.T) {
+	defer agentConfig.Store(config.NewAgentConfig())
+	callErr := errors.New("failed")
+	cases := []struct {
+		name      string
+		callErr   error
+		autoClose bool
+	}{
+		{"succeeded", nil, true},
+		{"failed", callErr, true},
+		{"left open", nil, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			setDisabledMethods("main.*")
+			if err := BeginSaga("main.TransferMoney", 10); err != nil {
+				t.Fatal(err)
+			}
+			// the saga is enabled for the method while it is running
+			setDisabledMethods()
+			if err := FinishSaga("main.TransferMoney", c.callErr, c.autoClose); err != c.callErr {
+				t.Errorf("got error %v, want %v", err, c.callErr)
+			}
+			if !c.autoClose {
+				if err := FinishSaga("main.EndTransferMoney", nil, true); err != nil {
+					t.Errorf("saga end method failed, %v", err)
+				}
+			}
+			if _, err := sagactx.GetSagaAgentContext(); err == nil {
+				t.Error("saga agent context is set")
+			}
+			// the next saga of the goroutine does not follow the decision any more
+			if err := FinishSaga("main.TransferMoney", nil, true); err == nil {
+				t.Error("saga without context finished")
+			}
+		})
+	}
+}
+
+func TestPanicError(t *testing.T) {
+	cause := errors.New("insufficient balance")
+	cases := []struct {
+		name  string
+		cause interface{}
+		want  string
+	}{
+		{"error", cause, "insufficient balance"},
+		{"string", "boom", "method panicked, boom"},
+		{"value", 42, "method panicked, 42"},
+		{"goexit", nil, "method exited without returning"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := PanicError(c.cause); err == nil || err.Error() != c.want {
+				t.Errorf("got error %v, want %q", err, c.want)
+			}
+		})
+	}
+	if err := PanicError(cause); err != cause {
+		t.Errorf("got error %v, want the panic cause", err)
+	}
+}
+
+func TestCompensableMethodsInBranches(t *testing.T) {
+	const globalTxId = "saga-test-global-tx"
+	agentConfig.Store(config.NewAgentConfig())
+	stub, restore := useStubTransport()
+	defer restore()
+	unbind := ResumeSaga(globalTxId)
+	defer unbind()
+	parent, err := BeginCompensable("main.Reserve", "main.CancelReserve", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parentLocalTxId := parent.sagaAgentCtx.LocalTxId
+
+	var g sagactx.Group
+	for i := 0; i < 3; i++ {
+		g.Go(func() error {
+			tx, err := BeginCompensable("main.Ship", "main.CancelShip", 0)
+			if err != nil {
+				return err
+			}
+			return tx.Finish(nil)
+		})
+	}
+	if err := g.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if err := parent.Finish(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	branchLocalTxIds := make(map[string]bool)
+	for _, event := range stub.sent() {
+		if event.compensationMethod != "main.CancelShip" || event.kind != "TxStartedEvent" {
+			continue
+		}
+		if event.parentTxId != parentLocalTxId {
+			t.Errorf("branch %s got parent tx id %s, want %s", event.localTxId, event.parentTxId, parentLocalTxId)
+		}
+		branchLocalTxIds[event.localTxId] = true
+	}
+	if len(branchLocalTxIds) != 3 {
+		t.Errorf("got %d branches with distinct local tx ids, want 3", len(branchLocalTxIds))
+	}
+	// the context of the caller is restored by the compensable method of the caller only
+	sagaAgentCtx := sagactx.MustGetSagaAgentContext()
+	if sagaAgentCtx.GlobalTxId != globalTxId || sagaAgentCtx.LocalTxId != globalTxId {
+		t.Errorf("got context %v of the caller, want the root of %s", sagaAgentCtx, globalTxId)
+	}
+}
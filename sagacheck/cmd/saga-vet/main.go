@@ -0,0 +1,19 @@
+// Command saga-vet reports misuse of the saga decorators.
+//
+// It can be run standalone:
+//
+//	saga-vet ./...
+//
+// or as a tool of go vet:
+//
+//	go vet -vettool=$(which saga-vet) ./...
+package main
+
+import (
+	"github.com/jeremyxu2010/matrix-saga-go/sagacheck"
+	"golang.org/x/tools/go/analysis/singlechecker"
+)
+
+func main() {
+	singlechecker.Main(sagacheck.Analyzer)
+}
@@ -0,0 +1,321 @@
+// Package sagacheck defines an Analyzer that reports misuse of the saga decorators.
+package sagacheck
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+const Doc = `check for misuse of the saga decorators
+
+The sagacheck analyzer inspects the calls to saga.DecorateSagaStartMethod,
+saga.DecorateSagaEndMethod, saga.DecorateCompensableMethod, saga.RegisterParticipant
+and saga.DecorateParticipantMethod, and reports:
+
+- decorated functions that do not return error as their last result,
+- decorated function variables whose type differs from the decorated function,
+- compensation functions whose parameters mismatch the compensable function,
+- compensable parameters that can not be encoded by gob, such as funcs, channels
+  and structs with unexported fields,
+- direct calls to a compensable function inside a saga, where its decorated
+  function should be called instead.`
+
+const sagaPkgPath = "github.com/jeremyxu2010/matrix-saga-go"
+
+var Analyzer = &analysis.Analyzer{
+	Name:     "sagacheck",
+	Doc:      Doc,
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+var errorType = types.Universe.Lookup("error").Type()
+
+type checker struct {
+	pass *analysis.Pass
+	// compensables maps a compensable function to the variable holding its decorated function.
+	compensables map[*types.Func]types.Object
+	// sagaFuncs holds the functions executed inside a saga.
+	sagaFuncs map[*types.Func]bool
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	c := &checker{
+		pass:         pass,
+		compensables: make(map[*types.Func]types.Object),
+		sagaFuncs:    make(map[*types.Func]bool),
+	}
+	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+
+	inspect.Preorder([]ast.Node{(*ast.CallExpr)(nil)}, func(n ast.Node) {
+		call := n.(*ast.CallExpr)
+		fn, ok := typeutil.Callee(pass.TypesInfo, call).(*types.Func)
+		if !ok || fn.Pkg() == nil || fn.Pkg().Path() != sagaPkgPath {
+			return
+		}
+		switch fn.Name() {
+		case "DecorateSagaStartMethod", "DecorateSagaEndMethod":
+			if len(call.Args) >= 2 {
+				c.checkDecorated(call.Args[0], call.Args[1])
+				if target := funcOf(pass.TypesInfo, call.Args[1]); target != nil {
+					c.sagaFuncs[target] = true
+				}
+			}
+		case "DecorateCompensableMethod":
+			if len(call.Args) >= 3 {
+				c.checkCompensable(call.Args[0], call.Args[1], call.Args[2])
+			}
+		case "RegisterParticipant":
+			if len(call.Args) >= 2 {
+				c.checkParticipant(call.Args[0], call.Args[1])
+			}
+		case "DecorateParticipantMethod":
+			if len(call.Args) >= 3 {
+				c.checkParticipantMethod(call.Args[0], call.Args[1], call.Args[2])
+			}
+		}
+	})
+
+	if len(c.compensables) == 0 {
+		return nil, nil
+	}
+	inspect.Preorder([]ast.Node{(*ast.FuncDecl)(nil)}, func(n ast.Node) {
+		decl := n.(*ast.FuncDecl)
+		fn, ok := pass.TypesInfo.Defs[decl.Name].(*types.Func)
+		if !ok || !c.sagaFuncs[fn] || decl.Body == nil {
+			return
+		}
+		ast.Inspect(decl.Body, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			callee, ok := typeutil.Callee(pass.TypesInfo, call).(*types.Func)
+			if !ok {
+				return true
+			}
+			if decorated, ok := c.compensables[callee]; ok {
+				pass.Reportf(call.Pos(), "call to compensable function %s inside saga bypasses the saga agent, call %s instead", callee.Name(), decorated.Name())
+			}
+			return true
+		})
+	})
+	return nil, nil
+}
+
+// checkDecorated checks the decorated function variable and the target function,
+// and returns the signature of the target function if it is valid.
+func (c *checker) checkDecorated(ptrArg ast.Expr, targetArg ast.Expr) *types.Signature {
+	sig := sigOf(c.pass.TypesInfo.TypeOf(targetArg))
+	if sig == nil {
+		c.pass.Reportf(targetArg.Pos(), "decorated target %s is not a function", types.ExprString(targetArg))
+		return nil
+	}
+	results := sig.Results()
+	if results.Len() == 0 || !types.Identical(results.At(results.Len()-1).Type(), errorType) {
+		c.pass.Reportf(targetArg.Pos(), "decorated function %s does not return error as its last result", types.ExprString(targetArg))
+	}
+	if ptr, ok := c.pass.TypesInfo.TypeOf(ptrArg).(*types.Pointer); !ok {
+		c.pass.Reportf(ptrArg.Pos(), "decorated function variable %s is not a pointer", types.ExprString(ptrArg))
+	} else if !types.Identical(ptr.Elem().Underlying(), sig) {
+		c.pass.Reportf(ptrArg.Pos(), "type %s of decorated function variable does not match type %s of decorated function", ptr.Elem(), sig)
+	}
+	return sig
+}
+
+func (c *checker) checkCompensable(ptrArg ast.Expr, targetArg ast.Expr, compensationArg ast.Expr) {
+	sig := c.checkDecorated(ptrArg, targetArg)
+	if sig == nil {
+		return
+	}
+	if target := funcOf(c.pass.TypesInfo, targetArg); target != nil {
+		if decorated := varOf(c.pass.TypesInfo, ptrArg); decorated != nil {
+			c.compensables[target] = decorated
+		}
+		// a compensable function is executed inside a saga as well
+		c.sagaFuncs[target] = true
+	}
+	compensation := sigOf(c.pass.TypesInfo.TypeOf(compensationArg))
+	if compensation == nil {
+		c.pass.Reportf(compensationArg.Pos(), "compensation %s is not a function", types.ExprString(compensationArg))
+		return
+	}
+	c.checkCompensationSignature(compensationArg.Pos(), types.ExprString(compensationArg), types.ExprString(targetArg), sig, compensation)
+	c.checkGobEncodable(targetArg.Pos(), sig)
+}
+
+func (c *checker) checkCompensationSignature(pos token.Pos, compensationName string, targetName string, sig *types.Signature, compensation *types.Signature) {
+	if !types.Identical(sig.Params(), compensation.Params()) || sig.Variadic() != compensation.Variadic() {
+		c.pass.Reportf(pos, "parameters %s of compensation %s do not match parameters %s of compensable function %s", compensation.Params(), compensationName, sig.Params(), targetName)
+	}
+}
+
+// checkParticipant checks the compensation methods given as a map literal to saga.RegisterParticipant.
+func (c *checker) checkParticipant(participantArg ast.Expr, compensationsArg ast.Expr) {
+	lit, ok := compensationsArg.(*ast.CompositeLit)
+	if !ok {
+		return
+	}
+	participant := c.pass.TypesInfo.TypeOf(participantArg)
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		method := c.lookupMethod(participant, kv.Key)
+		compensation := c.lookupMethod(participant, kv.Value)
+		if method == nil || compensation == nil {
+			continue
+		}
+		sig := method.Type().(*types.Signature)
+		c.checkCompensationSignature(kv.Value.Pos(), compensation.Name(), method.Name(), sig, compensation.Type().(*types.Signature))
+		c.checkGobEncodable(kv.Key.Pos(), sig)
+	}
+}
+
+func (c *checker) checkParticipantMethod(ptrArg ast.Expr, participantArg ast.Expr, methodArg ast.Expr) {
+	method := c.lookupMethod(c.pass.TypesInfo.TypeOf(participantArg), methodArg)
+	if method == nil {
+		return
+	}
+	sig := method.Type().(*types.Signature)
+	results := sig.Results()
+	if results.Len() == 0 || !types.Identical(results.At(results.Len()-1).Type(), errorType) {
+		c.pass.Reportf(methodArg.Pos(), "decorated method %s does not return error as its last result", method.Name())
+	}
+	if ptr, ok := c.pass.TypesInfo.TypeOf(ptrArg).(*types.Pointer); !ok {
+		c.pass.Reportf(ptrArg.Pos(), "decorated function variable %s is not a pointer", types.ExprString(ptrArg))
+	} else if decoratedSig := sigOf(ptr.Elem()); decoratedSig == nil || !types.Identical(decoratedSig, sig) {
+		c.pass.Reportf(ptrArg.Pos(), "type %s of decorated function variable does not match method %s", ptr.Elem(), method.Name())
+	}
+	if decorated := varOf(c.pass.TypesInfo, ptrArg); decorated != nil {
+		c.compensables[method] = decorated
+	}
+	c.sagaFuncs[method] = true
+}
+
+// lookupMethod returns the method of typ named by the constant string expression nameArg.
+func (c *checker) lookupMethod(typ types.Type, nameArg ast.Expr) *types.Func {
+	tv, ok := c.pass.TypesInfo.Types[nameArg]
+	if typ == nil || !ok || tv.Value == nil || tv.Value.Kind() != constant.String {
+		return nil
+	}
+	name := constant.StringVal(tv.Value)
+	obj, _, _ := types.LookupFieldOrMethod(typ, true, nil, name)
+	method, ok := obj.(*types.Func)
+	if !ok || !method.Exported() {
+		c.pass.Reportf(nameArg.Pos(), "%s has no exported method %s", typ, name)
+		return nil
+	}
+	return method
+}
+
+// checkGobEncodable reports the parameters of a compensable function which can not be encoded by gob.
+func (c *checker) checkGobEncodable(pos token.Pos, sig *types.Signature) {
+	params := sig.Params()
+	for i := 0; i < params.Len(); i++ {
+		if reason := gobUnencodable(params.At(i).Type(), make(map[types.Type]bool)); reason != "" {
+			c.pass.Reportf(pos, "parameter %d of type %s can not be encoded by gob: %s", i, params.At(i).Type(), reason)
+		}
+	}
+}
+
+func gobUnencodable(t types.Type, seen map[types.Type]bool) string {
+	if seen[t] {
+		return ""
+	}
+	seen[t] = true
+	if implementsGobEncoder(t) {
+		return ""
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Signature:
+		return "funcs are not supported"
+	case *types.Chan:
+		return "channels are not supported"
+	case *types.Basic:
+		if u.Kind() == types.UnsafePointer {
+			return "unsafe pointers are not supported"
+		}
+	case *types.Pointer:
+		return gobUnencodable(u.Elem(), seen)
+	case *types.Slice:
+		return gobUnencodable(u.Elem(), seen)
+	case *types.Array:
+		return gobUnencodable(u.Elem(), seen)
+	case *types.Map:
+		if reason := gobUnencodable(u.Key(), seen); reason != "" {
+			return reason
+		}
+		return gobUnencodable(u.Elem(), seen)
+	case *types.Struct:
+		exported := 0
+		for i := 0; i < u.NumFields(); i++ {
+			f := u.Field(i)
+			if !f.Exported() {
+				return "unexported field " + f.Name() + " of " + t.String() + " is not encoded"
+			}
+			exported++
+			if reason := gobUnencodable(f.Type(), seen); reason != "" {
+				return reason
+			}
+		}
+		if exported == 0 {
+			return t.String() + " has no exported fields"
+		}
+	}
+	return ""
+}
+
+func implementsGobEncoder(t types.Type) bool {
+	mset := types.NewMethodSet(types.NewPointer(t))
+	for _, name := range []string{"GobEncode", "MarshalBinary"} {
+		if sel := mset.Lookup(nil, name); sel != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func funcOf(info *types.Info, expr ast.Expr) *types.Func {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		fn, _ := info.Uses[e].(*types.Func)
+		return fn
+	case *ast.SelectorExpr:
+		fn, _ := info.Uses[e.Sel].(*types.Func)
+		return fn
+	case *ast.ParenExpr:
+		return funcOf(info, e.X)
+	}
+	return nil
+}
+
+func varOf(info *types.Info, ptrArg ast.Expr) types.Object {
+	unary, ok := ptrArg.(*ast.UnaryExpr)
+	if !ok || unary.Op != token.AND {
+		return nil
+	}
+	switch e := unary.X.(type) {
+	case *ast.Ident:
+		return info.Uses[e]
+	case *ast.SelectorExpr:
+		return info.Uses[e.Sel]
+	}
+	return nil
+}
+
+func sigOf(t types.Type) *types.Signature {
+	if t == nil {
+		return nil
+	}
+	sig, _ := t.Underlying().(*types.Signature)
+	return sig
+}
@@ -0,0 +1,12 @@
+package sagacheck_test
+
+import (
+	"testing"
+
+	"github.com/jeremyxu2010/matrix-saga-go/sagacheck"
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+func TestAnalyzer(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), sagacheck.Analyzer, "a")
+}
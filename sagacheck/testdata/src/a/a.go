@@ -0,0 +1,93 @@
+package a
+
+import (
+	"unsafe"
+
+	saga "github.com/jeremyxu2010/matrix-saga-go"
+)
+
+type Order struct {
+	Id     string
+	Amount int
+}
+
+type Account struct {
+	Id       string
+	password string
+}
+
+type Empty struct{}
+
+type Token struct {
+	value string
+}
+
+func (t *Token) GobEncode() ([]byte, error) {
+	return []byte(t.value), nil
+}
+
+var (
+	transferMoney func(o Order) error
+	notify        func(o Order)
+	pay           func(o Order) error
+	refund        func(id string, amount int) error
+	watch         func(c chan int) error
+	callback      func(f func()) error
+	raw           func(p unsafe.Pointer) error
+	login         func(a Account) error
+	clear         func(e Empty) error
+	sign          func(t Token) error
+)
+
+func TransferMoney(o Order) error {
+	new(Shop).Buy(o) // want "call to compensable function Buy inside saga bypasses the saga agent, call buy instead"
+	if err := pay(o); err != nil {
+		return err
+	}
+	return Pay(o) // want "call to compensable function Pay inside saga bypasses the saga agent, call pay instead"
+}
+
+func Notify(o Order) {}
+
+func Pay(o Order) error { return nil }
+
+func CancelPay(o Order) error { return nil }
+
+func Refund(id string, amount int) error { return nil }
+
+func CancelRefund(id string) error { return nil }
+
+func Watch(c chan int) error { return nil }
+
+func Callback(f func()) error { return nil }
+
+func Raw(p unsafe.Pointer) error { return nil }
+
+func Login(a Account) error { return nil }
+
+func Clear(e Empty) error { return nil }
+
+func Sign(t Token) error { return nil }
+
+// PayLater is not executed inside a saga, so it may call the compensable function.
+func PayLater(o Order) error {
+	return Pay(o)
+}
+
+func init() {
+	saga.DecorateSagaStartMethod(&transferMoney, TransferMoney, 10, true)
+	saga.DecorateSagaEndMethod(&notify, Notify)              // want "decorated function Notify does not return error as its last result"
+	saga.DecorateSagaEndMethod(transferMoney, TransferMoney) // want "decorated function variable transferMoney is not a pointer"
+	saga.DecorateSagaEndMethod(&refund, TransferMoney)       // want "type .* of decorated function variable does not match type .* of decorated function"
+	saga.DecorateSagaEndMethod(&transferMoney, 1)            // want "decorated target 1 is not a function"
+
+	saga.DecorateCompensableMethod(&pay, Pay, CancelPay, 10)
+	saga.DecorateCompensableMethod(&refund, Refund, CancelRefund, 10) // want "parameters .* of compensation CancelRefund do not match parameters .* of compensable function Refund"
+	saga.DecorateCompensableMethod(&pay, Pay, "CancelPay", 10)        // want `compensation "CancelPay" is not a function`
+	saga.DecorateCompensableMethod(&watch, Watch, Watch, 10)          // want "parameter 0 of type chan int can not be encoded by gob: channels are not supported"
+	saga.DecorateCompensableMethod(&callback, Callback, Callback, 10) // want "parameter 0 of type func\\(\\) can not be encoded by gob: funcs are not supported"
+	saga.DecorateCompensableMethod(&raw, Raw, Raw, 10)                // want "parameter 0 of type unsafe.Pointer can not be encoded by gob: unsafe pointers are not supported"
+	saga.DecorateCompensableMethod(&login, Login, Login, 10)          // want "parameter 0 of type a.Account can not be encoded by gob: unexported field password of a.Account is not encoded"
+	saga.DecorateCompensableMethod(&clear, Clear, Clear, 10)          // want "parameter 0 of type a.Empty can not be encoded by gob: a.Empty has no exported fields"
+	saga.DecorateCompensableMethod(&sign, Sign, Sign, 10)
+}
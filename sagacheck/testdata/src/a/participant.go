@@ -0,0 +1,44 @@
+package a
+
+import (
+	saga "github.com/jeremyxu2010/matrix-saga-go"
+)
+
+type Shop struct{}
+
+func (s *Shop) Buy(o Order) error { return nil }
+
+func (s *Shop) CancelBuy(o Order) error { return nil }
+
+func (s *Shop) Sell(id string) error { return nil }
+
+func (s *Shop) CancelSell(o Order) error { return nil }
+
+func (s *Shop) Pack(c chan int) error { return nil }
+
+func (s *Shop) CancelPack(c chan int) error { return nil }
+
+func (s *Shop) Ship(o Order) {}
+
+func (s *Shop) cancelShip(o Order) error { return nil }
+
+var (
+	buy  func(o Order) error
+	sell func(id string) error
+	ship func(o Order)
+)
+
+func init() {
+	saga.RegisterParticipant(&Shop{}, map[string]string{
+		"Buy":  "CancelBuy",
+		"Sell": "CancelSell", // want "parameters .* of compensation CancelSell do not match parameters .* of compensable function Sell"
+		"Pack": "CancelPack", // want "parameter 0 of type chan int can not be encoded by gob: channels are not supported"
+		"Ship": "cancelShip", // want `\*a.Shop has no exported method cancelShip`
+		"Drop": "CancelBuy",  // want `\*a.Shop has no exported method Drop`
+	})
+
+	saga.DecorateParticipantMethod(&buy, &Shop{}, "Buy", 10)
+	saga.DecorateParticipantMethod(&ship, &Shop{}, "Ship", 10) // want "decorated method Ship does not return error as its last result"
+	saga.DecorateParticipantMethod(buy, &Shop{}, "Buy", 10)    // want "decorated function variable buy is not a pointer"
+	saga.DecorateParticipantMethod(&sell, &Shop{}, "Pack", 10) // want "type .* of decorated function variable does not match method Pack"
+}
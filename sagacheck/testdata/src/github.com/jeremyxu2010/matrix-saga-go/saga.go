@@ -0,0 +1,22 @@
+// Package saga stubs the decorators of the saga agent checked by sagacheck.
+package saga
+
+func DecorateSagaStartMethod(sagaStartPtr interface{}, target interface{}, timeout int, autoClose bool) error {
+	return nil
+}
+
+func DecorateSagaEndMethod(sagaStartPtr interface{}, target interface{}) error {
+	return nil
+}
+
+func DecorateCompensableMethod(compensablePtr interface{}, target interface{}, compensed interface{}, timeout int) error {
+	return nil
+}
+
+func RegisterParticipant(participantInstance interface{}, compensations map[string]string) error {
+	return nil
+}
+
+func DecorateParticipantMethod(compensablePtr interface{}, participantInstance interface{}, method string, timeout int) error {
+	return nil
+}
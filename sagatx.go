@@ -11,63 +11,97 @@ import (
 	"github.com/jeremyxu2010/matrix-saga-go/log"
 	"github.com/jeremyxu2010/matrix-saga-go/metadata"
 	"github.com/jeremyxu2010/matrix-saga-go/processor"
+	"github.com/jeremyxu2010/matrix-saga-go/redact"
 	"github.com/jeremyxu2010/matrix-saga-go/serializer"
 	"github.com/jeremyxu2010/matrix-saga-go/transport"
 	"github.com/jeremyxu2010/matrix-saga-go/utils"
 	"reflect"
+	"strings"
 	"sync"
 )
 
 var (
-	initOnce sync.Once
+	// initLock guards the initialization of the saga agent, see initSagaAgent
+	initLock sync.Mutex
 
 	compensationProcessor *processor.CompensationProcessor
 	serviceConfig         *config.ServiceConfig
-	transportContractor   *transport.TransportContractor
+	transportContractor   sagaTransport
 	s                     serializer.Serializer
 
 	logger log.Logger
 )
 
+// sagaTransport sends the events of the transactions to the coordinator, it is implemented by transport.TransportContractor.
+type sagaTransport interface {
+	Connect() error
+	UpdateConfig(agentConfig *config.AgentConfig)
+	SendSagaStartedEvent(sagaAgentCtx *sagactx.SagaAgentContext, timeout int) (bool, error)
+	SendSagaEndedEvent(sagaAgentCtx *sagactx.SagaAgentContext) (bool, error)
+	SendTxStartedEvent(sagaAgentCtx *sagactx.SagaAgentContext, parentTxId string, compensationMethod string, timeout int, args []reflect.Value) (bool, error)
+	SendTxEndedEvent(sagaAgentCtx *sagactx.SagaAgentContext, parentTxId string, compensationMethod string) (bool, error)
+	SendTxAbortedEvent(sagaAgentCtx *sagactx.SagaAgentContext, parentTxId string, compensationMethod string, err error) (bool, error)
+}
+
 func init() {
 	s = serializer.NewGobSerializer()
 	compensationProcessor = processor.NewCompensationProcessor(s, logger)
 }
 
-func DecorateSagaStartMethod(sagaStartPtr interface{}, target interface{}, timeout int, autoClose bool) error {
+// DecorateSagaStartMethod decorates the saga start method target into sagaStartPtr.
+// The global transaction is ended when the decorated method returns if autoClose is true, otherwise by a saga end method or EndSaga.
+// Use WithBusinessKey or WithGlobalTxId in opts to make the saga start idempotent.
+func DecorateSagaStartMethod(sagaStartPtr interface{}, target interface{}, timeout int, autoClose bool, opts ...SagaStartOption) error {
+	targetName := utils.GetFnName(target)
+	targetType := reflect.TypeOf(target)
+	if targetType == nil || targetType.Kind() != reflect.Func {
+		return errors.New("Input target para is not a function.")
+	}
+	o, err := newSagaStartOptions(targetType, opts)
+	if err != nil {
+		return err
+	}
+
 	sagaStartInjectBefore := func(ctx context.Context) error {
-		sagaAgentCtx := sagactx.NewSagaAgentContext()
-		sagaAgentCtx.Initialize()
-		_, err := transportContractor.SendSagaStartedEvent(sagaAgentCtx, timeout)
+		if !o.idempotent() {
+			return BeginSaga(targetName, timeout)
+		}
+		m, _ := metadata.FromContext(ctx)
+		args, _ := m[constants.KEY_FUNCTION_CALL_ARGS].([]reflect.Value)
+		globalTxId, err := o.globalTxId(targetName, targetType, args)
 		if err != nil {
-			transportContractor.SendTxAbortedEvent(sagaAgentCtx, "", utils.GetFnName(target), err)
 			return err
 		}
-		logger.LogDebug(fmt.Sprintf("Initialized context %v before execution of method %v", sagaAgentCtx, target))
+		record, started := sagaStarts.start(targetName, globalTxId)
+		if started {
+			logger.LogDebug(fmt.Sprintf("Transaction %s of method %s has already been started, returning its outcome", globalTxId, targetName))
+			results, err := record.wait()
+			if err != nil {
+				return err
+			}
+			m[constants.KEY_FUNCTION_CALL_RESULTS] = results
+			return nil
+		}
+		if err := BeginSagaWithGlobalTxId(targetName, globalTxId, timeout); err != nil {
+			sagaStarts.abandon(targetName, globalTxId, record, err)
+			return err
+		}
+		m[constants.KEY_SAGA_START_RECORD] = record
 		return nil
 	}
 
 	sagaStartInjectAfter := func(ctx context.Context) error {
-		defer func() {
-			if autoClose {
-				sagactx.ClearSagaAgentContext()
+		err := FinishSaga(targetName, functionCallError(ctx), autoClose)
+		if m, ok := metadata.FromContext(ctx); ok {
+			if record, ok := m[constants.KEY_SAGA_START_RECORD].(*sagaStartRecord); ok {
+				results, _ := m[constants.KEY_FUNCTION_CALL_RESULTS].([]reflect.Value)
+				sagaStarts.finish(record, results, o.ttl)
 			}
-		}()
-		sagaAgentCtx, err := sagactx.GetSagaAgentContext()
-		if err != nil {
-			transportContractor.SendTxAbortedEvent(sagaAgentCtx, "", utils.GetFnName(target), err)
-			logger.LogError(fmt.Sprintf("Transaction %v failed.", sagaAgentCtx))
-			return err
-		}
-		if autoClose {
-			return sendSagaEndEvent(ctx, sagaAgentCtx, target)
-		} else {
-			logger.LogDebug(fmt.Sprintf("Transaction with context %v is not finished in the SagaStarted annotated method.", sagaAgentCtx))
-			return nil
 		}
+		return err
 	}
 
-	err := degorator.Decorate(sagaStartPtr, target, sagaStartInjectBefore, sagaStartInjectAfter)
+	err = degorator.Decorate(sagaStartPtr, target, sagaStartInjectBefore, sagaStartInjectAfter)
 	if err != nil {
 		return err
 	}
@@ -75,20 +109,13 @@ func DecorateSagaStartMethod(sagaStartPtr interface{}, target interface{}, timeo
 }
 
 func DecorateSagaEndMethod(sagaStartPtr interface{}, target interface{}) error {
+	targetName := utils.GetFnName(target)
+
 	sagaEndInjectBefore := func(ctx context.Context) error {
 		return nil
 	}
 	sagaEndInjectAfter := func(ctx context.Context) error {
-		defer func() {
-			sagactx.ClearSagaAgentContext()
-		}()
-		sagaAgentCtx, err := sagactx.GetSagaAgentContext()
-		if err != nil {
-			transportContractor.SendTxAbortedEvent(sagaAgentCtx, "", utils.GetFnName(target), err)
-			logger.LogError(fmt.Sprintf("Transaction %v failed.", sagaAgentCtx))
-			return err
-		}
-		return sendSagaEndEvent(ctx, sagaAgentCtx, target)
+		return FinishSaga(targetName, functionCallError(ctx), true)
 	}
 	err := degorator.Decorate(sagaStartPtr, target, sagaEndInjectBefore, sagaEndInjectAfter)
 	if err != nil {
@@ -97,108 +124,100 @@ func DecorateSagaEndMethod(sagaStartPtr interface{}, target interface{}) error {
 	return nil
 }
 
-func sendSagaEndEvent(ctx context.Context, sagaAgentCtx *sagactx.SagaAgentContext, target interface{}) error {
-	if m, ok := metadata.FromContext(ctx); ok {
-		if m[constants.KEY_FUNCTION_CALL_ERROR] != nil {
-			if v, ok := m[constants.KEY_FUNCTION_CALL_ERROR].(error); ok {
-				err := v.(error)
-				transportContractor.SendTxAbortedEvent(sagaAgentCtx, "", utils.GetFnName(target), err)
-				logger.LogError(fmt.Sprintf("Transaction %v failed.", sagaAgentCtx))
-				return err
-			}
-		}
+// CompensableOption configures a compensable method and its compensation method.
+type CompensableOption func(o *compensableOptions)
+
+type compensableOptions struct {
+	serializer    serializer.Serializer
+	schemaVersion int
+	upgrades      map[int]processor.PayloadsUpgrade
+}
+
+// WithCompensationSerializer sets the serializer of the arguments of the compensable method, which overrides the serializer
+// of the saga agent, such as serializer.NewProtoSerializer for the methods taking the generated protobuf messages.
+func WithCompensationSerializer(s serializer.Serializer) CompensableOption {
+	return func(o *compensableOptions) {
+		o.serializer = s
 	}
-	aborted, err := transportContractor.SendSagaEndedEvent(sagaAgentCtx)
-	if err != nil {
-		transportContractor.SendTxAbortedEvent(sagaAgentCtx, "", utils.GetFnName(target), err)
-		logger.LogError(fmt.Sprintf("Transaction %v failed.", sagaAgentCtx))
-		return err
+}
+
+// WithSchemaVersion sets the current version of the arguments of the compensable method, 1 by default.
+// Increase it when a deploy changes the arguments, and register the upgrades of the payloads of the previous versions
+// by WithPayloadsUpgrade, so that the sagas started before the deploy can still be compensated.
+func WithSchemaVersion(version int) CompensableOption {
+	return func(o *compensableOptions) {
+		o.schemaVersion = version
 	}
+}
 
-	if aborted {
-		return errors.New(fmt.Sprintf("transaction %s is aborted", sagaAgentCtx.GlobalTxId))
+// WithPayloadsUpgrade registers the upgrade of the serialized arguments of the compensable method from the schema version
+// fromVersion to fromVersion + 1, see WithSchemaVersion. The upgrade gets the decrypted arguments of the encrypting serializers.
+func WithPayloadsUpgrade(fromVersion int, upgrade func(payloads []byte) ([]byte, error)) CompensableOption {
+	return func(o *compensableOptions) {
+		if o.upgrades == nil {
+			o.upgrades = make(map[int]processor.PayloadsUpgrade)
+		}
+		o.upgrades[fromVersion] = upgrade
 	}
-	logger.LogDebug(fmt.Sprintf("Transaction with context %v has finished.", sagaAgentCtx))
-	return nil
 }
 
-func DecorateCompensableMethod(compensablePtr interface{}, target interface{}, compensed interface{}, timeout int) error {
+func applyCompensableOptions(compensedFuncName string, opts []CompensableOption) {
+	o := &compensableOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.serializer != nil {
+		compensationProcessor.RegisterCompensationSerializer(compensedFuncName, o.serializer)
+	}
+	if o.schemaVersion > 0 {
+		compensationProcessor.SetSchemaVersion(compensedFuncName, o.schemaVersion)
+	}
+	for fromVersion, upgrade := range o.upgrades {
+		compensationProcessor.RegisterPayloadsUpgrade(compensedFuncName, fromVersion, upgrade)
+	}
+}
+
+func DecorateCompensableMethod(compensablePtr interface{}, target interface{}, compensed interface{}, timeout int, opts ...CompensableOption) error {
 
 	compensedFuncName := utils.GetFnName(compensed)
 
 	compensationProcessor.RegisterCompensationFunc(compensedFuncName, compensed)
 
+	return decorateCompensableMethod(compensablePtr, target, compensedFuncName, timeout, opts)
+}
+
+func decorateCompensableMethod(compensablePtr interface{}, target interface{}, compensedFuncName string, timeout int, opts []CompensableOption) error {
+	targetName := utils.GetFnName(target)
+	applyCompensableOptions(compensedFuncName, opts)
+
 	compensableInjectBefore := func(ctx context.Context) error {
-		sagaAgentCtx, err := sagactx.GetSagaAgentContext()
-		if err != nil {
-			return err
-		}
-		parentLocalTxId := sagaAgentCtx.LocalTxId
-		if m, ok := metadata.FromContext(ctx); ok {
-			m[constants.KEY_PARENT_LOCAL_TX_ID] = parentLocalTxId
-		}
-		sagaAgentCtx.NewLocalTxId()
-		logger.LogDebug(fmt.Sprintf("Updated context %v for compensable method %v", sagaAgentCtx, target))
-		logger.LogDebug(fmt.Sprintf("Intercepting compensable method %v with context %v", target, sagaAgentCtx))
 		var args []reflect.Value
 		if m, ok := metadata.FromContext(ctx); ok {
 			if v, ok := m[constants.KEY_FUNCTION_CALL_ARGS].([]reflect.Value); ok {
 				args = v
 			}
 		}
-		aborted, err := transportContractor.SendTxStartedEvent(sagaAgentCtx, parentLocalTxId, compensedFuncName, timeout, args)
+		tx, err := beginCompensable(targetName, compensedFuncName, timeout, args)
 		if err != nil {
-			sagaAgentCtx.LocalTxId = parentLocalTxId
-			logger.LogDebug(fmt.Sprintf("Restored context back to %v", sagaAgentCtx))
 			return err
 		}
-		if aborted {
-			abortedLocalTxId := sagaAgentCtx.LocalTxId
-			sagaAgentCtx.LocalTxId = parentLocalTxId
-			logger.LogDebug(fmt.Sprintf("Restored context back to %v", sagaAgentCtx))
-			return errors.New(fmt.Sprintf("Abort sub transaction %s because global transaction %s has already aborted.", abortedLocalTxId, sagaAgentCtx.GlobalTxId))
+		if m, ok := metadata.FromContext(ctx); ok {
+			m[constants.KEY_COMPENSABLE_TX] = tx
 		}
 		return nil
 	}
 
 	compensableInjectAfter := func(ctx context.Context) error {
-		var parentLocalTxId string
+		var tx *CompensableTx
 		if m, ok := metadata.FromContext(ctx); ok {
-			if v, ok := m[constants.KEY_PARENT_LOCAL_TX_ID].(string); ok {
-				parentLocalTxId = v
+			if v, ok := m[constants.KEY_COMPENSABLE_TX].(*CompensableTx); ok {
+				tx = v
 			}
 		}
-		sagaAgentCtx, err := sagactx.GetSagaAgentContext()
-		if err != nil {
-			return err
-		}
-		if m, ok := metadata.FromContext(ctx); ok {
-			if m[constants.KEY_FUNCTION_CALL_ERROR] != nil {
-				if v, ok := m[constants.KEY_FUNCTION_CALL_ERROR].(error); ok {
-					err = v.(error)
-					transportContractor.SendTxAbortedEvent(sagaAgentCtx, "", utils.GetFnName(target), err)
-					logger.LogError(fmt.Sprintf("Transaction %v failed.", sagaAgentCtx))
-					return err
-				}
-			}
+		if tx == nil {
+			return errors.New(fmt.Sprintf("compensable transaction of method %s is not started", targetName))
 		}
-		aborted, err := transportContractor.SendTxEndedEvent(sagaAgentCtx, parentLocalTxId, compensedFuncName)
-		if err != nil {
-			transportContractor.SendTxAbortedEvent(sagaAgentCtx, "", utils.GetFnName(target), err)
-			logger.LogError(fmt.Sprintf("Transaction %v failed.", sagaAgentCtx))
-			sagaAgentCtx.LocalTxId = parentLocalTxId
-			logger.LogDebug(fmt.Sprintf("Restored context back to %v", sagaAgentCtx))
-			return err
-		}
-
-		if aborted {
-			sagaAgentCtx.LocalTxId = parentLocalTxId
-			logger.LogDebug(fmt.Sprintf("Restored context back to %v", sagaAgentCtx))
-			return errors.New(fmt.Sprintf("transaction %s is aborted", parentLocalTxId))
-		}
-		sagaAgentCtx.LocalTxId = parentLocalTxId
-		logger.LogDebug(fmt.Sprintf("Restored context back to %v", sagaAgentCtx))
-		return nil
+		return tx.Finish(functionCallError(ctx))
 	}
 
 	err := degorator.Decorate(compensablePtr, target, compensableInjectBefore, compensableInjectAfter)
@@ -208,18 +227,86 @@ func DecorateCompensableMethod(compensablePtr interface{}, target interface{}, c
 	return nil
 }
 
-func InitSagaAgent(serviceName string, coordinatorAddress string, l log.Logger) error {
-	initOnce.Do(func() {
-		logger = l
-		if logger == nil {
-			logger = log.NewNoopLogger()
+func functionCallError(ctx context.Context) error {
+	if m, ok := metadata.FromContext(ctx); ok {
+		if v, ok := m[constants.KEY_FUNCTION_CALL_ERROR].(error); ok {
+			return v
 		}
-		serviceConfig = config.NewServiceConfig(serviceName)
-		transportContractor = transport.NewTransportContractor(coordinatorAddress, serviceConfig, compensationProcessor, s, logger)
-	})
-	err := transportContractor.Connect()
+	}
+	return nil
+}
+
+// InitSagaAgent initializes the saga agent and connects to the coordinator at coordinatorAddress.
+// The argument coordinatorAddress may list several addresses separated by commas, or be a resolver address, see discovery.ParseResolver.
+func InitSagaAgent(serviceName string, coordinatorAddress string, l log.Logger) error {
+	return InitSagaAgentWithOptions(
+		WithServiceName(serviceName),
+		WithCoordinators(strings.Split(coordinatorAddress, ",")...),
+		WithLogger(l))
+}
+
+// InitSagaAgentWithOptions initializes the saga agent with opts and connects to the coordinator, such as
+//
+//	c, err := config.LoadAgentConfig("saga.yaml")
+//	if err != nil {
+//		return err
+//	}
+//	err = saga.InitSagaAgentWithOptions(saga.WithConfig(c), saga.WithLogger(l))
+func InitSagaAgentWithOptions(opts ...Option) error {
+	o := newAgentOptions(opts)
+	if o.err != nil {
+		return o.err
+	}
+	if err := o.agentConfig.Validate(); err != nil {
+		return err
+	}
+	if err := initSagaAgent(o); err != nil {
+		return err
+	}
+	return transportContractor.Connect()
+}
+
+// initSagaAgent creates the resources of the saga agent with o, such as the resolver of the coordinators and the blob store,
+// unless the saga agent is initialized, whose resources are kept. It is retried by the next call if it fails.
+func initSagaAgent(o *agentOptions) error {
+	initLock.Lock()
+	defer initLock.Unlock()
+	if transportContractor != nil {
+		return nil
+	}
+	sc, err := o.serviceConfig()
+	if err != nil {
+		return err
+	}
+	r, err := o.agentConfig.CoordinatorResolver()
 	if err != nil {
 		return err
 	}
+	o.agentConfig.Resolver = r
+	blobs, err := o.blobs()
+	if err != nil {
+		return err
+	}
+	l := o.logger
+	if l == nil {
+		l = log.NewNoopLogger()
+	}
+	level, _ := log.ParseLevel(o.agentConfig.LogLevel)
+	// the logs dropped by the level are not redacted
+	leveledLogger = log.NewLeveledLogger(log.NewRedactingLogger(l, redact.String), level)
+	logger = leveledLogger
+	redact.SetPatterns(o.agentConfig.RedactPatterns...)
+	agentConfig.Store(o.agentConfig)
+	if o.serializer != nil {
+		s = o.serializer
+	}
+	if o.idGenerator != nil {
+		sagactx.SetIdGenerator(o.idGenerator)
+	}
+	compensationProcessor.SetSerializer(s)
+	compensationProcessor.SetLogger(logger)
+	compensationProcessor.SetBlobStore(blobs)
+	serviceConfig = sc
+	transportContractor = transport.NewTransportContractor(o.agentConfig, serviceConfig, compensationProcessor, s, logger)
 	return nil
 }
@@ -0,0 +1,55 @@
+package saga
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jeremyxu2010/matrix-saga-go/saga_grpc"
+	"github.com/jeremyxu2010/matrix-saga-go/serializer"
+	"github.com/jeremyxu2010/matrix-saga-go/utils"
+)
+
+var protoCompensated []*saga_grpc.GrpcAck
+
+func protoCompensable(ack *saga_grpc.GrpcAck) error {
+	return nil
+}
+
+func protoCompensation(ack *saga_grpc.GrpcAck) error {
+	protoCompensated = append(protoCompensated, ack)
+	return nil
+}
+
+func TestCompensationSerializerOverride(t *testing.T) {
+	var decorated func(ack *saga_grpc.GrpcAck) error
+	err := DecorateCompensableMethod(&decorated, protoCompensable, protoCompensation, 5,
+		WithCompensationSerializer(serializer.NewProtoSerializer(nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compensation := utils.GetFnName(protoCompensation)
+	ack := &saga_grpc.GrpcAck{Aborted: true}
+	// the transport encodes the args of the compensable method by the processor
+	payloads, err := compensationProcessor.EncodeArgs(compensation, "g1", "l1", []reflect.Value{reflect.ValueOf(ack)}, nil, 0, 10240)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, e, err := serializer.UnwrapPayloads(payloads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.SerializerId != "proto+gob" {
+		t.Errorf("args are encoded by serializer %q, want proto+gob", e.SerializerId)
+	}
+	protoCompensated = nil
+	if err := compensationProcessor.ExecuteCompensate("g1", "l1", compensation, payloads, 10240); err != nil {
+		t.Fatal(err)
+	}
+	if len(protoCompensated) != 1 || !proto.Equal(protoCompensated[0], ack) {
+		t.Errorf("compensated with %v, want %v", protoCompensated, ack)
+	}
+	if got := compensationProcessor.Serializer(utils.GetFnName(protoCompensable)); got != s {
+		t.Error("serializer of another method is overridden")
+	}
+}
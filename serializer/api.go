@@ -1,8 +1,147 @@
 package serializer
 
-import "reflect"
+import (
+	"reflect"
+	"sync"
+)
 
 type Serializer interface {
-	Unserialize([]byte)([]reflect.Value, error)
-	Serialize([]reflect.Value)([]byte, error)
+	// Unserialize decodes the arguments into paramTypes, the parameter types of the compensation function,
+	// the type of a variadic parameter is a slice. The arguments keep the types recorded in the payloads if paramTypes is nil.
+	Unserialize(payloads []byte, paramTypes []reflect.Type) ([]reflect.Value, error)
+	Serialize([]reflect.Value) ([]byte, error)
+}
+
+// IdentifiedSerializer is a serializer whose id is recorded in the payloads envelope, see Envelope.
+// The compensations decode the payloads by the serializer registered under the recorded id, see RegisterSerializer,
+// if the compensation method uses another serializer now.
+type IdentifiedSerializer interface {
+	Serializer
+	SerializerId() string
+}
+
+// RawSerializer is a serializer whose payloads are sent without the envelope if Raw returns true,
+// such as KryoSerializer whose payloads are read by the Java omega. The baggage, the serializer and the schema version
+// are not recorded for the raw payloads.
+type RawSerializer interface {
+	Serializer
+	Raw() bool
+}
+
+// AuthenticatingSerializer is a serializer rejecting the payloads it did not produce if Authenticates returns true,
+// such as EncryptingSerializer. The payloads of a compensation method using it are never decoded by a serializer
+// which does not authenticate them, whatever serializer is recorded in the envelope.
+type AuthenticatingSerializer interface {
+	Serializer
+	Authenticates() bool
+}
+
+// BindingSerializer is a serializer binding its payloads to the compensation they are produced for, see PayloadsBinding,
+// such as EncryptingSerializer authenticating the binding. The payloads are rejected if they are decoded with another binding,
+// so the payloads of a transaction can not be replayed to another compensation.
+type BindingSerializer interface {
+	Serializer
+	SerializeBound(values []reflect.Value, binding []byte) ([]byte, error)
+	UnserializeBound(payloads []byte, paramTypes []reflect.Type, binding []byte) ([]reflect.Value, error)
+}
+
+// OpeningSerializer is a serializer whose payloads wrap the payloads of another serializer, such as EncryptingSerializer
+// encrypting them. The upgrades of the payloads of the older schema versions run on the opened payloads, see Open.
+type OpeningSerializer interface {
+	Serializer
+	// Open returns the payloads wrapped in payloads and the serializer decoding them,
+	// the payloads are rejected unless they are bound to binding, see BindingSerializer
+	Open(payloads []byte, binding []byte) ([]byte, Serializer, error)
+}
+
+var (
+	serializersLock sync.RWMutex
+	serializers     = make(map[string]Serializer)
+)
+
+func init() {
+	for _, s := range []IdentifiedSerializer{
+		&GobSerializer{}, &JsonSerializer{}, &KryoSerializer{}, NewProtoSerializer(nil).(IdentifiedSerializer),
+	} {
+		RegisterSerializer(s)
+	}
+}
+
+// RegisterSerializer registers s under its id to decode the payloads recorded with the id.
+func RegisterSerializer(s IdentifiedSerializer) {
+	serializersLock.Lock()
+	defer serializersLock.Unlock()
+	serializers[s.SerializerId()] = s
+}
+
+// LookupSerializer returns the serializer registered under id.
+func LookupSerializer(id string) (Serializer, bool) {
+	serializersLock.RLock()
+	defer serializersLock.RUnlock()
+	s, ok := serializers[id]
+	return s, ok
+}
+
+// SerializerId returns the id of s, or "" if s is not an IdentifiedSerializer.
+func SerializerId(s Serializer) string {
+	if is, ok := s.(IdentifiedSerializer); ok {
+		return is.SerializerId()
+	}
+	return ""
+}
+
+// IsRaw returns whether the payloads of s are sent without the envelope, see RawSerializer.
+func IsRaw(s Serializer) bool {
+	rs, ok := s.(RawSerializer)
+	return ok && rs.Raw()
+}
+
+// Authenticates returns whether s rejects the payloads it did not produce, see AuthenticatingSerializer.
+func Authenticates(s Serializer) bool {
+	as, ok := s.(AuthenticatingSerializer)
+	return ok && as.Authenticates()
+}
+
+// SerializeBound serializes values by s bound to binding if s is a BindingSerializer.
+func SerializeBound(s Serializer, values []reflect.Value, binding []byte) ([]byte, error) {
+	if bs, ok := s.(BindingSerializer); ok {
+		return bs.SerializeBound(values, binding)
+	}
+	return s.Serialize(values)
+}
+
+// UnserializeBound decodes payloads by s checking they are bound to binding if s is a BindingSerializer.
+func UnserializeBound(s Serializer, payloads []byte, paramTypes []reflect.Type, binding []byte) ([]reflect.Value, error) {
+	if bs, ok := s.(BindingSerializer); ok {
+		return bs.UnserializeBound(payloads, paramTypes, binding)
+	}
+	return s.Unserialize(payloads, paramTypes)
+}
+
+// Open opens the payloads of s as long as they are wrapped by an OpeningSerializer,
+// and returns the innermost payloads and the serializer decoding them.
+func Open(s Serializer, payloads []byte, binding []byte) ([]byte, Serializer, error) {
+	for {
+		opener, ok := s.(OpeningSerializer)
+		if !ok {
+			return payloads, s, nil
+		}
+		opened, inner, err := opener.Open(payloads, binding)
+		if err != nil {
+			return nil, nil, err
+		}
+		if inner == s {
+			return opened, s, nil
+		}
+		payloads, s = opened, inner
+	}
+}
+
+// ParamTypes returns the parameter types of the function type fnType.
+func ParamTypes(fnType reflect.Type) []reflect.Type {
+	paramTypes := make([]reflect.Type, 0, fnType.NumIn())
+	for i := 0; i < fnType.NumIn(); i++ {
+		paramTypes = append(paramTypes, fnType.In(i))
+	}
+	return paramTypes
 }
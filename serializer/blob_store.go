@@ -0,0 +1,114 @@
+package serializer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BlobStore keeps the payloads which are too long to be sent to the coordinator, the coordinator gets their references instead.
+// The payloads must be available to every instance which may compensate the transaction, such as a shared volume.
+type BlobStore interface {
+	// Put stores payloads and returns their reference
+	Put(payloads []byte) (ref string, err error)
+	// Get returns the payloads stored under ref
+	Get(ref string) ([]byte, error)
+}
+
+// blobTempPrefix starts the names of the files written by FileBlobStore before they are renamed to their references.
+const blobTempPrefix = ".tmp-saga-blob-"
+
+// FileBlobStore stores the payloads as files named after their SHA-256 digests in a directory,
+// the files older than the ttl are removed, since the payloads of the finished transactions are never deleted explicitly.
+// Only the files it writes are removed, the other files in the directory are left alone.
+type FileBlobStore struct {
+	dir string
+	ttl time.Duration
+
+	lock      sync.Mutex
+	lastSweep time.Time
+}
+
+// NewFileBlobStore creates a FileBlobStore in the directory dir, which is created if it does not exist.
+// The argument ttl must be longer than the transactions may last.
+func NewFileBlobStore(dir string, ttl time.Duration) (BlobStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileBlobStore{
+		dir:       dir,
+		ttl:       ttl,
+		lastSweep: time.Now(),
+	}, nil
+}
+
+func (s *FileBlobStore) Put(payloads []byte) (string, error) {
+	digest := sha256.Sum256(payloads)
+	ref := hex.EncodeToString(digest[:])
+	f, err := ioutil.TempFile(s.dir, blobTempPrefix)
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(payloads)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(s.dir, ref))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	s.lock.Lock()
+	if time.Since(s.lastSweep) > time.Minute {
+		s.lastSweep = time.Now()
+		go s.sweep()
+	}
+	s.lock.Unlock()
+	return ref, nil
+}
+
+// Get returns the payloads of ref, which are rejected if they do not match the digest ref.
+func (s *FileBlobStore) Get(ref string) ([]byte, error) {
+	if !isBlobRef(ref) {
+		return nil, errors.New(fmt.Sprintf("invalid blob reference %q", ref))
+	}
+	payloads, err := ioutil.ReadFile(filepath.Join(s.dir, ref))
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(payloads)
+	if hex.EncodeToString(digest[:]) != ref {
+		return nil, errors.New(fmt.Sprintf("blob %s is corrupted", ref))
+	}
+	return payloads, nil
+}
+
+func (s *FileBlobStore) sweep() {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+	for _, f := range files {
+		if f.IsDir() || !isBlobRef(f.Name()) && !strings.HasPrefix(f.Name(), blobTempPrefix) {
+			continue
+		}
+		if time.Since(f.ModTime()) > s.ttl {
+			os.Remove(filepath.Join(s.dir, f.Name()))
+		}
+	}
+}
+
+// isBlobRef returns whether name is a reference of the payloads, the lower-case hex SHA-256 digest of them.
+func isBlobRef(name string) bool {
+	b, err := hex.DecodeString(name)
+	return err == nil && len(b) == sha256.Size && name == strings.ToLower(name)
+}
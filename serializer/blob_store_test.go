@@ -0,0 +1,116 @@
+package serializer
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestBlobStore(t *testing.T, ttl time.Duration) (*FileBlobStore, string) {
+	dir, err := ioutil.TempDir("", "blobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewFileBlobStore(filepath.Join(dir, "payloads"), ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.(*FileBlobStore), dir
+}
+
+func TestFileBlobStore(t *testing.T) {
+	s, dir := newTestBlobStore(t, time.Hour)
+	defer os.RemoveAll(dir)
+	payloads := bytes.Repeat([]byte("payloads"), 1000)
+	ref, err := s.Put(payloads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := s.Put(payloads); err != nil || again != ref {
+		t.Errorf("got reference %s, %v, want %s", again, err, ref)
+	}
+	got, err := s.Get(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, payloads) {
+		t.Error("got other payloads")
+	}
+
+	missing := strings.Repeat("0", 64)
+	corrupted, err := s.Put([]byte("corrupted"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(s.dir, corrupted), []byte("tampered"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name string
+		ref  string
+		err  string
+	}{
+		{"not hex", "../" + ref, "invalid blob reference"},
+		{"short", ref[:62], "invalid blob reference"},
+		{"missing", missing, "no such file"},
+		{"corrupted", corrupted, "blob " + corrupted + " is corrupted"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := s.Get(c.ref)
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("got error %v, want %q", err, c.err)
+			}
+		})
+	}
+}
+
+func TestFileBlobStoreSweep(t *testing.T) {
+	s, dir := newTestBlobStore(t, time.Hour)
+	defer os.RemoveAll(dir)
+	expired, err := s.Put([]byte("expired"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, err := s.Put([]byte("kept"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	// the files of others in the directory are kept, whatever their names
+	foreign := []string{"notes.txt", strings.ToUpper(expired), expired[1:], ".tmp-other"}
+	for _, name := range foreign {
+		if err := ioutil.WriteFile(filepath.Join(s.dir, name), []byte("foreign"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	leftover, err := ioutil.TempFile(s.dir, blobTempPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leftover.Close()
+	for _, name := range append(foreign, expired, filepath.Base(leftover.Name())) {
+		if err := os.Chtimes(filepath.Join(s.dir, name), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.sweep()
+	for _, name := range foreign {
+		if _, err := os.Stat(filepath.Join(s.dir, name)); err != nil {
+			t.Errorf("file %s is removed, %v", name, err)
+		}
+	}
+	if _, err := os.Stat(leftover.Name()); !os.IsNotExist(err) {
+		t.Errorf("expired temp file is kept, %v", err)
+	}
+	if _, err := s.Get(expired); err == nil {
+		t.Error("expired blob is kept")
+	}
+	if _, err := s.Get(kept); err != nil {
+		t.Errorf("blob is removed, %v", err)
+	}
+}
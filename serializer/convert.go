@@ -0,0 +1,80 @@
+package serializer
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// checkArgCount checks whether there is an argument for every parameter.
+func checkArgCount(count int, paramTypes []reflect.Type) error {
+	if paramTypes != nil && len(paramTypes) != count {
+		return errors.New(fmt.Sprintf("decode values failed, %d args for %d params %v", count, len(paramTypes), paramTypes))
+	}
+	return nil
+}
+
+// convertArg converts the decoded argument value of the i-th parameter to paramType,
+// the zero value of paramType is returned for a nil argument.
+func convertArg(i int, value reflect.Value, paramType reflect.Type) (reflect.Value, error) {
+	if paramType == nil {
+		return value, nil
+	}
+	if !value.IsValid() || isNil(value) {
+		switch paramType.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+			return reflect.Zero(paramType), nil
+		}
+		return reflect.Value{}, errors.New(fmt.Sprintf("decode arg %d failed, nil can not be used as %v", i, paramType))
+	}
+	if value.Type().AssignableTo(paramType) {
+		return value.Convert(paramType), nil
+	}
+	if paramType.Kind() == reflect.Ptr && value.Type().AssignableTo(paramType.Elem()) {
+		ptr := reflect.New(paramType.Elem())
+		ptr.Elem().Set(value)
+		return ptr, nil
+	}
+	if value.Kind() == reflect.Ptr && value.Elem().Type().AssignableTo(paramType) {
+		return value.Elem(), nil
+	}
+	if basicConvertible(value.Kind(), paramType.Kind()) && value.Type().ConvertibleTo(paramType) {
+		return value.Convert(paramType), nil
+	}
+	return reflect.Value{}, errors.New(fmt.Sprintf("decode arg %d failed, %v can not be used as %v", i, value.Type(), paramType))
+}
+
+// basicConvertible returns whether the values of kind from are converted to kind to, such as int to int32 or string to a named string type.
+// An integer is never converted to a string.
+func basicConvertible(from reflect.Kind, to reflect.Kind) bool {
+	if numericKind(from) && numericKind(to) {
+		return true
+	}
+	return from == to && (from == reflect.Bool || from == reflect.String)
+}
+
+func numericKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func isNil(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return value.IsNil()
+	}
+	return false
+}
+
+// concrete returns the dynamic value of value if it is an interface, such as an argument of an interface parameter.
+func concrete(value reflect.Value) reflect.Value {
+	for value.IsValid() && value.Kind() == reflect.Interface && !value.IsNil() {
+		value = value.Elem()
+	}
+	return value
+}
@@ -0,0 +1,67 @@
+package serializer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type orderNo string
+
+func TestConvertArg(t *testing.T) {
+	order := jsonOrder{No: "1"}
+	cases := []struct {
+		name      string
+		value     reflect.Value
+		paramType reflect.Type
+		want      interface{}
+		err       string
+	}{
+		{"no param type", reflect.ValueOf(int64(1)), nil, int64(1), ""},
+		{"same type", reflect.ValueOf(1), reflect.TypeOf(0), 1, ""},
+		{"nil into pointer", reflect.Value{}, reflect.TypeOf(&order), (*jsonOrder)(nil), ""},
+		{"nil into slice", reflect.ValueOf([]string(nil)), reflect.TypeOf([]string{}), []string(nil), ""},
+		{"nil into int", reflect.Value{}, reflect.TypeOf(0), nil, "decode arg 0 failed, nil can not be used as int"},
+		{"into interface", reflect.ValueOf(1), interfaceType, 1, ""},
+		{"into named string", reflect.ValueOf("1"), reflect.TypeOf(orderNo("")), orderNo("1"), ""},
+		{"into narrower integer", reflect.ValueOf(int64(3)), reflect.TypeOf(int32(0)), int32(3), ""},
+		{"float into integer", reflect.ValueOf(3.0), reflect.TypeOf(0), 3, ""},
+		{"value into pointer", reflect.ValueOf(order), reflect.TypeOf(&order), &order, ""},
+		{"pointer into value", reflect.ValueOf(&order), reflect.TypeOf(order), order, ""},
+		{"integer into string", reflect.ValueOf(65), reflect.TypeOf(""), nil, "decode arg 0 failed, int can not be used as string"},
+		{"string into bool", reflect.ValueOf("true"), reflect.TypeOf(false), nil, "string can not be used as bool"},
+		{"struct into another struct", reflect.ValueOf(order), reflect.TypeOf(jsonUnregistered{}), nil, "can not be used as serializer.jsonUnregistered"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			value, err := convertArg(0, c.value, c.paramType)
+			if len(c.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Errorf("got error %v, want %q", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.paramType != nil && value.Type() != c.paramType {
+				t.Errorf("got type %v, want %v", value.Type(), c.paramType)
+			}
+			if got := interfacesOf([]reflect.Value{value})[0]; !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %#v, want %#v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestCheckArgCount(t *testing.T) {
+	if err := checkArgCount(2, nil); err != nil {
+		t.Errorf("args are checked without param types, %v", err)
+	}
+	if err := checkArgCount(0, []reflect.Type{}); err != nil {
+		t.Error(err)
+	}
+	if err := checkArgCount(1, typesOf("", "")); err == nil || !strings.Contains(err.Error(), "1 args for 2 params") {
+		t.Errorf("got error %v", err)
+	}
+}
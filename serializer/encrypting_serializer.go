@@ -0,0 +1,178 @@
+package serializer
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// encryptedMagic starts the encrypted payloads, followed by the length of the key id, the key id, the nonce and the sealed arguments.
+// The magic, the key id and the binding of the payloads are authenticated as the additional data.
+var encryptedMagic = []byte{'S', 'A', 'E', 1}
+
+// KeyProvider provides the AES keys of EncryptingSerializer, the keys are 16, 24 or 32 bytes long.
+// The keys are rotated by changing the current key, the previous keys must be kept until the sagas encrypted by them are finished.
+type KeyProvider interface {
+	// CurrentKey returns the key encrypting the payloads and its id, which is recorded in the payloads
+	CurrentKey() (keyId string, key []byte, err error)
+	// Key returns the key of keyId decrypting the payloads
+	Key(keyId string) ([]byte, error)
+}
+
+type staticKeyProvider struct {
+	currentKeyId string
+	keys         map[string][]byte
+}
+
+// NewStaticKeyProvider creates a KeyProvider of keys by their ids, currentKeyId is the id of the key encrypting the payloads.
+func NewStaticKeyProvider(currentKeyId string, keys map[string][]byte) KeyProvider {
+	copied := make(map[string][]byte, len(keys))
+	for keyId, key := range keys {
+		copied[keyId] = key
+	}
+	return &staticKeyProvider{
+		currentKeyId: currentKeyId,
+		keys:         copied,
+	}
+}
+
+func (p *staticKeyProvider) CurrentKey() (string, []byte, error) {
+	key, err := p.Key(p.currentKeyId)
+	return p.currentKeyId, key, err
+}
+
+func (p *staticKeyProvider) Key(keyId string) ([]byte, error) {
+	key, ok := p.keys[keyId]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("key %s is unknown", keyId))
+	}
+	return key, nil
+}
+
+// EncryptingSerializer encrypts and authenticates the payloads of another serializer with AES-GCM,
+// so the arguments are not readable in the coordinator, and the payloads which are tampered, not encrypted,
+// encrypted by an unknown key, or bound to another compensation method or transaction, see BindingSerializer,
+// are rejected on compensation.
+type EncryptingSerializer struct {
+	s    Serializer
+	keys KeyProvider
+}
+
+func NewEncryptingSerializer(s Serializer, keys KeyProvider) Serializer {
+	return &EncryptingSerializer{
+		s:    s,
+		keys: keys,
+	}
+}
+
+// SerializerId returns "aes-gcm+" followed by the id of the wrapped serializer, such as "aes-gcm+gob".
+func (s *EncryptingSerializer) SerializerId() string {
+	return "aes-gcm+" + SerializerId(s.s)
+}
+
+// Authenticates returns true, the payloads are authenticated by AES-GCM.
+func (s *EncryptingSerializer) Authenticates() bool {
+	return true
+}
+
+func (s *EncryptingSerializer) Serialize(values []reflect.Value) ([]byte, error) {
+	return s.SerializeBound(values, nil)
+}
+
+func (s *EncryptingSerializer) Unserialize(payloads []byte, paramTypes []reflect.Type) ([]reflect.Value, error) {
+	return s.UnserializeBound(payloads, paramTypes, nil)
+}
+
+// SerializeBound encrypts the payloads authenticating binding, which must be the same to decrypt them.
+func (s *EncryptingSerializer) SerializeBound(values []reflect.Value, binding []byte) ([]byte, error) {
+	plain, err := s.s.Serialize(values)
+	if err != nil {
+		return nil, err
+	}
+	keyId, key, err := s.keys.CurrentKey()
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("encrypt payloads failed, %v", err))
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("encrypt payloads with key %s failed, %v", keyId, err))
+	}
+	var buf bytes.Buffer
+	buf.Write(encryptedMagic)
+	lenBuf := make([]byte, binary.MaxVarintLen64)
+	buf.Write(lenBuf[:binary.PutUvarint(lenBuf, uint64(len(keyId)))])
+	buf.WriteString(keyId)
+	header := buf.Bytes()
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.New(fmt.Sprintf("encrypt payloads failed, %v", err))
+	}
+	b := make([]byte, 0, len(header)+len(nonce)+len(plain)+aead.Overhead())
+	b = append(b, header...)
+	b = append(b, nonce...)
+	return aead.Seal(b, nonce, plain, additionalData(header, binding)), nil
+}
+
+// UnserializeBound decrypts the payloads, which are rejected unless they are bound to binding.
+func (s *EncryptingSerializer) UnserializeBound(payloads []byte, paramTypes []reflect.Type, binding []byte) ([]reflect.Value, error) {
+	plain, inner, err := s.Open(payloads, binding)
+	if err != nil {
+		return nil, err
+	}
+	return inner.Unserialize(plain, paramTypes)
+}
+
+// Open decrypts the payloads of the wrapped serializer, which are rejected unless they are bound to binding, see OpeningSerializer.
+func (s *EncryptingSerializer) Open(payloads []byte, binding []byte) ([]byte, Serializer, error) {
+	if !bytes.HasPrefix(payloads, encryptedMagic) {
+		return nil, nil, errors.New("payloads are not encrypted")
+	}
+	r := bytes.NewReader(payloads[len(encryptedMagic):])
+	n, err := binary.ReadUvarint(r)
+	if err != nil || n > uint64(r.Len()) {
+		return nil, nil, errors.New("malformed encrypted payloads")
+	}
+	keyIdBuf := make([]byte, n)
+	r.Read(keyIdBuf)
+	keyId := string(keyIdBuf)
+	header := payloads[:len(payloads)-r.Len()]
+	key, err := s.keys.Key(keyId)
+	if err != nil {
+		return nil, nil, errors.New(fmt.Sprintf("decrypt payloads failed, %v", err))
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, nil, errors.New(fmt.Sprintf("decrypt payloads with key %s failed, %v", keyId, err))
+	}
+	sealed := payloads[len(header):]
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return nil, nil, errors.New("malformed encrypted payloads")
+	}
+	nonce := sealed[:aead.NonceSize()]
+	plain, err := aead.Open(nil, nonce, sealed[aead.NonceSize():], additionalData(header, binding))
+	if err != nil {
+		return nil, nil, errors.New(fmt.Sprintf("decrypt payloads with key %s failed, the payloads are tampered, encrypted by another key or bound to another compensation", keyId))
+	}
+	return plain, s.s, nil
+}
+
+// additionalData returns the additional data authenticated with the payloads, the header is self-delimiting.
+func additionalData(header []byte, binding []byte) []byte {
+	ad := make([]byte, 0, len(header)+len(binding))
+	ad = append(ad, header...)
+	return append(ad, binding...)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
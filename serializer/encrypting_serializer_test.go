@@ -0,0 +1,192 @@
+package serializer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testKeys(currentKeyId string) KeyProvider {
+	return NewStaticKeyProvider(currentKeyId, map[string][]byte{
+		"k1": bytes.Repeat([]byte{1}, 32),
+		"k2": bytes.Repeat([]byte{2}, 16),
+	})
+}
+
+func TestEncryptingSerializerBinding(t *testing.T) {
+	s := NewEncryptingSerializer(&GobSerializer{}, testKeys("k1")).(BindingSerializer)
+	binding := PayloadsBinding("main.Cancel", "g1", "l1")
+	payloads, err := s.SerializeBound(valuesOf("secret", 1), binding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := s.UnserializeBound(payloads, typesOf("", 0), binding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := interfacesOf(values); !reflect.DeepEqual(got, []interface{}{"secret", 1}) {
+		t.Errorf("got %v", got)
+	}
+	cases := []struct {
+		name    string
+		binding []byte
+	}{
+		{"another method", PayloadsBinding("main.Refund", "g1", "l1")},
+		{"another saga", PayloadsBinding("main.Cancel", "g2", "l1")},
+		{"another transaction", PayloadsBinding("main.Cancel", "g1", "l2")},
+		{"shifted ids", PayloadsBinding("main.Cancel", "g", "1l1")},
+		{"no binding", nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := s.UnserializeBound(payloads, typesOf("", 0), c.binding)
+			if err == nil || !strings.Contains(err.Error(), "bound to another compensation") {
+				t.Errorf("got error %v", err)
+			}
+		})
+	}
+	if _, err := s.Unserialize(payloads, typesOf("", 0)); err == nil {
+		t.Error("bound payloads are decoded without the binding")
+	}
+}
+
+func TestEncryptingSerializerRoundTrip(t *testing.T) {
+	for _, keyId := range []string{"k1", "k2"} {
+		t.Run(keyId, func(t *testing.T) {
+			s := NewEncryptingSerializer(&GobSerializer{}, testKeys(keyId))
+			if id := SerializerId(s); id != "aes-gcm+gob" {
+				t.Errorf("got serializer id %s", id)
+			}
+			payloads, err := s.Serialize(valuesOf("secret", 1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Contains(payloads, []byte("secret")) {
+				t.Error("arguments are readable")
+			}
+			again, err := s.Serialize(valuesOf("secret", 1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Equal(payloads, again) {
+				t.Error("nonce is reused")
+			}
+			values, err := s.Unserialize(payloads, typesOf("", 0))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := interfacesOf(values); !reflect.DeepEqual(got, []interface{}{"secret", 1}) {
+				t.Errorf("got %v", got)
+			}
+		})
+	}
+}
+
+func TestEncryptingSerializerKeyRotation(t *testing.T) {
+	payloads, err := NewEncryptingSerializer(&GobSerializer{}, testKeys("k1")).Serialize(valuesOf("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the payloads encrypted before the rotation are decrypted by their key
+	if _, err := NewEncryptingSerializer(&GobSerializer{}, testKeys("k2")).Unserialize(payloads, typesOf("")); err != nil {
+		t.Error(err)
+	}
+	retired := NewStaticKeyProvider("k2", map[string][]byte{"k2": bytes.Repeat([]byte{2}, 16)})
+	_, err = NewEncryptingSerializer(&GobSerializer{}, retired).Unserialize(payloads, typesOf(""))
+	if err == nil || !strings.Contains(err.Error(), "decrypt payloads failed, key k1 is unknown") {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestEncryptingSerializerRejectsPayloads(t *testing.T) {
+	s := NewEncryptingSerializer(&GobSerializer{}, testKeys("k1"))
+	payloads, err := s.Serialize(valuesOf("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := (&GobSerializer{}).Serialize(valuesOf("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified := func(modify func(b []byte)) []byte {
+		b := append([]byte{}, payloads...)
+		modify(b)
+		return b
+	}
+	header := len(encryptedMagic) + 1 + len("k1")
+	wrongKeys := NewStaticKeyProvider("k1", map[string][]byte{"k1": bytes.Repeat([]byte{3}, 32)})
+	badKeys := NewStaticKeyProvider("k3", map[string][]byte{"k3": bytes.Repeat([]byte{3}, 10)})
+	badKeyPayloads := append(append(append([]byte{}, encryptedMagic...), 2, 'k', '3'), make([]byte, 40)...)
+	cases := []struct {
+		name     string
+		keys     KeyProvider
+		payloads []byte
+		err      string
+	}{
+		{"tampered arguments", nil, modified(func(b []byte) { b[len(b)-20] ^= 1 }), "the payloads are tampered"},
+		{"tampered tag", nil, modified(func(b []byte) { b[len(b)-1] ^= 1 }), "the payloads are tampered"},
+		{"tampered nonce", nil, modified(func(b []byte) { b[header] ^= 1 }), "the payloads are tampered"},
+		{"tampered key id", nil, modified(func(b []byte) { b[header-1] = '2' }), "decrypt payloads with key k2 failed, the payloads are tampered"},
+		{"wrong key", wrongKeys, payloads, "decrypt payloads with key k1 failed, the payloads are tampered"},
+		{"invalid key", badKeys, badKeyPayloads, "decrypt payloads with key k3 failed, crypto/aes: invalid key size 10"},
+		{"not encrypted", nil, plain, "payloads are not encrypted"},
+		{"empty", nil, nil, "payloads are not encrypted"},
+		{"truncated", nil, payloads[:header+8], "malformed encrypted payloads"},
+		{"key id longer than the payloads", nil, append(append([]byte{}, encryptedMagic...), 9, 'k'), "malformed encrypted payloads"},
+		{"malformed key id length", nil, append(append([]byte{}, encryptedMagic...), 0x80), "malformed encrypted payloads"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			keys := c.keys
+			if keys == nil {
+				keys = testKeys("k1")
+			}
+			_, err := NewEncryptingSerializer(&GobSerializer{}, keys).Unserialize(c.payloads, typesOf(""))
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("got error %v, want %q", err, c.err)
+			}
+		})
+	}
+}
+
+func TestEncryptingSerializerKeyErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		keys KeyProvider
+		err  string
+	}{
+		{"unknown current key", testKeys("k9"), "encrypt payloads failed, key k9 is unknown"},
+		{"invalid key", NewStaticKeyProvider("k3", map[string][]byte{"k3": []byte("short")}), "encrypt payloads with key k3 failed"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := NewEncryptingSerializer(&GobSerializer{}, c.keys).Serialize(valuesOf("secret"))
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("got error %v, want %q", err, c.err)
+			}
+		})
+	}
+}
+
+func TestPayloadsBinding(t *testing.T) {
+	bindings := make(map[string]bool)
+	for _, ids := range [][3]string{
+		{"main.Cancel", "g1", "l1"},
+		{"main.Cancel", "g1", "l2"},
+		{"main.Cancel", "g1l", "1"},
+		{"main.Cancelg", "1", "l1"},
+		{"", "", ""},
+	} {
+		b := PayloadsBinding(ids[0], ids[1], ids[2])
+		if bindings[string(b)] {
+			t.Errorf("binding of %v is not unique", ids)
+		}
+		bindings[string(b)] = true
+		n, l := binary.Uvarint(b)
+		if l <= 0 || string(b[l:l+int(n)]) != ids[0] {
+			t.Errorf("binding %q does not start with the compensation method", b)
+		}
+	}
+}
@@ -3,43 +3,135 @@ package serializer
 import (
 	"bytes"
 	"encoding/gob"
-	"reflect"
 	"errors"
 	"fmt"
+	"reflect"
 )
 
+// gobFormat is the first value of the payloads in the typed gob format,
+// the payloads of the legacy format start with the []interface{} of the arguments.
+const gobFormat = "saga-gob/2"
+
+// gobHeader follows gobFormat, the arguments which are not nil follow it one by one.
+type gobHeader struct {
+	// Types are the type names of the arguments, see TypeName, "nil" for a nil argument
+	Types []string
+}
+
 type GobSerializer struct {
 }
 
-func NewGobSerializer()Serializer{
+func NewGobSerializer() Serializer {
 	return &GobSerializer{}
 }
 
-func (s *GobSerializer)Unserialize(payloads []byte)([]reflect.Value, error){
-	b := bytes.NewReader(payloads)
-	dec := gob.NewDecoder(b)
+func (s *GobSerializer) SerializerId() string {
+	return "gob"
+}
+
+func (s *GobSerializer) Unserialize(payloads []byte, paramTypes []reflect.Type) ([]reflect.Value, error) {
+	dec := gob.NewDecoder(bytes.NewReader(payloads))
+	var format string
+	if err := dec.Decode(&format); err != nil || format != gobFormat {
+		return s.unserializeLegacy(payloads, paramTypes)
+	}
+	header := &gobHeader{}
+	if err := dec.Decode(header); err != nil {
+		return nil, errors.New(fmt.Sprintf("decode values failed, %v", err))
+	}
+	if err := checkArgCount(len(header.Types), paramTypes); err != nil {
+		return nil, err
+	}
+	values := make([]reflect.Value, 0, len(header.Types))
+	for i, typeName := range header.Types {
+		var paramType reflect.Type
+		if paramTypes != nil {
+			paramType = paramTypes[i]
+		}
+		if typeName == "nil" {
+			value, err := convertArg(i, reflect.Value{}, paramType)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+			continue
+		}
+		t := paramType
+		if t == nil || t.Kind() == reflect.Interface {
+			registered, ok := LookupType(typeName)
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("decode arg %d failed, type %s is not registered, register it with serializer.RegisterType", i, typeName))
+			}
+			t = registered
+		}
+		ptr := reflect.New(t)
+		if err := dec.DecodeValue(ptr); err != nil {
+			return nil, errors.New(fmt.Sprintf("decode arg %d of type %s into %v failed, %v", i, typeName, t, err))
+		}
+		value, err := convertArg(i, ptr.Elem(), paramType)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// unserializeLegacy decodes the payloads encoded as []interface{} by the previous versions.
+func (s *GobSerializer) unserializeLegacy(payloads []byte, paramTypes []reflect.Type) ([]reflect.Value, error) {
+	dec := gob.NewDecoder(bytes.NewReader(payloads))
 	args := make([]interface{}, 0)
 	err := dec.Decode(&args)
 	if err != nil {
 		return nil, errors.New(fmt.Sprintf("decode values failed, %v", err))
 	}
+	if err := checkArgCount(len(args), paramTypes); err != nil {
+		return nil, err
+	}
 	values := make([]reflect.Value, 0)
-	for _, arg := range args {
-		values = append(values, reflect.ValueOf(arg))
+	for i, arg := range args {
+		if paramTypes == nil {
+			values = append(values, reflect.ValueOf(arg))
+			continue
+		}
+		value, err := convertArg(i, reflect.ValueOf(arg), paramTypes[i])
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
 	}
 	return values, nil
 }
 
-func (s *GobSerializer)Serialize(values []reflect.Value)([]byte, error){
+func (s *GobSerializer) Serialize(values []reflect.Value) ([]byte, error) {
 	var b bytes.Buffer
 	enc := gob.NewEncoder(&b)
-	args := make([]interface{}, 0)
+	header := &gobHeader{
+		Types: make([]string, 0, len(values)),
+	}
+	args := make([]reflect.Value, 0, len(values))
 	for _, value := range values {
-		args = append(args, value.Interface())
+		value = concrete(value)
+		args = append(args, value)
+		if !value.IsValid() || isNil(value) {
+			header.Types = append(header.Types, "nil")
+		} else {
+			header.Types = append(header.Types, TypeName(value.Type()))
+		}
 	}
-	err := enc.Encode(args)
-	if err != nil {
+	if err := enc.Encode(gobFormat); err != nil {
 		return nil, errors.New(fmt.Sprintf("encode args failed, %v", err))
 	}
+	if err := enc.Encode(header); err != nil {
+		return nil, errors.New(fmt.Sprintf("encode args failed, %v", err))
+	}
+	for i, value := range args {
+		if header.Types[i] == "nil" {
+			continue
+		}
+		if err := enc.EncodeValue(value); err != nil {
+			return nil, errors.New(fmt.Sprintf("encode arg %d failed, %v", i, err))
+		}
+	}
 	return b.Bytes(), nil
 }
@@ -0,0 +1,117 @@
+package serializer
+
+import (
+	"bytes"
+	"encoding/gob"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGobSerializerRoundTrip(t *testing.T) {
+	order := jsonOrder{No: "1", Amount: 2, Items: []string{"a"}}
+	cases := []struct {
+		name       string
+		args       []interface{}
+		paramTypes []reflect.Type
+		want       []interface{}
+	}{
+		{"basic types", []interface{}{"o1", 3, true, 1.5}, typesOf("", 0, false, 0.0), nil},
+		{"struct", []interface{}{order}, typesOf(order), nil},
+		{"pointer", []interface{}{&order}, typesOf(&order), nil},
+		{"nil pointer", []interface{}{(*jsonOrder)(nil)}, typesOf(&order), nil},
+		{"nil into interface", []interface{}{nil}, []reflect.Type{interfaceType}, nil},
+		{"registered type into interface", []interface{}{order}, []reflect.Type{interfaceType}, nil},
+		{"registered types without param types", []interface{}{"o1", int64(3), order}, nil, nil},
+		{"into narrower integer", []interface{}{int64(3)}, typesOf(int32(0)), []interface{}{int32(3)}},
+		{"into named string", []interface{}{"1"}, typesOf(orderNo("")), []interface{}{orderNo("1")}},
+	}
+	s := NewGobSerializer()
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			payloads, err := s.Serialize(valuesOf(c.args...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			values, err := s.Unserialize(payloads, c.paramTypes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := c.want
+			if want == nil {
+				want = c.args
+			}
+			if got := interfacesOf(values); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %#v, want %#v", got, want)
+			}
+		})
+	}
+}
+
+// legacyGobPayloads returns args encoded as []interface{}, like the previous versions of GobSerializer.
+func legacyGobPayloads(t *testing.T, args ...interface{}) []byte {
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(args); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestGobSerializerDecodesLegacyPayloads(t *testing.T) {
+	s := NewGobSerializer()
+	values, err := s.Unserialize(legacyGobPayloads(t, "o1", 3), typesOf("", int32(0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := interfacesOf(values); !reflect.DeepEqual(got, []interface{}{"o1", int32(3)}) {
+		t.Errorf("got %#v", got)
+	}
+	values, err = s.Unserialize(legacyGobPayloads(t, "o1", 3), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := interfacesOf(values); !reflect.DeepEqual(got, []interface{}{"o1", 3}) {
+		t.Errorf("got %#v", got)
+	}
+}
+
+func TestGobSerializerErrors(t *testing.T) {
+	s := NewGobSerializer()
+	encode := func(args ...interface{}) []byte {
+		payloads, err := s.Serialize(valuesOf(args...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return payloads
+	}
+	var truncated bytes.Buffer
+	gob.NewEncoder(&truncated).Encode(gobFormat)
+	cases := []struct {
+		name       string
+		payloads   []byte
+		paramTypes []reflect.Type
+		err        string
+	}{
+		{"malformed", []byte("garbage"), nil, "decode values failed"},
+		{"no header", truncated.Bytes(), nil, "decode values failed"},
+		{"too few args", encode("a"), typesOf("", ""), "1 args for 2 params"},
+		{"too many legacy args", legacyGobPayloads(t, "a", "b"), typesOf(""), "2 args for 1 params"},
+		{"unregistered type", encode(jsonUnregistered{No: "1"}), []reflect.Type{interfaceType},
+			"decode arg 0 failed, type github.com/jeremyxu2010/matrix-saga-go/serializer.jsonUnregistered is not registered"},
+		{"value not decodable into the param type", encode("a"), typesOf(0), "decode arg 0 of type string into int failed"},
+		{"nil into int", encode(nil), typesOf(0), "decode arg 0 failed, nil can not be used as int"},
+		{"legacy value not convertible", legacyGobPayloads(t, 1), typesOf(""), "decode arg 0 failed, int can not be used as string"},
+		{"truncated args", encode("a", "b")[:len(encode("a", "b"))-2], typesOf("", ""), "decode arg 1"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := s.Unserialize(c.payloads, c.paramTypes)
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("got error %v, want %q", err, c.err)
+			}
+		})
+	}
+	if _, err := s.Serialize(valuesOf(make(chan int))); err == nil || !strings.Contains(err.Error(), "encode arg 0 failed") {
+		t.Errorf("got error %v", err)
+	}
+}
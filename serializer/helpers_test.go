@@ -0,0 +1,42 @@
+package serializer
+
+import (
+	"reflect"
+)
+
+// valuesOf returns the values of args, a nil arg is a nil interface{}.
+func valuesOf(args ...interface{}) []reflect.Value {
+	values := make([]reflect.Value, 0, len(args))
+	for _, arg := range args {
+		if arg == nil {
+			values = append(values, reflect.ValueOf((*interface{})(nil)).Elem())
+			continue
+		}
+		values = append(values, reflect.ValueOf(arg))
+	}
+	return values
+}
+
+// typesOf returns the types of args.
+func typesOf(args ...interface{}) []reflect.Type {
+	types := make([]reflect.Type, 0, len(args))
+	for _, arg := range args {
+		types = append(types, reflect.TypeOf(arg))
+	}
+	return types
+}
+
+// interfacesOf returns the interfaces of values, a nil interface{} for an invalid or nil interface value.
+func interfacesOf(values []reflect.Value) []interface{} {
+	args := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		if !value.IsValid() || value.Kind() == reflect.Interface && value.IsNil() {
+			args = append(args, nil)
+			continue
+		}
+		args = append(args, value.Interface())
+	}
+	return args
+}
+
+var interfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
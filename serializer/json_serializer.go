@@ -0,0 +1,182 @@
+package serializer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jeremyxu2010/matrix-saga-go/redact"
+	"reflect"
+)
+
+// jsonArg is an argument encoded by JsonSerializer, such as {"type":"github.com/foo/order.Order","value":{"No":"1"}}.
+type jsonArg struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+type jsonPayloads struct {
+	Args []jsonArg `json:"args"`
+	// Sealed are the original arguments encrypted, when the readable args are redacted
+	Sealed []byte `json:"sealed,omitempty"`
+}
+
+// JsonSerializer encodes the arguments as JSON with their type names, so the payloads stored by the coordinator are readable.
+// Its payloads are never compressed, whatever the compress threshold of the saga agent.
+// It decodes the arguments into the parameter types of the compensation function,
+// or into the registered types, see RegisterType, if the parameter types are unknown or are interfaces.
+type JsonSerializer struct {
+	// sealer encrypts the original arguments of the redacted payloads
+	sealer Serializer
+}
+
+func NewJsonSerializer() Serializer {
+	return &JsonSerializer{}
+}
+
+// NewRedactingJsonSerializer creates a JsonSerializer whose readable arguments are masked by the default redactor, see redact.Value,
+// such as the fields tagged `saga:"redact"`. The original arguments are encrypted with the keys of keys next to them,
+// and the compensation functions get the original arguments decrypted.
+func NewRedactingJsonSerializer(keys KeyProvider) Serializer {
+	return &JsonSerializer{
+		sealer: NewEncryptingSerializer(&JsonSerializer{}, keys),
+	}
+}
+
+func (s *JsonSerializer) SerializerId() string {
+	if s.sealer != nil {
+		return "json-sealed"
+	}
+	return "json"
+}
+
+// Authenticates returns whether the original arguments are sealed by an authenticated encryption.
+func (s *JsonSerializer) Authenticates() bool {
+	return s.sealer != nil
+}
+
+func (s *JsonSerializer) Serialize(values []reflect.Value) ([]byte, error) {
+	return s.SerializeBound(values, nil)
+}
+
+func (s *JsonSerializer) Unserialize(payloads []byte, paramTypes []reflect.Type) ([]reflect.Value, error) {
+	return s.UnserializeBound(payloads, paramTypes, nil)
+}
+
+// SerializeBound serializes values, the original arguments of the redacted payloads are sealed bound to binding, see BindingSerializer.
+func (s *JsonSerializer) SerializeBound(values []reflect.Value, binding []byte) ([]byte, error) {
+	if s.sealer == nil {
+		return s.serialize(values, nil)
+	}
+	sealed, err := SerializeBound(s.sealer, values, binding)
+	if err != nil {
+		return nil, err
+	}
+	redacted := make([]reflect.Value, 0, len(values))
+	for _, value := range values {
+		redacted = append(redacted, redact.Value(value))
+	}
+	return s.serialize(redacted, sealed)
+}
+
+func (s *JsonSerializer) serialize(values []reflect.Value, sealed []byte) ([]byte, error) {
+	payloads := jsonPayloads{
+		Args: make([]jsonArg, 0, len(values)),
+	}
+	for i, value := range values {
+		value = concrete(value)
+		arg := jsonArg{
+			Type:  "nil",
+			Value: json.RawMessage("null"),
+		}
+		if value.IsValid() && !isNil(value) {
+			b, err := json.Marshal(value.Interface())
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("encode arg %d failed, %v", i, err))
+			}
+			arg.Type = TypeName(value.Type())
+			arg.Value = b
+		}
+		payloads.Args = append(payloads.Args, arg)
+	}
+	payloads.Sealed = sealed
+	return json.Marshal(&payloads)
+}
+
+// Open returns the sealed original arguments of the redacted payloads and the serializer decrypting them, see OpeningSerializer,
+// or the payloads themselves if they are not redacted.
+func (s *JsonSerializer) Open(payloads []byte, binding []byte) ([]byte, Serializer, error) {
+	if s.sealer == nil {
+		return payloads, s, nil
+	}
+	p := &jsonPayloads{}
+	if err := json.Unmarshal(payloads, p); err != nil {
+		return nil, nil, errors.New(fmt.Sprintf("decode values failed, %v", err))
+	}
+	if len(p.Sealed) == 0 {
+		return nil, nil, errors.New("payloads are not sealed")
+	}
+	return p.Sealed, s.sealer, nil
+}
+
+// UnserializeBound decodes payloads, the sealed original arguments of the redacted payloads are rejected unless they are bound to binding.
+func (s *JsonSerializer) UnserializeBound(payloads []byte, paramTypes []reflect.Type, binding []byte) ([]reflect.Value, error) {
+	p := &jsonPayloads{}
+	if err := json.Unmarshal(payloads, p); err != nil {
+		return nil, errors.New(fmt.Sprintf("decode values failed, %v", err))
+	}
+	if s.sealer != nil {
+		if len(p.Sealed) == 0 {
+			return nil, errors.New("payloads are not sealed")
+		}
+		return UnserializeBound(s.sealer, p.Sealed, paramTypes, binding)
+	}
+	if len(p.Sealed) > 0 {
+		return nil, errors.New("payloads are sealed, decode them with serializer.NewRedactingJsonSerializer")
+	}
+	if err := checkArgCount(len(p.Args), paramTypes); err != nil {
+		return nil, err
+	}
+	values := make([]reflect.Value, 0, len(p.Args))
+	for i, arg := range p.Args {
+		var paramType reflect.Type
+		if paramTypes != nil {
+			paramType = paramTypes[i]
+		}
+		value, err := decodeJsonArg(arg, paramType)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("decode arg %d failed, %v", i, err))
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// decodeJsonArg decodes arg into paramType, or the registered type of arg if paramType is nil or an interface.
+func decodeJsonArg(arg jsonArg, paramType reflect.Type) (reflect.Value, error) {
+	t := paramType
+	if t == nil || t.Kind() == reflect.Interface {
+		if arg.Type == "nil" || bytes.Equal(arg.Value, []byte("null")) {
+			if paramType == nil {
+				return reflect.ValueOf((*interface{})(nil)).Elem(), nil
+			}
+			return reflect.Zero(paramType), nil
+		}
+		registered, ok := LookupType(arg.Type)
+		if !ok {
+			return reflect.Value{}, errors.New(fmt.Sprintf("type %s is not registered, register it with serializer.RegisterType", arg.Type))
+		}
+		if paramType != nil && !registered.AssignableTo(paramType) {
+			return reflect.Value{}, errors.New(fmt.Sprintf("type %s is not assignable to %v", arg.Type, paramType))
+		}
+		t = registered
+	}
+	ptr := reflect.New(t)
+	if err := json.Unmarshal(arg.Value, ptr.Interface()); err != nil {
+		return reflect.Value{}, err
+	}
+	if paramType != nil {
+		return ptr.Elem().Convert(paramType), nil
+	}
+	return ptr.Elem(), nil
+}
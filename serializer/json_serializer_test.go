@@ -0,0 +1,175 @@
+package serializer
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type jsonOrder struct {
+	No     string
+	Amount int
+	Items  []string
+}
+
+// jsonUnregistered is never registered with RegisterType.
+type jsonUnregistered struct {
+	No string
+}
+
+func init() {
+	RegisterType(jsonOrder{})
+}
+
+func TestJsonSerializerRoundTrip(t *testing.T) {
+	order := jsonOrder{No: "1", Amount: 2, Items: []string{"a", "b"}}
+	cases := []struct {
+		name       string
+		args       []interface{}
+		paramTypes []reflect.Type
+		want       []interface{}
+	}{
+		{"basic types", []interface{}{"o1", 3, true, 1.5}, typesOf("", 0, false, 0.0), nil},
+		{"struct", []interface{}{order}, typesOf(order), nil},
+		{"pointer", []interface{}{&order}, typesOf(&order), nil},
+		{"nil pointer", []interface{}{(*jsonOrder)(nil)}, typesOf(&order), nil},
+		{"map and slice", []interface{}{map[string]int{"a": 1}, []string{"x"}}, typesOf(map[string]int{}, []string{}), nil},
+		{"nil into interface", []interface{}{nil}, []reflect.Type{interfaceType}, nil},
+		{"registered type into interface", []interface{}{order}, []reflect.Type{interfaceType}, nil},
+		{"registered pointer into interface", []interface{}{&order}, []reflect.Type{interfaceType}, nil},
+		{"registered types without param types", []interface{}{"o1", int64(3), order}, nil, nil},
+		{"number into another numeric type", []interface{}{3}, typesOf(int32(0)), []interface{}{int32(3)}},
+	}
+	s := NewJsonSerializer()
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			payloads, err := s.Serialize(valuesOf(c.args...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			values, err := s.Unserialize(payloads, c.paramTypes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := c.want
+			if want == nil {
+				want = c.args
+			}
+			if got := interfacesOf(values); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %#v, want %#v", got, want)
+			}
+			for i, value := range values {
+				if c.paramTypes != nil && value.Type() != c.paramTypes[i] {
+					t.Errorf("arg %d is decoded into %v, want %v", i, value.Type(), c.paramTypes[i])
+				}
+			}
+		})
+	}
+}
+
+func TestJsonSerializerPayloadsAreReadable(t *testing.T) {
+	payloads, err := NewJsonSerializer().Serialize(valuesOf(jsonOrder{No: "1"}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"args":[{"type":"github.com/jeremyxu2010/matrix-saga-go/serializer.jsonOrder","value":{"No":"1","Amount":0,"Items":null}},{"type":"nil","value":null}]}`
+	if string(payloads) != want {
+		t.Errorf("got %s, want %s", payloads, want)
+	}
+}
+
+func TestJsonSerializerErrors(t *testing.T) {
+	s := NewJsonSerializer()
+	encode := func(args ...interface{}) []byte {
+		payloads, err := s.Serialize(valuesOf(args...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return payloads
+	}
+	cases := []struct {
+		name       string
+		payloads   []byte
+		paramTypes []reflect.Type
+		err        string
+	}{
+		{"malformed", []byte("{"), nil, "decode values failed"},
+		{"too few args", encode("a"), typesOf("", ""), "1 args for 2 params"},
+		{"too many args", encode("a", "b"), typesOf(""), "2 args for 1 params"},
+		{"unregistered type", encode(jsonUnregistered{No: "1"}), []reflect.Type{interfaceType},
+			"type github.com/jeremyxu2010/matrix-saga-go/serializer.jsonUnregistered is not registered"},
+		{"unregistered type without param types", encode(jsonUnregistered{No: "1"}), nil, "is not registered"},
+		{"type not assignable to the interface", encode(1), []reflect.Type{reflect.TypeOf((*fmt.Stringer)(nil)).Elem()},
+			"type int is not assignable to fmt.Stringer"},
+		{"value not decodable into the param type", encode("a"), typesOf(0), "decode arg 0 failed"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := s.Unserialize(c.payloads, c.paramTypes)
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("got error %v, want %q", err, c.err)
+			}
+		})
+	}
+	if _, err := s.Serialize(valuesOf(make(chan int))); err == nil || !strings.Contains(err.Error(), "encode arg 0 failed") {
+		t.Errorf("got error %v", err)
+	}
+}
+
+type jsonTransfer struct {
+	From     string
+	Password string `saga:"redact"`
+}
+
+func TestRedactingJsonSerializer(t *testing.T) {
+	s := NewRedactingJsonSerializer(testKeys("k1"))
+	if id := SerializerId(s); id != "json-sealed" || !Authenticates(s) {
+		t.Errorf("got serializer id %s", id)
+	}
+	transfer := jsonTransfer{From: "a1", Password: "secret"}
+	binding := PayloadsBinding("main.Cancel", "g1", "l1")
+	payloads, err := SerializeBound(s, valuesOf(transfer), binding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(payloads, []byte("secret")) || !bytes.Contains(payloads, []byte(`"Password":"******"`)) {
+		t.Errorf("payloads are not redacted, %s", payloads)
+	}
+	values, err := UnserializeBound(s, payloads, typesOf(transfer), binding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := interfacesOf(values); !reflect.DeepEqual(got, []interface{}{transfer}) {
+		t.Errorf("got %+v", got)
+	}
+
+	plain, err := NewJsonSerializer().Serialize(valuesOf(transfer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name     string
+		s        Serializer
+		payloads []byte
+		binding  []byte
+		err      string
+	}{
+		{"another binding", s, payloads, PayloadsBinding("main.Cancel", "g2", "l1"), "bound to another compensation"},
+		{"no binding", s, payloads, nil, "bound to another compensation"},
+		{"another key", NewRedactingJsonSerializer(NewStaticKeyProvider("k1", map[string][]byte{"k1": bytes.Repeat([]byte{9}, 32)})),
+			payloads, binding, "the payloads are tampered"},
+		{"not sealed", s, plain, binding, "payloads are not sealed"},
+		{"sealed payloads decoded by the plain serializer", NewJsonSerializer(), payloads, binding,
+			"payloads are sealed, decode them with serializer.NewRedactingJsonSerializer"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := UnserializeBound(c.s, c.payloads, typesOf(transfer), c.binding)
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("got error %v, want %q", err, c.err)
+			}
+		})
+	}
+}
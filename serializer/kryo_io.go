@@ -0,0 +1,321 @@
+package serializer
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"unicode/utf16"
+)
+
+// kryoOutput writes the primitives in the formats of com.esotericsoftware.kryo.io.Output.
+type kryoOutput struct {
+	buf []byte
+}
+
+func (o *kryoOutput) writeByte(b byte) {
+	o.buf = append(o.buf, b)
+}
+
+// writeVarInt writes a varint of at most 5 bytes, zigzag encoded unless optimizePositive.
+func (o *kryoOutput) writeVarInt(v int32, optimizePositive bool) {
+	u := uint32(v)
+	if !optimizePositive {
+		u = uint32((v << 1) ^ (v >> 31))
+	}
+	for i := 0; i < 4 && u>>7 != 0; i++ {
+		o.buf = append(o.buf, byte(u&0x7f|0x80))
+		u >>= 7
+	}
+	o.buf = append(o.buf, byte(u))
+}
+
+// writeVarLong writes a varint of at most 9 bytes, the 9th byte carries 8 bits.
+func (o *kryoOutput) writeVarLong(v int64, optimizePositive bool) {
+	u := uint64(v)
+	if !optimizePositive {
+		u = uint64((v << 1) ^ (v >> 63))
+	}
+	for i := 0; i < 8 && u>>7 != 0; i++ {
+		o.buf = append(o.buf, byte(u&0x7f|0x80))
+		u >>= 7
+	}
+	o.buf = append(o.buf, byte(u))
+}
+
+func (o *kryoOutput) writeShort(v int16) {
+	o.buf = append(o.buf, byte(uint16(v)>>8), byte(v))
+}
+
+func (o *kryoOutput) writeChar(v uint16) {
+	o.buf = append(o.buf, byte(v>>8), byte(v))
+}
+
+func (o *kryoOutput) writeInt(v int32) {
+	o.buf = append(o.buf, byte(uint32(v)>>24), byte(uint32(v)>>16), byte(uint32(v)>>8), byte(v))
+}
+
+func (o *kryoOutput) writeLong(v int64) {
+	o.writeInt(int32(v >> 32))
+	o.writeInt(int32(v))
+}
+
+func (o *kryoOutput) writeFloat(v float32) {
+	o.writeInt(int32(math.Float32bits(v)))
+}
+
+func (o *kryoOutput) writeDouble(v float64) {
+	o.writeLong(int64(math.Float64bits(v)))
+}
+
+func (o *kryoOutput) writeBoolean(v bool) {
+	if v {
+		o.buf = append(o.buf, 1)
+	} else {
+		o.buf = append(o.buf, 0)
+	}
+}
+
+// writeString writes s as 2 to 63 ASCII characters with the high bit set on the last one,
+// or as the UTF-16 length plus one followed by the characters in UTF-8.
+func (o *kryoOutput) writeString(s string) {
+	chars := utf16.Encode([]rune(s))
+	if len(chars) == 0 {
+		o.buf = append(o.buf, 1|0x80)
+		return
+	}
+	if len(chars) > 1 && len(chars) < 64 && isASCII(s) {
+		o.buf = append(o.buf, s...)
+		o.buf[len(o.buf)-1] |= 0x80
+		return
+	}
+	o.writeUtf8Length(uint32(len(chars) + 1))
+	for _, c := range chars {
+		switch {
+		case c <= 0x7f:
+			o.buf = append(o.buf, byte(c))
+		case c > 0x7ff:
+			o.buf = append(o.buf, byte(0xe0|c>>12&0x0f), byte(0x80|c>>6&0x3f), byte(0x80|c&0x3f))
+		default:
+			o.buf = append(o.buf, byte(0xc0|c>>6&0x1f), byte(0x80|c&0x3f))
+		}
+	}
+}
+
+func (o *kryoOutput) writeUtf8Length(v uint32) {
+	if v>>6 == 0 {
+		o.buf = append(o.buf, byte(v|0x80))
+		return
+	}
+	o.buf = append(o.buf, byte(v&0x3f|0x40|0x80))
+	v >>= 6
+	for v>>7 != 0 {
+		o.buf = append(o.buf, byte(v&0x7f|0x80))
+		v >>= 7
+	}
+	o.buf = append(o.buf, byte(v))
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] > 127 {
+			return false
+		}
+	}
+	return true
+}
+
+var errKryoBufferUnderflow = errors.New("buffer underflow")
+
+// kryoInput reads the primitives in the formats of com.esotericsoftware.kryo.io.Input.
+type kryoInput struct {
+	buf []byte
+	pos int
+}
+
+func (in *kryoInput) readByte() (byte, error) {
+	if in.pos >= len(in.buf) {
+		return 0, errKryoBufferUnderflow
+	}
+	b := in.buf[in.pos]
+	in.pos++
+	return b, nil
+}
+
+// checkCount rejects a count of items read, each of which takes at least one byte, if it exceeds the remaining bytes,
+// so a corrupted length does not allocate a huge buffer.
+func (in *kryoInput) checkCount(n int64) error {
+	if n < 0 || n > int64(len(in.buf)-in.pos) {
+		return errors.New(fmt.Sprintf("invalid length %d, %d bytes remain", n, len(in.buf)-in.pos))
+	}
+	return nil
+}
+
+func (in *kryoInput) readBytes(n int) ([]byte, error) {
+	if n < 0 || in.pos+n > len(in.buf) {
+		return nil, errKryoBufferUnderflow
+	}
+	b := in.buf[in.pos : in.pos+n]
+	in.pos += n
+	return b, nil
+}
+
+func (in *kryoInput) readVarInt(optimizePositive bool) (int32, error) {
+	var u uint32
+	for i := uint(0); i < 5; i++ {
+		b, err := in.readByte()
+		if err != nil {
+			return 0, err
+		}
+		if i == 4 {
+			u |= uint32(b) << 28
+			break
+		}
+		u |= uint32(b&0x7f) << (7 * i)
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	if !optimizePositive {
+		return int32(u>>1) ^ -int32(u&1), nil
+	}
+	return int32(u), nil
+}
+
+func (in *kryoInput) readVarLong(optimizePositive bool) (int64, error) {
+	var u uint64
+	for i := uint(0); i < 9; i++ {
+		b, err := in.readByte()
+		if err != nil {
+			return 0, err
+		}
+		if i == 8 {
+			u |= uint64(b) << 56
+			break
+		}
+		u |= uint64(b&0x7f) << (7 * i)
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	if !optimizePositive {
+		return int64(u>>1) ^ -int64(u&1), nil
+	}
+	return int64(u), nil
+}
+
+func (in *kryoInput) readShort() (int16, error) {
+	b, err := in.readBytes(2)
+	if err != nil {
+		return 0, err
+	}
+	return int16(uint16(b[0])<<8 | uint16(b[1])), nil
+}
+
+func (in *kryoInput) readChar() (uint16, error) {
+	b, err := in.readBytes(2)
+	if err != nil {
+		return 0, err
+	}
+	return uint16(b[0])<<8 | uint16(b[1]), nil
+}
+
+func (in *kryoInput) readInt() (int32, error) {
+	b, err := in.readBytes(4)
+	if err != nil {
+		return 0, err
+	}
+	return int32(uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])), nil
+}
+
+func (in *kryoInput) readLong() (int64, error) {
+	hi, err := in.readInt()
+	if err != nil {
+		return 0, err
+	}
+	lo, err := in.readInt()
+	if err != nil {
+		return 0, err
+	}
+	return int64(hi)<<32 | int64(uint32(lo)), nil
+}
+
+func (in *kryoInput) readFloat() (float32, error) {
+	v, err := in.readInt()
+	return math.Float32frombits(uint32(v)), err
+}
+
+func (in *kryoInput) readDouble() (float64, error) {
+	v, err := in.readLong()
+	return math.Float64frombits(uint64(v)), err
+}
+
+func (in *kryoInput) readBoolean() (bool, error) {
+	b, err := in.readByte()
+	return b == 1, err
+}
+
+// readString returns false for a null string.
+func (in *kryoInput) readString() (string, bool, error) {
+	b, err := in.readByte()
+	if err != nil {
+		return "", false, err
+	}
+	if b&0x80 == 0 {
+		// ASCII characters, the last one has the high bit set
+		start := in.pos - 1
+		for b&0x80 == 0 {
+			if b, err = in.readByte(); err != nil {
+				return "", false, err
+			}
+		}
+		s := make([]byte, in.pos-start)
+		copy(s, in.buf[start:in.pos])
+		s[len(s)-1] &= 0x7f
+		return string(s), true, nil
+	}
+	length := uint32(b & 0x3f)
+	if b&0x40 != 0 {
+		for shift := uint(6); shift <= 27; shift += 7 {
+			if b, err = in.readByte(); err != nil {
+				return "", false, err
+			}
+			length |= uint32(b&0x7f) << shift
+			if b&0x80 == 0 {
+				break
+			}
+		}
+	}
+	switch length {
+	case 0:
+		return "", false, nil
+	case 1:
+		return "", true, nil
+	}
+	if err := in.checkCount(int64(length) - 1); err != nil {
+		return "", false, err
+	}
+	chars := make([]uint16, 0, length-1)
+	for i := uint32(0); i < length-1; i++ {
+		b, err := in.readByte()
+		if err != nil {
+			return "", false, err
+		}
+		switch b >> 4 {
+		case 12, 13:
+			b1, err := in.readByte()
+			if err != nil {
+				return "", false, err
+			}
+			chars = append(chars, uint16(b&0x1f)<<6|uint16(b1&0x3f))
+		case 14:
+			b12, err := in.readBytes(2)
+			if err != nil {
+				return "", false, err
+			}
+			chars = append(chars, uint16(b&0x0f)<<12|uint16(b12[0]&0x3f)<<6|uint16(b12[1]&0x3f))
+		default:
+			chars = append(chars, uint16(b))
+		}
+	}
+	return string(utf16.Decode(chars)), true, nil
+}
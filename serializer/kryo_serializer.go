@@ -0,0 +1,782 @@
+package serializer
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// The reference markers and the ids of the classes registered by default in Kryo 4, the class ids are written plus 2.
+const (
+	kryoNull    = 0
+	kryoNotNull = 1
+	// kryoClassName marks a class written by name, it is kryoNotNull as well since the class ids are written plus 2
+	kryoClassName = 1
+
+	kryoInt     = 0
+	kryoString  = 1
+	kryoFloat   = 2
+	kryoBoolean = 3
+	kryoByte    = 4
+	kryoChar    = 5
+	kryoShort   = 6
+	kryoLong    = 7
+	kryoDouble  = 8
+	kryoVoid    = 9
+)
+
+const (
+	javaArrayList   = "java.util.ArrayList"
+	javaHashMap     = "java.util.HashMap"
+	javaDate        = "java.util.Date"
+	javaByteArray   = "[B"
+	javaObjectArray = "[Ljava.lang.Object;"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+var (
+	javaClassesLock sync.RWMutex
+	javaClassTypes  = make(map[string]reflect.Type)
+	javaClassNames  = make(map[reflect.Type]string)
+)
+
+// RegisterJavaClass maps the Java bean class className, such as "com.foo.order.Order", to the struct type of value.
+// The beans are written by the Kryo FieldSerializer, so the exported fields of the struct must match the non-static,
+// non-transient fields of the Java class, including those of its super classes, and the Java class must not be final.
+// The Java field name is taken from the `java` tag of the field, or is the field name with its first letter in lower case.
+// The fields of the embedded structs are promoted like the fields of the super classes.
+func RegisterJavaClass(className string, value interface{}) {
+	t := reflect.TypeOf(value)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	javaClassesLock.Lock()
+	defer javaClassesLock.Unlock()
+	javaClassTypes[className] = t
+	javaClassNames[t] = className
+}
+
+func lookupJavaClass(className string) (reflect.Type, bool) {
+	javaClassesLock.RLock()
+	defer javaClassesLock.RUnlock()
+	t, ok := javaClassTypes[className]
+	return t, ok
+}
+
+func lookupJavaClassName(t reflect.Type) (string, bool) {
+	javaClassesLock.RLock()
+	defer javaClassesLock.RUnlock()
+	name, ok := javaClassNames[t]
+	return name, ok
+}
+
+// KryoSerializer reads and writes the payloads of the Java omega, which are the arguments as Object[] serialized by Kryo 4
+// with its default settings, so the sagas can span the services in Go and in Java.
+//
+// The Go values are written as the following Java types:
+//
+//	bool, int8, uint8, int16, uint16, int and int32, int64, float32, float64: Boolean, Byte, Byte, Short, Character, Integer, Long, Float, Double
+//	string: String
+//	[]byte: byte[]
+//	the other slices and arrays: ArrayList
+//	maps: HashMap
+//	time.Time: Date
+//	the structs registered by RegisterJavaClass: the registered bean classes
+//
+// Pointers are written as the values they point to. The collections and the maps are decoded as []interface{}
+// and map[interface{}]interface{}, which are converted to the parameter types of the compensation function.
+type KryoSerializer struct {
+}
+
+func NewKryoSerializer() Serializer {
+	return &KryoSerializer{}
+}
+
+func (s *KryoSerializer) SerializerId() string {
+	return "kryo"
+}
+
+// Raw returns true, the payloads are sent without the envelope to be read by the Java omega.
+func (s *KryoSerializer) Raw() bool {
+	return true
+}
+
+func (s *KryoSerializer) Serialize(values []reflect.Value) ([]byte, error) {
+	w := &kryoWriter{}
+	w.writeVarInt(kryoNotNull, true)
+	w.writeVarInt(int32(len(values)+1), true)
+	for i, value := range values {
+		if err := w.writeClassAndObject(value); err != nil {
+			return nil, errors.New(fmt.Sprintf("encode arg %d failed, %v", i, err))
+		}
+	}
+	return w.buf, nil
+}
+
+func (s *KryoSerializer) Unserialize(payloads []byte, paramTypes []reflect.Type) ([]reflect.Value, error) {
+	r := &kryoReader{
+		kryoInput: kryoInput{buf: payloads},
+	}
+	args, err := r.readArgs()
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("decode values failed, %v", err))
+	}
+	if err := checkArgCount(len(args), paramTypes); err != nil {
+		return nil, err
+	}
+	values := make([]reflect.Value, 0, len(args))
+	for i, arg := range args {
+		if paramTypes == nil {
+			if arg == nil {
+				values = append(values, reflect.ValueOf((*interface{})(nil)).Elem())
+			} else {
+				values = append(values, reflect.ValueOf(arg))
+			}
+			continue
+		}
+		value, err := kryoAssign(arg, paramTypes[i])
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("decode arg %d failed, %v", i, err))
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// javaField is a field of a bean, the fields are written in the order of their Java names.
+type javaField struct {
+	name  string
+	index []int
+}
+
+func javaFields(t reflect.Type) []javaField {
+	fields := make([]javaField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("java")
+		if tag == "-" {
+			continue
+		}
+		if f.Anonymous && len(tag) == 0 && f.Type.Kind() == reflect.Struct {
+			for _, embedded := range javaFields(f.Type) {
+				fields = append(fields, javaField{
+					name:  embedded.name,
+					index: append([]int{i}, embedded.index...),
+				})
+			}
+			continue
+		}
+		if len(f.PkgPath) > 0 {
+			// unexported
+			continue
+		}
+		name := tag
+		if len(name) == 0 {
+			runes := []rune(f.Name)
+			runes[0] = unicode.ToLower(runes[0])
+			name = string(runes)
+		}
+		fields = append(fields, javaField{
+			name:  name,
+			index: []int{i},
+		})
+	}
+	sort.SliceStable(fields, func(i, j int) bool {
+		return fields[i].name < fields[j].name
+	})
+	return fields
+}
+
+// primitiveClassId returns the id of the Java primitive class of kind.
+func primitiveClassId(kind reflect.Kind) (int32, bool) {
+	switch kind {
+	case reflect.Bool:
+		return kryoBoolean, true
+	case reflect.Int8, reflect.Uint8:
+		return kryoByte, true
+	case reflect.Uint16:
+		return kryoChar, true
+	case reflect.Int16:
+		return kryoShort, true
+	case reflect.Int, reflect.Int32:
+		return kryoInt, true
+	case reflect.Int64:
+		return kryoLong, true
+	case reflect.Float32:
+		return kryoFloat, true
+	case reflect.Float64:
+		return kryoDouble, true
+	}
+	return 0, false
+}
+
+func isPrimitiveKind(kind reflect.Kind) bool {
+	_, ok := primitiveClassId(kind)
+	return ok
+}
+
+type kryoWriter struct {
+	kryoOutput
+	// classNameIds are the ids of the class names written, a class name is only written the first time
+	classNameIds map[string]int32
+}
+
+func (w *kryoWriter) writeClassName(className string) {
+	w.writeVarInt(kryoClassName, true)
+	if id, ok := w.classNameIds[className]; ok {
+		w.writeVarInt(id, true)
+		return
+	}
+	if w.classNameIds == nil {
+		w.classNameIds = make(map[string]int32)
+	}
+	id := int32(len(w.classNameIds))
+	w.classNameIds[className] = id
+	w.writeVarInt(id, true)
+	w.writeString(className)
+}
+
+// writeClassAndObject writes value like Kryo.writeClassAndObject, the objects are never written as references to the
+// objects written before, the markers of the new objects are written instead.
+func (w *kryoWriter) writeClassAndObject(value reflect.Value) error {
+	value = concrete(value)
+	for value.IsValid() && value.Kind() == reflect.Ptr && !value.IsNil() {
+		value = value.Elem()
+	}
+	if !value.IsValid() || isNil(value) {
+		w.writeVarInt(kryoNull, true)
+		return nil
+	}
+	if value.Type() == timeType {
+		w.writeClassName(javaDate)
+		w.writeVarInt(kryoNotNull, true)
+		w.writeVarLong(value.Interface().(time.Time).UnixNano()/int64(time.Millisecond), true)
+		return nil
+	}
+	if id, ok := primitiveClassId(value.Kind()); ok {
+		w.writeVarInt(id+2, true)
+		return w.writePrimitive(value, id)
+	}
+	switch value.Kind() {
+	case reflect.String:
+		w.writeVarInt(kryoString+2, true)
+		w.writeVarInt(kryoNotNull, true)
+		w.writeString(value.String())
+	case reflect.Slice, reflect.Array:
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			w.writeClassName(javaByteArray)
+			w.writeVarInt(kryoNotNull, true)
+			w.writeVarInt(int32(value.Len()+1), true)
+			for i := 0; i < value.Len(); i++ {
+				w.writeByte(byte(value.Index(i).Uint()))
+			}
+			return nil
+		}
+		w.writeClassName(javaArrayList)
+		w.writeVarInt(kryoNotNull, true)
+		w.writeVarInt(int32(value.Len()), true)
+		for i := 0; i < value.Len(); i++ {
+			if err := w.writeClassAndObject(value.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		w.writeClassName(javaHashMap)
+		w.writeVarInt(kryoNotNull, true)
+		w.writeVarInt(int32(value.Len()), true)
+		keys := value.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		for _, key := range keys {
+			if err := w.writeClassAndObject(key); err != nil {
+				return err
+			}
+			if err := w.writeClassAndObject(value.MapIndex(key)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		className, ok := lookupJavaClassName(value.Type())
+		if !ok {
+			return errors.New(fmt.Sprintf("type %v is not mapped to a java class, register it with serializer.RegisterJavaClass", value.Type()))
+		}
+		w.writeClassName(className)
+		w.writeVarInt(kryoNotNull, true)
+		for _, f := range javaFields(value.Type()) {
+			if err := w.writeField(value.FieldByIndex(f.index)); err != nil {
+				return errors.New(fmt.Sprintf("field %s of %s, %v", f.name, className, err))
+			}
+		}
+	default:
+		return errors.New(fmt.Sprintf("type %v is not supported", value.Type()))
+	}
+	return nil
+}
+
+// writeField writes a field of a bean like the Kryo FieldSerializer: the primitive fields are written without any marker,
+// the String fields and the pointers to the primitives, which are the final classes String and the wrappers in Java,
+// with the null marker, and the other fields with their classes.
+func (w *kryoWriter) writeField(value reflect.Value) error {
+	t := value.Type()
+	if id, ok := primitiveClassId(t.Kind()); ok {
+		return w.writePrimitive(value, id)
+	}
+	if t.Kind() == reflect.String {
+		w.writeVarInt(kryoNotNull, true)
+		w.writeString(value.String())
+		return nil
+	}
+	if t.Kind() == reflect.Ptr {
+		if t.Elem().Kind() == reflect.String {
+			if value.IsNil() {
+				w.writeVarInt(kryoNull, true)
+				return nil
+			}
+			w.writeVarInt(kryoNotNull, true)
+			w.writeString(value.Elem().String())
+			return nil
+		}
+		if id, ok := primitiveClassId(t.Elem().Kind()); ok {
+			if value.IsNil() {
+				w.writeVarInt(kryoNull, true)
+				return nil
+			}
+			w.writeVarInt(kryoNotNull, true)
+			return w.writePrimitive(value.Elem(), id)
+		}
+	}
+	return w.writeClassAndObject(value)
+}
+
+func (w *kryoWriter) writePrimitive(value reflect.Value, id int32) error {
+	switch id {
+	case kryoBoolean:
+		w.writeBoolean(value.Bool())
+	case kryoByte:
+		if value.Kind() == reflect.Uint8 {
+			w.writeByte(byte(value.Uint()))
+		} else {
+			w.writeByte(byte(value.Int()))
+		}
+	case kryoChar:
+		w.writeChar(uint16(value.Uint()))
+	case kryoShort:
+		w.writeShort(int16(value.Int()))
+	case kryoInt:
+		v := value.Int()
+		if v < math.MinInt32 || v > math.MaxInt32 {
+			return errors.New(fmt.Sprintf("%d overflows java int", v))
+		}
+		w.writeVarInt(int32(v), false)
+	case kryoLong:
+		w.writeVarLong(value.Int(), false)
+	case kryoFloat:
+		w.writeFloat(float32(value.Float()))
+	case kryoDouble:
+		w.writeDouble(value.Float())
+	}
+	return nil
+}
+
+type kryoReader struct {
+	kryoInput
+	// classNames are the class names read by their ids
+	classNames map[int32]string
+	// refs are the objects read by their reference ids, nil until an object is read completely
+	refs []interface{}
+}
+
+func (r *kryoReader) readArgs() ([]interface{}, error) {
+	marker, err := r.readVarInt(true)
+	if err != nil {
+		return nil, err
+	}
+	if marker == kryoNull {
+		return []interface{}{}, nil
+	}
+	if marker != kryoNotNull {
+		return nil, errors.New(fmt.Sprintf("unexpected reference %d", marker))
+	}
+	r.refs = append(r.refs, nil)
+	args, err := r.readObjects()
+	if err != nil {
+		return nil, err
+	}
+	if args == nil {
+		return []interface{}{}, nil
+	}
+	return args.([]interface{}), nil
+}
+
+// readObjects reads the elements of an Object[], the length is written plus 1.
+func (r *kryoReader) readObjects() (interface{}, error) {
+	length, err := r.readVarInt(true)
+	if err != nil || length == kryoNull {
+		return nil, err
+	}
+	if err := r.checkCount(int64(length) - 1); err != nil {
+		return nil, err
+	}
+	objects := make([]interface{}, 0, length-1)
+	for i := int32(0); i < length-1; i++ {
+		object, err := r.readClassAndObject()
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, object)
+	}
+	return objects, nil
+}
+
+// readClass returns the name of the class read, "" for null.
+func (r *kryoReader) readClass() (string, error) {
+	id, err := r.readVarInt(true)
+	if err != nil {
+		return "", err
+	}
+	switch id {
+	case kryoNull:
+		return "", nil
+	case kryoClassName:
+		nameId, err := r.readVarInt(true)
+		if err != nil {
+			return "", err
+		}
+		if name, ok := r.classNames[nameId]; ok {
+			return name, nil
+		}
+		name, _, err := r.readString()
+		if err != nil {
+			return "", err
+		}
+		if r.classNames == nil {
+			r.classNames = make(map[int32]string)
+		}
+		r.classNames[nameId] = name
+		return name, nil
+	}
+	switch id - 2 {
+	case kryoInt:
+		return "java.lang.Integer", nil
+	case kryoString:
+		return "java.lang.String", nil
+	case kryoFloat:
+		return "java.lang.Float", nil
+	case kryoBoolean:
+		return "java.lang.Boolean", nil
+	case kryoByte:
+		return "java.lang.Byte", nil
+	case kryoChar:
+		return "java.lang.Character", nil
+	case kryoShort:
+		return "java.lang.Short", nil
+	case kryoLong:
+		return "java.lang.Long", nil
+	case kryoDouble:
+		return "java.lang.Double", nil
+	case kryoVoid:
+		return "void", nil
+	}
+	return "", errors.New(fmt.Sprintf("unknown class id %d", id-2))
+}
+
+func (r *kryoReader) readClassAndObject() (interface{}, error) {
+	className, err := r.readClass()
+	if err != nil || len(className) == 0 {
+		return nil, err
+	}
+	switch className {
+	case "java.lang.Integer":
+		return r.readPrimitive(kryoInt)
+	case "java.lang.Float":
+		return r.readPrimitive(kryoFloat)
+	case "java.lang.Boolean":
+		return r.readPrimitive(kryoBoolean)
+	case "java.lang.Byte":
+		return r.readPrimitive(kryoByte)
+	case "java.lang.Character":
+		return r.readPrimitive(kryoChar)
+	case "java.lang.Short":
+		return r.readPrimitive(kryoShort)
+	case "java.lang.Long":
+		return r.readPrimitive(kryoLong)
+	case "java.lang.Double":
+		return r.readPrimitive(kryoDouble)
+	case "void":
+		return nil, nil
+	}
+	return r.readReference(func() (interface{}, error) {
+		return r.readObject(className)
+	})
+}
+
+// readReference reads the reference marker of an object, then the object by read unless it is a reference to an object read before.
+func (r *kryoReader) readReference(read func() (interface{}, error)) (interface{}, error) {
+	marker, err := r.readVarInt(true)
+	if err != nil {
+		return nil, err
+	}
+	switch marker {
+	case kryoNull:
+		return nil, nil
+	case kryoNotNull:
+		id := len(r.refs)
+		r.refs = append(r.refs, nil)
+		object, err := read()
+		if err != nil {
+			return nil, err
+		}
+		r.refs[id] = object
+		return object, nil
+	}
+	id := int(marker) - 2
+	if id < 0 {
+		return nil, errors.New(fmt.Sprintf("invalid reference %d", id))
+	}
+	if id >= len(r.refs) || r.refs[id] == nil {
+		return nil, errors.New(fmt.Sprintf("unresolved reference %d, the circular references are not supported", id))
+	}
+	return r.refs[id], nil
+}
+
+// readObject reads the object of className, its reference marker has been read.
+func (r *kryoReader) readObject(className string) (interface{}, error) {
+	switch className {
+	case "java.lang.String":
+		s, _, err := r.readString()
+		return s, err
+	case javaByteArray:
+		length, err := r.readVarInt(true)
+		if err != nil || length == kryoNull {
+			return nil, err
+		}
+		b, err := r.readBytes(int(length - 1))
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{}, b...), nil
+	case javaObjectArray:
+		return r.readObjects()
+	case javaDate:
+		millis, err := r.readVarLong(true)
+		if err != nil {
+			return nil, err
+		}
+		return time.Unix(0, millis*int64(time.Millisecond)), nil
+	case "java.util.Collections$EmptyList", "java.util.Collections$EmptySet":
+		return []interface{}{}, nil
+	case "java.util.Collections$EmptyMap":
+		return map[interface{}]interface{}{}, nil
+	case "java.util.Collections$SingletonList", "java.util.Collections$SingletonSet":
+		element, err := r.readClassAndObject()
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{element}, nil
+	case javaArrayList, "java.util.LinkedList", "java.util.Vector", "java.util.ArrayDeque",
+		"java.util.HashSet", "java.util.LinkedHashSet", "java.util.concurrent.CopyOnWriteArrayList":
+		return r.readCollection()
+	case "java.util.TreeSet":
+		if err := r.readComparator(); err != nil {
+			return nil, err
+		}
+		return r.readCollection()
+	case javaHashMap, "java.util.LinkedHashMap", "java.util.Hashtable", "java.util.concurrent.ConcurrentHashMap":
+		return r.readMap()
+	case "java.util.TreeMap":
+		if err := r.readComparator(); err != nil {
+			return nil, err
+		}
+		return r.readMap()
+	}
+	t, ok := lookupJavaClass(className)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("java class %s is not supported, register it with serializer.RegisterJavaClass", className))
+	}
+	ptr := reflect.New(t)
+	for _, f := range javaFields(t) {
+		if err := r.readField(ptr.Elem().FieldByIndex(f.index)); err != nil {
+			return nil, errors.New(fmt.Sprintf("field %s of %s, %v", f.name, className, err))
+		}
+	}
+	return ptr.Interface(), nil
+}
+
+// readComparator reads the comparator of a sorted collection, which must be null.
+func (r *kryoReader) readComparator() error {
+	comparator, err := r.readClassAndObject()
+	if err == nil && comparator != nil {
+		err = errors.New("the comparators are not supported")
+	}
+	return err
+}
+
+func (r *kryoReader) readCollection() (interface{}, error) {
+	length, err := r.readVarInt(true)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.checkCount(int64(length)); err != nil {
+		return nil, err
+	}
+	elements := make([]interface{}, 0, length)
+	for i := int32(0); i < length; i++ {
+		element, err := r.readClassAndObject()
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+	}
+	return elements, nil
+}
+
+func (r *kryoReader) readMap() (interface{}, error) {
+	length, err := r.readVarInt(true)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.checkCount(int64(length)); err != nil {
+		return nil, err
+	}
+	m := make(map[interface{}]interface{}, length)
+	for i := int32(0); i < length; i++ {
+		key, err := r.readClassAndObject()
+		if err != nil {
+			return nil, err
+		}
+		if key != nil && !reflect.TypeOf(key).Comparable() {
+			return nil, errors.New(fmt.Sprintf("map key of type %T is not supported", key))
+		}
+		value, err := r.readClassAndObject()
+		if err != nil {
+			return nil, err
+		}
+		m[key] = value
+	}
+	return m, nil
+}
+
+// readField reads a field of a bean into field, see kryoWriter.writeField.
+func (r *kryoReader) readField(field reflect.Value) error {
+	t := field.Type()
+	var (
+		value interface{}
+		err   error
+	)
+	if id, ok := primitiveClassId(t.Kind()); ok {
+		value, err = r.readPrimitive(id)
+	} else if t.Kind() == reflect.String || t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.String {
+		value, err = r.readReference(func() (interface{}, error) {
+			s, _, err := r.readString()
+			return s, err
+		})
+	} else if t.Kind() == reflect.Ptr && isPrimitiveKind(t.Elem().Kind()) {
+		id, _ := primitiveClassId(t.Elem().Kind())
+		var marker int32
+		marker, err = r.readVarInt(true)
+		if err == nil && marker != kryoNull {
+			value, err = r.readPrimitive(id)
+		}
+	} else {
+		value, err = r.readClassAndObject()
+	}
+	if err != nil {
+		return err
+	}
+	if value == nil {
+		return nil
+	}
+	v, err := kryoAssign(value, t)
+	if err != nil {
+		return err
+	}
+	field.Set(v)
+	return nil
+}
+
+func (r *kryoReader) readPrimitive(id int32) (interface{}, error) {
+	switch id {
+	case kryoBoolean:
+		return r.readBoolean()
+	case kryoByte:
+		b, err := r.readByte()
+		return int8(b), err
+	case kryoChar:
+		return r.readChar()
+	case kryoShort:
+		return r.readShort()
+	case kryoInt:
+		return r.readVarInt(false)
+	case kryoLong:
+		return r.readVarLong(false)
+	case kryoFloat:
+		return r.readFloat()
+	case kryoDouble:
+		return r.readDouble()
+	}
+	return nil, errors.New(fmt.Sprintf("unknown primitive class id %d", id))
+}
+
+// kryoAssign converts the object read to t, the collections and the maps are converted element by element.
+func kryoAssign(object interface{}, t reflect.Type) (reflect.Value, error) {
+	if object == nil {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+			return reflect.Zero(t), nil
+		}
+		return reflect.Value{}, errors.New(fmt.Sprintf("null can not be used as %v", t))
+	}
+	value := reflect.ValueOf(object)
+	if value.Type().AssignableTo(t) {
+		return value.Convert(t), nil
+	}
+	switch {
+	case value.Kind() == reflect.Ptr && t.Kind() != reflect.Ptr:
+		return kryoAssign(value.Elem().Interface(), t)
+	case t.Kind() == reflect.Ptr:
+		elem, err := kryoAssign(object, t.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		ptr := reflect.New(t.Elem())
+		ptr.Elem().Set(elem)
+		return ptr, nil
+	case t.Kind() == reflect.Slice && value.Kind() == reflect.Slice:
+		slice := reflect.MakeSlice(t, 0, value.Len())
+		for i := 0; i < value.Len(); i++ {
+			elem, err := kryoAssign(value.Index(i).Interface(), t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			slice = reflect.Append(slice, elem)
+		}
+		return slice, nil
+	case t.Kind() == reflect.Map && value.Kind() == reflect.Map:
+		m := reflect.MakeMapWithSize(t, value.Len())
+		for _, key := range value.MapKeys() {
+			k, err := kryoAssign(key.Interface(), t.Key())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			v, err := kryoAssign(value.MapIndex(key).Interface(), t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			m.SetMapIndex(k, v)
+		}
+		return m, nil
+	case t.Kind() == reflect.String && value.Kind() == reflect.Uint16:
+		// a Java char
+		return reflect.ValueOf(string(rune(value.Uint()))).Convert(t), nil
+	case basicConvertible(value.Kind(), t.Kind()) && value.Type().ConvertibleTo(t):
+		return value.Convert(t), nil
+	}
+	return reflect.Value{}, errors.New(fmt.Sprintf("%T can not be used as %v", object, t))
+}
@@ -0,0 +1,135 @@
+package serializer
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type kryoOrder struct {
+	No     string
+	Amount int32
+	Count  *int32
+}
+
+func init() {
+	RegisterJavaClass("com.foo.Order", kryoOrder{})
+}
+
+// The golden payloads in testdata/kryo are the bytes written by the KryoMessageFormat of the Java omega (Kryo 4),
+// testdata/kryo/GoldenPayloads.java regenerates them.
+var kryoGoldenCases = []struct {
+	name       string
+	paramTypes []reflect.Type
+	args       []interface{}
+	// encoded tells whether Serialize writes the golden payload, the Go strings have no identity to be written as references
+	encoded bool
+}{
+	{"string_int", typesOf("", int32(0)), []interface{}{"hello", int32(5)}, true},
+	{"string_reference", typesOf("", ""), []interface{}{"abc", "abc"}, false},
+	{"empty", []reflect.Type{}, []interface{}{}, true},
+	{"null", []reflect.Type{interfaceType}, []interface{}{nil}, true},
+	{"unicode_string", typesOf(""), []interface{}{"é"}, true},
+	{"bean", typesOf(kryoOrder{}), []interface{}{kryoOrder{No: "A1", Amount: 7}}, true},
+	{"array_list", typesOf([]int32{}), []interface{}{[]int32{1, 2}}, true},
+	{"class_name_reference", typesOf([]string{}, []string{}), []interface{}{[]string{}, []string{}}, true},
+	{"date", typesOf(time.Time{}), []interface{}{time.Unix(1, 0)}, true},
+	{"hash_map", typesOf(map[string]string{}), []interface{}{map[string]string{"k": "v"}}, true},
+}
+
+func readKryoGolden(t *testing.T, name string) []byte {
+	payloads, err := ioutil.ReadFile(filepath.Join("testdata", "kryo", name+".bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return payloads
+}
+
+func TestKryoSerializerDecodesJavaPayloads(t *testing.T) {
+	s := NewKryoSerializer()
+	for _, c := range kryoGoldenCases {
+		t.Run(c.name, func(t *testing.T) {
+			values, err := s.Unserialize(readKryoGolden(t, c.name), c.paramTypes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := interfacesOf(values); !reflect.DeepEqual(got, c.args) {
+				t.Errorf("got %#v, want %#v", got, c.args)
+			}
+		})
+	}
+}
+
+func TestKryoSerializerEncodesJavaPayloads(t *testing.T) {
+	s := NewKryoSerializer()
+	for _, c := range kryoGoldenCases {
+		if !c.encoded {
+			continue
+		}
+		t.Run(c.name, func(t *testing.T) {
+			payloads, err := s.Serialize(valuesOf(c.args...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := readKryoGolden(t, c.name); !bytes.Equal(payloads, want) {
+				t.Errorf("got % x, want % x", payloads, want)
+			}
+		})
+	}
+}
+
+func TestKryoSerializerRoundTrip(t *testing.T) {
+	count := int32(3)
+	s := NewKryoSerializer()
+	cases := [][]interface{}{
+		{"hello", "hello", int32(-1), int64(1 << 40), int16(-2), int8(3), uint16('x'), float32(1.5), 2.5, true},
+		{"", strings.Repeat("long string ", 10), "中文"},
+		{[]byte{0, 1, 2}, []string{"a", "b"}, map[string]int32{"a": 1, "b": 2}},
+		{kryoOrder{No: "B2", Amount: -7, Count: &count}, &kryoOrder{No: "C3"}},
+		{time.Unix(1565000000, 123000000)},
+	}
+	for _, args := range cases {
+		payloads, err := s.Serialize(valuesOf(args...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		values, err := s.Unserialize(payloads, typesOf(args...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := interfacesOf(values); !reflect.DeepEqual(got, args) {
+			t.Errorf("got %#v, want %#v", got, args)
+		}
+	}
+}
+
+func TestKryoSerializerRejectsCorruptedPayloads(t *testing.T) {
+	s := NewKryoSerializer()
+	cases := []struct {
+		name     string
+		payloads []byte
+		err      string
+	}{
+		{"empty", []byte{}, "buffer underflow"},
+		{"huge args length", []byte{0x01, 0xff, 0xff, 0xff, 0xff, 0x07}, "invalid length"},
+		{"truncated args", []byte{0x01, 0x03, 0x03, 0x01, 0xe8}, "buffer underflow"},
+		{"huge string length", []byte{0x01, 0x02, 0x03, 0x01, 0xff, 0xff, 0xff, 0xff, 0x7f}, "invalid length"},
+		{"huge collection length", append(append([]byte{0x01, 0x02, 0x01, 0x00}, "java.util.ArrayLis\xf4"...), 0x01, 0xff, 0xff, 0xff, 0xff, 0x07), "invalid length"},
+		{"huge map length", append(append([]byte{0x01, 0x02, 0x01, 0x00}, "java.util.HashMa\xf0"...), 0x01, 0xff, 0xff, 0xff, 0x7f), "invalid length"},
+		{"negative reference", []byte{0x01, 0x02, 0x03, 0xff, 0xff, 0xff, 0xff, 0x0f}, "invalid reference"},
+		{"unresolved reference", []byte{0x01, 0x02, 0x03, 0x05}, "unresolved reference"},
+		{"unknown class", append(append([]byte{0x01, 0x02, 0x01, 0x00}, "com.foo.Unknow\xee"...), 0x01), "is not supported"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := s.Unserialize(c.payloads, nil)
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("got error %v, want %q", err, c.err)
+			}
+		})
+	}
+}
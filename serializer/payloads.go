@@ -0,0 +1,111 @@
+package serializer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// payloadsMagic starts the payloads wrapped in an envelope, a gob stream never starts with a zero byte.
+var payloadsMagic = []byte{0, 'S', 'A', 'G', 'A'}
+
+const (
+	payloadsVersionBaggage  = 1
+	payloadsVersionEnvelope = 2
+)
+
+// Envelope describes the serialized arguments of a compensable method, it is written in front of them by WrapPayloads.
+type Envelope struct {
+	// SerializerId is the id of the serializer of the arguments, see IdentifiedSerializer
+	SerializerId string `json:"serializer,omitempty"`
+	// SchemaVersion is the version of the arguments of the compensation method, 0 if it is unknown
+	SchemaVersion int `json:"schemaVersion,omitempty"`
+	// Compensation is the name of the compensation method
+	Compensation string            `json:"compensation,omitempty"`
+	Baggage      map[string]string `json:"baggage,omitempty"`
+	// Compression is the compression of the serialized arguments, "gzip" or "" if they are not compressed
+	Compression string `json:"compression,omitempty"`
+	// Blob is the reference of the payloads kept in the BlobStore, the envelope carries no arguments if it is not empty
+	Blob string `json:"blob,omitempty"`
+}
+
+// PayloadsBinding returns the binding of the payloads of the compensation method compensationMethod of the transaction localTxId
+// in the saga globalTxId, see BindingSerializer.
+func PayloadsBinding(compensationMethod string, globalTxId string, localTxId string) []byte {
+	var buf bytes.Buffer
+	lenBuf := make([]byte, binary.MaxVarintLen64)
+	for _, s := range []string{compensationMethod, globalTxId, localTxId} {
+		buf.Write(lenBuf[:binary.PutUvarint(lenBuf, uint64(len(s)))])
+		buf.WriteString(s)
+	}
+	return buf.Bytes()
+}
+
+// Binding returns the binding of the payloads wrapped in the envelope e, see PayloadsBinding, which authenticates the envelope
+// as well, so the baggage, the schema version and the other fields of e can not be changed without the payloads being rejected.
+// The blob reference is not bound, the envelope of the offloaded payloads is bound instead.
+func (e *Envelope) Binding(compensationMethod string, globalTxId string, localTxId string) ([]byte, error) {
+	bound := *e
+	bound.Blob = ""
+	b, err := json.Marshal(&bound)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("encode payloads envelope failed, %v", err))
+	}
+	binding := PayloadsBinding(compensationMethod, globalTxId, localTxId)
+	lenBuf := make([]byte, binary.MaxVarintLen64)
+	binding = append(binding, lenBuf[:binary.PutUvarint(lenBuf, uint64(len(b)))]...)
+	return append(binding, b...), nil
+}
+
+// WrapPayloads prepends the envelope e to the serialized arguments.
+func WrapPayloads(payloads []byte, e *Envelope) ([]byte, error) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("encode payloads envelope failed, %v", err))
+	}
+	return wrapPayloads(payloadsVersionEnvelope, b, payloads), nil
+}
+
+// UnwrapPayloads splits payloads into the serialized arguments and their envelope.
+// The version 1 payloads carrying only the baggage, produced by the versions of the saga agent before the envelope,
+// and those without any envelope, such as the payloads of the Java omega, are accepted as well,
+// their envelopes only carry the baggage if any.
+func UnwrapPayloads(payloads []byte) ([]byte, *Envelope, error) {
+	e := &Envelope{}
+	if !bytes.HasPrefix(payloads, payloadsMagic) {
+		return payloads, e, nil
+	}
+	r := bytes.NewReader(payloads[len(payloadsMagic):])
+	version, err := r.ReadByte()
+	if err != nil || version != payloadsVersionBaggage && version != payloadsVersionEnvelope {
+		return nil, nil, errors.New(fmt.Sprintf("unsupported payloads version %d", version))
+	}
+	n, err := binary.ReadUvarint(r)
+	if err != nil || n > uint64(r.Len()) {
+		return nil, nil, errors.New("malformed payloads envelope")
+	}
+	b := make([]byte, n)
+	r.Read(b)
+	if version == payloadsVersionBaggage {
+		e.Baggage = make(map[string]string)
+		if err := json.Unmarshal(b, &e.Baggage); err != nil {
+			return nil, nil, errors.New(fmt.Sprintf("decode baggage failed, %v", err))
+		}
+	} else if err := json.Unmarshal(b, e); err != nil {
+		return nil, nil, errors.New(fmt.Sprintf("decode payloads envelope failed, %v", err))
+	}
+	return payloads[len(payloads)-r.Len():], e, nil
+}
+
+func wrapPayloads(version byte, header []byte, payloads []byte) []byte {
+	var buf bytes.Buffer
+	buf.Write(payloadsMagic)
+	buf.WriteByte(version)
+	lenBuf := make([]byte, binary.MaxVarintLen64)
+	buf.Write(lenBuf[:binary.PutUvarint(lenBuf, uint64(len(header)))])
+	buf.Write(header)
+	buf.Write(payloads)
+	return buf.Bytes()
+}
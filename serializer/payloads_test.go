@@ -0,0 +1,139 @@
+package serializer
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWrapPayloads(t *testing.T) {
+	cases := []struct {
+		name     string
+		payloads []byte
+		e        *Envelope
+	}{
+		{"empty envelope", []byte("args"), &Envelope{}},
+		{"full envelope", []byte("args"), &Envelope{
+			SerializerId:  "json",
+			SchemaVersion: 3,
+			Compensation:  "main.Cancel",
+			Baggage:       map[string]string{"tenant": "t1"},
+			Compression:   "gzip",
+		}},
+		{"blob", nil, &Envelope{Compensation: "main.Cancel", Blob: "ref"}},
+		{"args starting with the magic", append(append([]byte{}, payloadsMagic...), 2, 0), &Envelope{SerializerId: "gob"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			wrapped, err := WrapPayloads(c.payloads, c.e)
+			if err != nil {
+				t.Fatal(err)
+			}
+			payloads, e, err := UnwrapPayloads(wrapped)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(payloads, c.payloads) {
+				t.Errorf("got payloads %q, want %q", payloads, c.payloads)
+			}
+			if !reflect.DeepEqual(e, c.e) {
+				t.Errorf("got envelope %+v, want %+v", e, c.e)
+			}
+		})
+	}
+}
+
+func TestEnvelopeBinding(t *testing.T) {
+	e := &Envelope{SerializerId: "json", SchemaVersion: 2, Compensation: "main.Cancel", Baggage: map[string]string{"tenant": "t1"}}
+	binding, err := e.Binding("main.Cancel", "g1", "l1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name      string
+		change    func(e *Envelope)
+		wantBound bool
+	}{
+		{"unchanged", func(e *Envelope) {}, true},
+		{"blob", func(e *Envelope) { e.Blob = "ref" }, true},
+		{"copied baggage", func(e *Envelope) { e.Baggage = map[string]string{"tenant": "t1"} }, true},
+		{"baggage", func(e *Envelope) { e.Baggage = map[string]string{"tenant": "t2"} }, false},
+		{"no baggage", func(e *Envelope) { e.Baggage = nil }, false},
+		{"schema version", func(e *Envelope) { e.SchemaVersion = 1 }, false},
+		{"serializer", func(e *Envelope) { e.SerializerId = "gob" }, false},
+		{"compensation", func(e *Envelope) { e.Compensation = "" }, false},
+		{"compression", func(e *Envelope) { e.Compression = "gzip" }, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			changed := *e
+			c.change(&changed)
+			got, err := changed.Binding("main.Cancel", "g1", "l1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bound := bytes.Equal(got, binding); bound != c.wantBound {
+				t.Errorf("got bound %v, want %v", bound, c.wantBound)
+			}
+			if !bytes.HasPrefix(got, PayloadsBinding("main.Cancel", "g1", "l1")) {
+				t.Error("binding of the transaction is missing")
+			}
+		})
+	}
+}
+
+func TestUnwrapPayloadsWithoutEnvelope(t *testing.T) {
+	// such as the payloads of the Java omega or of the versions of the saga agent before the envelope
+	for _, payloads := range [][]byte{nil, {}, []byte("args"), {0, 'S', 'A'}} {
+		got, e, err := UnwrapPayloads(payloads)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, payloads) || !reflect.DeepEqual(e, &Envelope{}) {
+			t.Errorf("payloads %q: got %q, %+v", payloads, got, e)
+		}
+	}
+}
+
+func TestUnwrapLegacyBaggage(t *testing.T) {
+	// the version 1 payloads only carry the baggage
+	baggage := map[string]string{"tenant": "t1"}
+	payloads := wrapPayloads(payloadsVersionBaggage, []byte(`{"tenant":"t1"}`), []byte("args"))
+	got, e, err := UnwrapPayloads(payloads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "args" || !reflect.DeepEqual(e, &Envelope{Baggage: baggage}) {
+		t.Errorf("got %q, %+v", got, e)
+	}
+}
+
+func TestUnwrapMalformedPayloads(t *testing.T) {
+	envelope := func(version byte, header string) []byte {
+		return wrapPayloads(version, []byte(header), []byte("args"))
+	}
+	magic := func(b ...byte) []byte {
+		return append(append([]byte{}, payloadsMagic...), b...)
+	}
+	cases := []struct {
+		name     string
+		payloads []byte
+		err      string
+	}{
+		{"no version", magic(), "unsupported payloads version"},
+		{"unsupported version", envelope(3, "{}"), "unsupported payloads version 3"},
+		{"no header length", magic(payloadsVersionEnvelope), "malformed payloads envelope"},
+		{"header longer than the payloads", magic(payloadsVersionEnvelope, 10, '{', '}'), "malformed payloads envelope"},
+		{"malformed envelope", envelope(payloadsVersionEnvelope, "{"), "decode payloads envelope failed"},
+		{"malformed baggage", envelope(payloadsVersionBaggage, `{"tenant":1}`), "decode baggage failed"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, _, err := UnwrapPayloads(c.payloads)
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("got error %v, want %q", err, c.err)
+			}
+		})
+	}
+}
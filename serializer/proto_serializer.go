@@ -0,0 +1,174 @@
+package serializer
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/any"
+	"reflect"
+	"strings"
+)
+
+// protoFallbackTypeUrlPrefix prefixes the type URLs of the arguments encoded by the fallback serializer,
+// the type URL of a nil argument is empty.
+const protoFallbackTypeUrlPrefix = "saga.fallback/"
+
+var protoMessageType = reflect.TypeOf((*proto.Message)(nil)).Elem()
+
+// protoPayloads is the message of the payloads encoded by ProtoSerializer, like
+//
+//	message ProtoPayloads {
+//	  repeated google.protobuf.Any args = 1;
+//	}
+type protoPayloads struct {
+	Args []*any.Any `protobuf:"bytes,1,rep,name=args,proto3" json:"args,omitempty"`
+}
+
+func (m *protoPayloads) Reset()         { *m = protoPayloads{} }
+func (m *protoPayloads) String() string { return proto.CompactTextString(m) }
+func (*protoPayloads) ProtoMessage()    {}
+
+// ProtoSerializer encodes the proto.Message arguments, such as the generated request messages, as google.protobuf.Any
+// with their full message names, and the other arguments by the fallback serializer.
+// The messages are decoded into the parameter types of the compensation function,
+// or into the types registered by the generated code if the parameter types are unknown or are interfaces.
+type ProtoSerializer struct {
+	fallback Serializer
+}
+
+// NewProtoSerializer creates a ProtoSerializer encoding the arguments which are not proto.Message by fallback,
+// defaults to the gob serializer if fallback is nil.
+func NewProtoSerializer(fallback Serializer) Serializer {
+	if fallback == nil {
+		fallback = NewGobSerializer()
+	}
+	return &ProtoSerializer{
+		fallback: fallback,
+	}
+}
+
+// SerializerId returns "proto+" followed by the id of the fallback serializer, such as "proto+gob".
+func (s *ProtoSerializer) SerializerId() string {
+	return "proto+" + SerializerId(s.fallback)
+}
+
+func (s *ProtoSerializer) Serialize(values []reflect.Value) ([]byte, error) {
+	payloads := &protoPayloads{
+		Args: make([]*any.Any, 0, len(values)),
+	}
+	for i, value := range values {
+		value = concrete(value)
+		if !value.IsValid() || isNil(value) {
+			payloads.Args = append(payloads.Args, &any.Any{})
+			continue
+		}
+		if msg, ok := protoMessage(value); ok {
+			a, err := ptypes.MarshalAny(msg)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("encode arg %d failed, %v", i, err))
+			}
+			payloads.Args = append(payloads.Args, a)
+			continue
+		}
+		b, err := s.fallback.Serialize([]reflect.Value{value})
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("encode arg %d failed, %v", i, err))
+		}
+		payloads.Args = append(payloads.Args, &any.Any{
+			TypeUrl: protoFallbackTypeUrlPrefix + TypeName(value.Type()),
+			Value:   b,
+		})
+	}
+	return proto.Marshal(payloads)
+}
+
+func (s *ProtoSerializer) Unserialize(payloads []byte, paramTypes []reflect.Type) ([]reflect.Value, error) {
+	p := &protoPayloads{}
+	if err := proto.Unmarshal(payloads, p); err != nil {
+		return nil, errors.New(fmt.Sprintf("decode values failed, %v", err))
+	}
+	if err := checkArgCount(len(p.Args), paramTypes); err != nil {
+		return nil, err
+	}
+	values := make([]reflect.Value, 0, len(p.Args))
+	for i, a := range p.Args {
+		var paramType reflect.Type
+		if paramTypes != nil {
+			paramType = paramTypes[i]
+		}
+		var (
+			value reflect.Value
+			err   error
+		)
+		switch {
+		case len(a.TypeUrl) == 0:
+			value, err = convertArg(i, reflect.Value{}, paramType)
+		case strings.HasPrefix(a.TypeUrl, protoFallbackTypeUrlPrefix):
+			value, err = s.unserializeFallback(i, a.Value, paramType)
+		default:
+			value, err = unserializeProtoArg(i, a, paramType)
+		}
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func (s *ProtoSerializer) unserializeFallback(i int, payloads []byte, paramType reflect.Type) (reflect.Value, error) {
+	var paramTypes []reflect.Type
+	if paramType != nil {
+		paramTypes = []reflect.Type{paramType}
+	}
+	values, err := s.fallback.Unserialize(payloads, paramTypes)
+	if err != nil {
+		return reflect.Value{}, errors.New(fmt.Sprintf("decode arg %d failed, %v", i, err))
+	}
+	if len(values) != 1 {
+		return reflect.Value{}, errors.New(fmt.Sprintf("decode arg %d failed, %d values decoded by the fallback serializer", i, len(values)))
+	}
+	return values[0], nil
+}
+
+// unserializeProtoArg decodes the message a into paramType, or the message type registered under its name
+// if paramType is nil or is not a message.
+func unserializeProtoArg(i int, a *any.Any, paramType reflect.Type) (reflect.Value, error) {
+	name, err := ptypes.AnyMessageName(a)
+	if err != nil {
+		return reflect.Value{}, errors.New(fmt.Sprintf("decode arg %d failed, %v", i, err))
+	}
+	var msgType reflect.Type
+	switch {
+	case paramType == nil:
+	case paramType.Kind() == reflect.Ptr && paramType.Implements(protoMessageType):
+		msgType = paramType
+	case paramType.Kind() != reflect.Interface && reflect.PtrTo(paramType).Implements(protoMessageType):
+		msgType = reflect.PtrTo(paramType)
+	}
+	if msgType == nil {
+		msgType = proto.MessageType(name)
+		if msgType == nil {
+			return reflect.Value{}, errors.New(fmt.Sprintf("decode arg %d failed, message type %s is not registered", i, name))
+		}
+	}
+	msg := reflect.New(msgType.Elem()).Interface().(proto.Message)
+	if err := ptypes.UnmarshalAny(a, msg); err != nil {
+		return reflect.Value{}, errors.New(fmt.Sprintf("decode arg %d of message type %s into %v failed, %v", i, name, msgType, err))
+	}
+	return convertArg(i, reflect.ValueOf(msg), paramType)
+}
+
+// protoMessage returns value as a proto.Message, the messages passed by value are copied.
+func protoMessage(value reflect.Value) (proto.Message, bool) {
+	if msg, ok := value.Interface().(proto.Message); ok {
+		return msg, true
+	}
+	if value.Kind() != reflect.Ptr && reflect.PtrTo(value.Type()).Implements(protoMessageType) {
+		ptr := reflect.New(value.Type())
+		ptr.Elem().Set(value)
+		return ptr.Interface().(proto.Message), true
+	}
+	return nil, false
+}
@@ -0,0 +1,145 @@
+package serializer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+	"github.com/jeremyxu2010/matrix-saga-go/saga_grpc"
+)
+
+// protoArgsEqual compares the args by proto.Equal if they are messages, the encoding of a message changes its size cache.
+func protoArgsEqual(got []interface{}, want []interface{}) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		gotMsg, ok := got[i].(proto.Message)
+		wantMsg, wantOk := want[i].(proto.Message)
+		if ok && wantOk && reflect.TypeOf(gotMsg) == reflect.TypeOf(wantMsg) && !reflect.ValueOf(gotMsg).IsNil() {
+			if !proto.Equal(gotMsg, wantMsg) {
+				return false
+			}
+			continue
+		}
+		if !reflect.DeepEqual(got[i], want[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestProtoSerializerRoundTrip(t *testing.T) {
+	event := &saga_grpc.GrpcTxEvent{GlobalTxId: "g1", LocalTxId: "l1", Type: "TxStartedEvent", Payloads: []byte("args"), Timeout: 5}
+	cases := []struct {
+		name       string
+		args       []interface{}
+		paramTypes []reflect.Type
+		want       []interface{}
+	}{
+		{"generated message", []interface{}{event}, typesOf(event), nil},
+		{"generated message into interface", []interface{}{event}, []reflect.Type{interfaceType}, nil},
+		{"generated message without param types", []interface{}{event}, nil, nil},
+		{"message passed by value", []interface{}{*event}, typesOf(*event), nil},
+		{"nil message", []interface{}{(*saga_grpc.GrpcTxEvent)(nil)}, typesOf(event), nil},
+		{"nil into interface", []interface{}{nil}, []reflect.Type{interfaceType}, nil},
+		{"non-proto args", []interface{}{"o1", 3, jsonOrder{No: "1"}}, typesOf("", 0, jsonOrder{}), nil},
+		{"mixed args", []interface{}{"o1", event, (*saga_grpc.GrpcTxEvent)(nil)}, typesOf("", event, event), nil},
+	}
+	s := NewProtoSerializer(nil)
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			payloads, err := s.Serialize(valuesOf(c.args...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			values, err := s.Unserialize(payloads, c.paramTypes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := c.want
+			if want == nil {
+				want = c.args
+			}
+			if got := interfacesOf(values); !protoArgsEqual(got, want) {
+				t.Errorf("got %#v, want %#v", got, want)
+			}
+			for i, value := range values {
+				if c.paramTypes != nil && value.Type() != c.paramTypes[i] {
+					t.Errorf("arg %d is decoded into %v, want %v", i, value.Type(), c.paramTypes[i])
+				}
+			}
+		})
+	}
+}
+
+func TestProtoSerializerEncodesMessagesAsAny(t *testing.T) {
+	payloads, err := NewProtoSerializer(nil).Serialize(valuesOf(&saga_grpc.GrpcAck{Aborted: true}, "o1", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &protoPayloads{}
+	if err := proto.Unmarshal(payloads, p); err != nil {
+		t.Fatal(err)
+	}
+	var typeUrls []string
+	for _, a := range p.Args {
+		typeUrls = append(typeUrls, a.TypeUrl)
+	}
+	want := []string{"type.googleapis.com/GrpcAck", protoFallbackTypeUrlPrefix + "string", ""}
+	if !reflect.DeepEqual(typeUrls, want) {
+		t.Errorf("got type urls %q, want %q", typeUrls, want)
+	}
+}
+
+func TestProtoSerializerId(t *testing.T) {
+	cases := []struct {
+		fallback Serializer
+		want     string
+	}{
+		{nil, "proto+gob"},
+		{NewJsonSerializer(), "proto+json"},
+	}
+	for _, c := range cases {
+		if got := SerializerId(NewProtoSerializer(c.fallback)); got != c.want {
+			t.Errorf("got serializer id %s, want %s", got, c.want)
+		}
+	}
+}
+
+func TestProtoSerializerUnserializeErrors(t *testing.T) {
+	s := NewProtoSerializer(nil)
+	encode := func(args ...interface{}) []byte {
+		payloads, err := s.Serialize(valuesOf(args...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return payloads
+	}
+	unregistered, err := proto.Marshal(&protoPayloads{Args: []*any.Any{{TypeUrl: "type.googleapis.com/saga.Unknown"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name       string
+		payloads   []byte
+		paramTypes []reflect.Type
+		err        string
+	}{
+		{"malformed payloads", []byte{0xff}, nil, "decode values failed"},
+		{"too few args", encode("o1"), typesOf("", ""), "1 args for 2 params"},
+		{"message into another type", encode(&saga_grpc.GrpcAck{}), typesOf(""), "decode arg 0"},
+		{"non-proto arg into message", encode("o1"), typesOf(&saga_grpc.GrpcAck{}), "decode arg 0"},
+		{"unregistered message type", unregistered, []reflect.Type{interfaceType}, "message type saga.Unknown is not registered"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := s.Unserialize(c.payloads, c.paramTypes)
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("got error %v, want %q", err, c.err)
+			}
+		})
+	}
+}
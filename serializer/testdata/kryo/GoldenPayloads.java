@@ -0,0 +1,57 @@
+package com.foo;
+
+import java.io.FileOutputStream;
+import java.io.IOException;
+import java.util.ArrayList;
+import java.util.Arrays;
+import java.util.Date;
+import java.util.HashMap;
+import java.util.Map;
+import org.apache.servicecomb.pack.omega.format.KryoMessageFormat;
+
+class Order {
+  private String no;
+  private int amount;
+  private Integer count;
+
+  Order() {
+  }
+
+  Order(String no, int amount, Integer count) {
+    this.no = no;
+    this.amount = amount;
+    this.count = count;
+  }
+}
+
+/**
+ * Writes the golden payloads of kryo_serializer_test.go by the KryoMessageFormat of the Java omega (Kryo 4),
+ * run it in this directory with the omega-format jar and its dependencies on the classpath.
+ */
+public class GoldenPayloads {
+
+  private static final KryoMessageFormat format = new KryoMessageFormat();
+
+  public static void main(String[] args) throws IOException {
+    String abc = "abc";
+    Map<String, String> map = new HashMap<>();
+    map.put("k", "v");
+
+    write("string_int", "hello", 5);
+    write("string_reference", abc, abc);
+    write("empty");
+    write("null", (Object) null);
+    write("unicode_string", "é");
+    write("bean", new Order("A1", 7, null));
+    write("array_list", new ArrayList<>(Arrays.asList(1, 2)));
+    write("class_name_reference", new ArrayList<>(), new ArrayList<>());
+    write("date", new Date(1000));
+    write("hash_map", map);
+  }
+
+  private static void write(String name, Object... objects) throws IOException {
+    try (FileOutputStream out = new FileOutputStream(name + ".bin")) {
+      out.write(format.serialize(objects));
+    }
+  }
+}
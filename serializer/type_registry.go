@@ -0,0 +1,61 @@
+package serializer
+
+import (
+	"reflect"
+	"sync"
+)
+
+var (
+	typesLock sync.RWMutex
+	types     = make(map[string]reflect.Type)
+)
+
+func init() {
+	for _, v := range []interface{}{
+		false, "", []byte(nil),
+		int(0), int8(0), int16(0), int32(0), int64(0),
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0),
+		float32(0), float64(0),
+		[]string(nil), []int(nil), []int64(nil), map[string]string(nil), map[string]interface{}(nil), []interface{}(nil),
+	} {
+		RegisterType(v)
+	}
+}
+
+// RegisterType registers the type of value under its name, see TypeName.
+// The types of the arguments must be registered to be decoded by the serializers without the parameter types of the compensation function,
+// such as the arguments passed to the interface parameters.
+func RegisterType(value interface{}) {
+	t := reflect.TypeOf(value)
+	typesLock.Lock()
+	defer typesLock.Unlock()
+	types[TypeName(t)] = t
+}
+
+// TypeName returns the name of t, qualified by the import path of its package for the named types, such as
+// "github.com/foo/order.Order", "*github.com/foo/order.Order" or "[]string".
+func TypeName(t reflect.Type) string {
+	if t == nil {
+		return "nil"
+	}
+	if len(t.Name()) > 0 && len(t.PkgPath()) > 0 {
+		return t.PkgPath() + "." + t.Name()
+	}
+	if t.Kind() == reflect.Ptr {
+		return "*" + TypeName(t.Elem())
+	}
+	return t.String()
+}
+
+// LookupType returns the type registered under name.
+func LookupType(name string) (reflect.Type, bool) {
+	typesLock.RLock()
+	defer typesLock.RUnlock()
+	t, ok := types[name]
+	if !ok && len(name) > 1 && name[0] == '*' {
+		if elem, ok := types[name[1:]]; ok {
+			return reflect.PtrTo(elem), true
+		}
+	}
+	return t, ok
+}
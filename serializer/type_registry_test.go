@@ -0,0 +1,50 @@
+package serializer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTypeName(t *testing.T) {
+	cases := []struct {
+		t    reflect.Type
+		want string
+	}{
+		{nil, "nil"},
+		{reflect.TypeOf(0), "int"},
+		{reflect.TypeOf(""), "string"},
+		{reflect.TypeOf(jsonOrder{}), "github.com/jeremyxu2010/matrix-saga-go/serializer.jsonOrder"},
+		{reflect.TypeOf(&jsonOrder{}), "*github.com/jeremyxu2010/matrix-saga-go/serializer.jsonOrder"},
+		{reflect.TypeOf([]string{}), "[]string"},
+		{reflect.TypeOf(map[string]interface{}{}), "map[string]interface {}"},
+		{interfaceType, "interface {}"},
+	}
+	for _, c := range cases {
+		if got := TypeName(c.t); got != c.want {
+			t.Errorf("got %s, want %s", got, c.want)
+		}
+	}
+}
+
+func TestLookupType(t *testing.T) {
+	cases := []struct {
+		name string
+		want reflect.Type
+	}{
+		{"int", reflect.TypeOf(0)},
+		{"[]uint8", reflect.TypeOf([]byte{})},
+		{"map[string]interface {}", reflect.TypeOf(map[string]interface{}{})},
+		{"github.com/jeremyxu2010/matrix-saga-go/serializer.jsonOrder", reflect.TypeOf(jsonOrder{})},
+		{"*github.com/jeremyxu2010/matrix-saga-go/serializer.jsonOrder", reflect.TypeOf(&jsonOrder{})},
+		{"**github.com/jeremyxu2010/matrix-saga-go/serializer.jsonOrder", nil},
+		{"github.com/jeremyxu2010/matrix-saga-go/serializer.jsonUnregistered", nil},
+		{"*", nil},
+		{"", nil},
+	}
+	for _, c := range cases {
+		got, ok := LookupType(c.name)
+		if ok != (c.want != nil) || got != c.want {
+			t.Errorf("type %q: got %v, %v, want %v", c.name, got, ok, c.want)
+		}
+	}
+}
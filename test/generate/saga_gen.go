@@ -0,0 +1,96 @@
+// Code generated by saga-gen. DO NOT EDIT.
+
+package main
+
+import (
+	_saga "github.com/jeremyxu2010/matrix-saga-go"
+)
+
+func init() {
+	_saga.RegisterCompensation("main.CancelTransferOut", CancelTransferOut)
+	_saga.RegisterCompensation("main.CancelTransferIn", CancelTransferIn)
+}
+
+// TransferMoneySagaStartDecorated is the saga start wrapper of TransferMoney.
+func TransferMoneySagaStartDecorated() (_sagaRet0 error) {
+	if _sagaErr := _saga.BeginSaga("main.TransferMoney", 20); _sagaErr != nil {
+		_sagaRet0 = _sagaErr
+		return
+	}
+	_sagaReturned := false
+	defer func() {
+		if _sagaReturned {
+			return
+		}
+		_sagaCause := recover()
+		_sagaErr := _saga.PanicError(_sagaCause)
+		_saga.FinishSaga("main.TransferMoney", _sagaErr, true)
+		if _sagaCause != nil {
+			panic(_sagaCause)
+		}
+	}()
+	_sagaRet0 = TransferMoney()
+	_sagaReturned = true
+	if _sagaErr := _saga.FinishSaga("main.TransferMoney", _sagaRet0, true); _sagaErr != nil {
+		_sagaRet0 = _sagaErr
+	}
+	return
+}
+
+// TransferOutCompensableDecorated is the compensable wrapper of TransferOut, which is compensated by CancelTransferOut.
+func TransferOutCompensableDecorated(from string, amount int) (_sagaRet0 error) {
+	_sagaTx, _sagaErr := _saga.BeginCompensable("main.TransferOut", "main.CancelTransferOut", 5, from, amount)
+	if _sagaErr != nil {
+		_sagaRet0 = _sagaErr
+		return
+	}
+	_sagaReturned := false
+	defer func() {
+		if _sagaReturned {
+			return
+		}
+		_sagaCause := recover()
+		_sagaErr := _saga.PanicError(_sagaCause)
+		_sagaTx.Finish(_sagaErr)
+		if _sagaCause != nil {
+			panic(_sagaCause)
+		}
+	}()
+	_sagaRet0 = TransferOut(from, amount)
+	_sagaReturned = true
+	if _sagaErr = _sagaTx.Finish(_sagaRet0); _sagaErr != nil {
+		_sagaRet0 = _sagaErr
+	}
+	return
+}
+
+var _ = func(from string, amount int) { CancelTransferOut(from, amount) }
+
+// TransferInCompensableDecorated is the compensable wrapper of TransferIn, which is compensated by CancelTransferIn.
+func TransferInCompensableDecorated(to string, amount int) (_sagaRet0 error) {
+	_sagaTx, _sagaErr := _saga.BeginCompensable("main.TransferIn", "main.CancelTransferIn", 5, to, amount)
+	if _sagaErr != nil {
+		_sagaRet0 = _sagaErr
+		return
+	}
+	_sagaReturned := false
+	defer func() {
+		if _sagaReturned {
+			return
+		}
+		_sagaCause := recover()
+		_sagaErr := _saga.PanicError(_sagaCause)
+		_sagaTx.Finish(_sagaErr)
+		if _sagaCause != nil {
+			panic(_sagaCause)
+		}
+	}()
+	_sagaRet0 = TransferIn(to, amount)
+	_sagaReturned = true
+	if _sagaErr = _sagaTx.Finish(_sagaRet0); _sagaErr != nil {
+		_sagaRet0 = _sagaErr
+	}
+	return
+}
+
+var _ = func(to string, amount int) { CancelTransferIn(to, amount) }
@@ -0,0 +1,83 @@
+package main
+
+//go:generate go run github.com/jeremyxu2010/matrix-saga-go/cmd/saga-gen
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jeremyxu2010/matrix-saga-go"
+	"github.com/jeremyxu2010/matrix-saga-go/utils"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+var (
+	BALANCES map[string]int
+)
+
+func init() {
+	initDatas()
+}
+
+func initDatas() {
+	BALANCES = make(map[string]int, 0)
+	BALANCES["foo"] = 500
+	BALANCES["bar"] = 500
+}
+
+//saga:start timeout=20
+func TransferMoney() error {
+	err := TransferOutCompensableDecorated("foo", 100)
+	if err != nil {
+		return err
+	}
+	err = TransferInCompensableDecorated("bar", 100)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+//saga:compensable cancel=CancelTransferOut timeout=5
+func TransferOut(from string, amount int) error {
+	oldAmount, _ := BALANCES[from]
+	BALANCES[from] = oldAmount - amount
+	return nil
+}
+
+func CancelTransferOut(from string, amount int) error {
+	oldAmount, _ := BALANCES[from]
+	BALANCES[from] = oldAmount + amount
+	return nil
+}
+
+//saga:compensable cancel=CancelTransferIn timeout=5
+func TransferIn(to string, amount int) error {
+	return errors.New("xx")
+}
+
+func CancelTransferIn(to string, amount int) error {
+	oldAmount, _ := BALANCES[to]
+	BALANCES[to] = oldAmount - amount
+	return nil
+}
+
+func main() {
+	utils.DisableHttpProxy()
+	saga.InitSagaAgent("saga-go-demo", "127.0.0.1:8080", nil)
+	fmt.Printf("foo balance: %d, bar balance: %d\n", BALANCES["foo"], BALANCES["bar"])
+	TransferMoneySagaStartDecorated()
+	stopped := false
+	go func() {
+		s := make(chan os.Signal, 1)
+		signal.Notify(s, syscall.SIGINT, syscall.SIGTERM)
+		<-s
+		stopped = true
+	}()
+	for !stopped {
+		fmt.Printf("foo balance: %d, bar balance: %d\n", BALANCES["foo"], BALANCES["bar"])
+		time.Sleep(time.Second * 3)
+	}
+}
@@ -50,7 +50,7 @@ func main() {
 	TransferMoney()
 	stopped := false
 	go func() {
-		s := make(chan os.Signal)
+		s := make(chan os.Signal, 1)
 		signal.Notify(s, syscall.SIGINT, syscall.SIGTERM)
 		<-s
 		stopped = true
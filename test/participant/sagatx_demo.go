@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jeremyxu2010/matrix-saga-go"
+	"github.com/jeremyxu2010/matrix-saga-go/utils"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+type AccountService struct {
+	balances map[string]int
+}
+
+func NewAccountService() *AccountService {
+	return &AccountService{
+		balances: map[string]int{
+			"foo": 500,
+			"bar": 500,
+		},
+	}
+}
+
+func (s *AccountService) TransferOut(from string, amount int) error {
+	oldAmount, _ := s.balances[from]
+	s.balances[from] = oldAmount - amount
+	return nil
+}
+
+func (s *AccountService) CancelTransferOut(from string, amount int) error {
+	oldAmount, _ := s.balances[from]
+	s.balances[from] = oldAmount + amount
+	return nil
+}
+
+func (s *AccountService) TransferIn(to string, amount int) error {
+	return errors.New("xx")
+}
+
+func (s *AccountService) CancelTransferIn(to string, amount int) error {
+	oldAmount, _ := s.balances[to]
+	s.balances[to] = oldAmount - amount
+	return nil
+}
+
+var (
+	accountService                  = NewAccountService()
+	TransferMoneySagaStartDecorated func() error
+	TransferOutCompensableDecorated func(from string, amount int) error
+	TransferInCompensableDecorated  func(to string, amount int) error
+)
+
+func init() {
+	err := saga.RegisterParticipant(accountService, map[string]string{
+		"TransferOut": "CancelTransferOut",
+		"TransferIn":  "CancelTransferIn",
+	})
+	if err != nil {
+		panic(err)
+	}
+	err = saga.DecorateParticipantMethod(&TransferOutCompensableDecorated, accountService, "TransferOut", 5)
+	if err != nil {
+		panic(err)
+	}
+	err = saga.DecorateParticipantMethod(&TransferInCompensableDecorated, accountService, "TransferIn", 5)
+	if err != nil {
+		panic(err)
+	}
+	err = saga.DecorateSagaStartMethod(&TransferMoneySagaStartDecorated, TransferMoney, 20, true)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TransferMoney() error {
+	err := TransferOutCompensableDecorated("foo", 100)
+	if err != nil {
+		return err
+	}
+	err = TransferInCompensableDecorated("bar", 100)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func main() {
+	utils.DisableHttpProxy()
+	saga.InitSagaAgent("saga-go-demo", "127.0.0.1:8080", nil)
+	fmt.Printf("foo balance: %d, bar balance: %d\n", accountService.balances["foo"], accountService.balances["bar"])
+	TransferMoneySagaStartDecorated()
+	stopped := false
+	go func() {
+		s := make(chan os.Signal, 1)
+		signal.Notify(s, syscall.SIGINT, syscall.SIGTERM)
+		<-s
+		stopped = true
+	}()
+	for !stopped {
+		fmt.Printf("foo balance: %d, bar balance: %d\n", accountService.balances["foo"], accountService.balances["bar"])
+		time.Sleep(time.Second * 3)
+	}
+}
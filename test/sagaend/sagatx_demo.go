@@ -106,7 +106,7 @@ func main() {
 	TransferMoneySagaEndDecorated()
 	stopped := false
 	go func() {
-		s := make(chan os.Signal)
+		s := make(chan os.Signal, 1)
 		signal.Notify(s, syscall.SIGINT, syscall.SIGTERM)
 		<-s
 		stopped = true
@@ -9,19 +9,37 @@ import (
 	"reflect"
 	"github.com/jeremyxu2010/matrix-saga-go/saga_grpc"
 	"context"
+	"errors"
 	"github.com/jeremyxu2010/matrix-saga-go/constants"
 	"github.com/jeremyxu2010/matrix-saga-go/processor"
 	sagactx "github.com/jeremyxu2010/matrix-saga-go/context"
 	"github.com/jeremyxu2010/matrix-saga-go/log"
 	"fmt"
 	"github.com/jeremyxu2010/matrix-saga-go/config"
+	"github.com/jeremyxu2010/matrix-saga-go/discovery"
 	"github.com/jeremyxu2010/matrix-saga-go/serializer"
+	"github.com/jeremyxu2010/matrix-saga-go/redact"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/status"
+	"sync"
+	"sync/atomic"
 )
 
 type TransportContractor struct {
-	coordinatorAddress    string
-	txEventServiceClient  saga_grpc.TxEventServiceClient
-	onConnectedClient     saga_grpc.TxEventService_OnConnectedClient
+	// agentConfig holds the current *config.AgentConfig, which is replaced by UpdateConfig
+	agentConfig        atomic.Value
+	coordinatorAddress string
+	// lock guards conn, txEventServiceClient, onConnectedClient and closeStream. The connection is dialed once,
+	// the resolver of coordinatorAddress follows the changes of the coordinators, only the broken stream is replaced.
+	lock                 sync.RWMutex
+	conn                 *grpc.ClientConn
+	txEventServiceClient saga_grpc.TxEventServiceClient
+	onConnectedClient    saga_grpc.TxEventService_OnConnectedClient
+	// closeStream cancels the context of onConnectedClient
+	closeStream context.CancelFunc
+	// stopped is set to 1 when the process is being terminated
+	stopped               int32
 	serviceConfig         *config.ServiceConfig
 	compensationProcessor *processor.CompensationProcessor
 	logger                log.Logger
@@ -29,81 +47,205 @@ type TransportContractor struct {
 	s                     serializer.Serializer
 }
 
-func NewTransportContractor(coordinatorAddress string, serviceConfig *config.ServiceConfig, compensationProcessor *processor.CompensationProcessor, s serializer.Serializer, logger log.Logger) *TransportContractor {
+func NewTransportContractor(agentConfig *config.AgentConfig, serviceConfig *config.ServiceConfig, compensationProcessor *processor.CompensationProcessor, s serializer.Serializer, logger log.Logger) *TransportContractor {
 	transportContractor := &TransportContractor{
-		coordinatorAddress:    coordinatorAddress,
+		coordinatorAddress:    discovery.RegisterGrpcResolver(agentConfig.Resolver, agentConfig.ResolveInterval, agentConfig.Timeout, logger),
 		serviceConfig:         serviceConfig,
 		compensationProcessor: compensationProcessor,
 		logger:                logger,
-		pendingTasks:          make(chan func(), 0),
+		pendingTasks:          make(chan func(), 1),
 		s: s,
 	}
+	transportContractor.agentConfig.Store(agentConfig)
 	go transportContractor.scheduleProcessReconnectTask()
 	return transportContractor
 }
 
+// UpdateConfig replaces the configuration of the contractor, the connection to the coordinator is kept,
+// the requests in flight complete with the previous configuration.
+func (c *TransportContractor) UpdateConfig(agentConfig *config.AgentConfig) {
+	c.agentConfig.Store(agentConfig)
+}
+
+func (c *TransportContractor) config() *config.AgentConfig {
+	return c.agentConfig.Load().(*config.AgentConfig)
+}
+
+// idempotentEvents are the events which only mark the transactions finished, the coordinator receiving them twice
+// does nothing more, so they are retried even if they may have been received.
+var idempotentEvents = map[string]bool{
+	constants.EVENT_NAME_TXENDEDEVENT:       true,
+	constants.EVENT_NAME_TXCOMPENSATEDEVENT: true,
+	constants.EVENT_NAME_SAGAENDEDEVENT:     true,
+}
+
+var errNotConnected = status.Error(codes.Unavailable, "coordinator is not connected")
+
+// sendTxEvent sends the event to the coordinator, and retries when the coordinator is unavailable.
+// The events which are not idempotent are only sent when the connection is ready, and only retried if they were not sent,
+// since the coordinator may have received an event failed as unavailable, and record it twice.
+func (c *TransportContractor) sendTxEvent(e *saga_grpc.GrpcTxEvent) (bool, error) {
+	agentConfig := c.config()
+	backoff := agentConfig.RetryBackoff
+	idempotent := idempotentEvents[e.Type]
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), agentConfig.Timeout)
+		var (
+			grpcAck *saga_grpc.GrpcAck
+			err     error
+		)
+		sent := idempotent || c.waitForReady(ctx)
+		if sent {
+			grpcAck, err = c.client().OnTxEvent(ctx, e)
+		} else {
+			err = errNotConnected
+		}
+		cancel()
+		if err == nil {
+			return grpcAck.Aborted, nil
+		}
+		if attempt >= agentConfig.RetryAttempts || status.Code(err) != codes.Unavailable || sent && !idempotent {
+			return false, err
+		}
+		c.logger.LogWarn(fmt.Sprintf("Failed to send %s of transaction %s, retry in %v, error: %v", e.Type, e.LocalTxId, backoff, err))
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// waitForReady waits until the connection to the coordinator is ready or ctx is done, and returns whether it is ready.
+func (c *TransportContractor) waitForReady(ctx context.Context) bool {
+	c.lock.RLock()
+	conn := c.conn
+	c.lock.RUnlock()
+	for {
+		state := conn.GetState()
+		if state == connectivity.Ready {
+			return true
+		}
+		if !conn.WaitForStateChange(ctx, state) {
+			return false
+		}
+	}
+}
+
+// Connect connects to the coordinator and opens the stream of the compensate commands, it does nothing if it is connected.
 func (c *TransportContractor) Connect() error {
-	err := c.initClient()
-	if err != nil {
+	dialed, err := c.initClient()
+	if err != nil || !dialed {
 		return err
 	}
 	c.onConnected()
 	return nil
 }
 
-func (c *TransportContractor) initClient() error {
-	ctx, cancel := context.WithTimeout(context.Background(), constants.GRPC_COMMUNICATE_TIMEOUT)
+// initClient dials the coordinator unless the connection is dialed, and returns whether it is dialed now.
+func (c *TransportContractor) initClient() (bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.conn != nil {
+		return false, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.config().Timeout)
 	defer cancel()
 	c.logger.LogInfo(fmt.Sprintf("connect coordinator with address[%s]", c.coordinatorAddress))
 	conn, err := grpc.DialContext(ctx, c.coordinatorAddress, grpc.WithInsecure())
 	if err != nil {
-		return err
+		return false, err
 	}
+	c.conn = conn
 	c.txEventServiceClient = saga_grpc.NewTxEventServiceClient(conn)
-	return nil
+	return true, nil
+}
+
+func (c *TransportContractor) client() saga_grpc.TxEventServiceClient {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.txEventServiceClient
+}
+
+func (c *TransportContractor) stream() saga_grpc.TxEventService_OnConnectedClient {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.onConnectedClient
 }
 
-func (c *TransportContractor) onConnected() error {
-	//ctx, cancel := context.WithTimeout(context.Background(), constants.GRPC_COMMUNICATE_TIMEOUT)
-	//defer cancel()
-	grpcServiceConfig := &saga_grpc.GrpcServiceConfig{
+func (c *TransportContractor) grpcServiceConfig() *saga_grpc.GrpcServiceConfig {
+	return &saga_grpc.GrpcServiceConfig{
 		ServiceName: c.serviceConfig.ServiceName,
 		InstanceId:  c.serviceConfig.InstanceId,
 	}
-	var err error
-	c.onConnectedClient, err = c.txEventServiceClient.OnConnected(context.Background(), grpcServiceConfig)
+}
+
+// openStream opens the stream of the compensate commands, which replaces the previous one.
+func (c *TransportContractor) openStream() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := c.client().OnConnected(ctx, c.grpcServiceConfig())
 	if err != nil {
+		cancel()
 		return err
 	}
-	stopped := false
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closeStream != nil {
+		c.closeStream()
+	}
+	c.onConnectedClient = stream
+	c.closeStream = cancel
+	return nil
+}
+
+func (c *TransportContractor) onConnected() {
+	if err := c.openStream(); err != nil {
+		c.logger.LogError(fmt.Sprintf("Failed to connect to coordinator at %s, error: %v", c.coordinatorAddress, err))
+		c.scheduleReconnect()
+	}
 	go func() {
-		for !stopped {
-			grpcCompensateCommand, err := c.onConnectedClient.Recv()
+		for atomic.LoadInt32(&c.stopped) == 0 {
+			var (
+				grpcCompensateCommand *saga_grpc.GrpcCompensateCommand
+				err                   error
+			)
+			stream := c.stream()
+			if stream != nil {
+				grpcCompensateCommand, err = stream.Recv()
+			} else {
+				err = errors.New("stream of compensate commands is not opened")
+			}
 			if err != nil {
-				if !stopped {
+				if stream != nil && stream != c.stream() {
+					// the stream is closed since the reconnect task replaced it
+					continue
+				}
+				if atomic.LoadInt32(&c.stopped) == 0 {
 					c.logger.LogError(fmt.Sprintf("failed to process grpc compensate command, err: %v", err))
-					// create reconnect task
-					c.pendingTasks <- c.reconnectTask
+					c.scheduleReconnect()
+					// wait for the reconnect task to replace the broken stream
+					time.Sleep(c.config().ReconnectDelay)
 				}
 				continue
 			}
 			c.logger.LogInfo(fmt.Sprintf("Received compensate command, global tx id: %s, local tx id: %s, compensation method: %s",
 				grpcCompensateCommand.GlobalTxId, grpcCompensateCommand.LocalTxId, grpcCompensateCommand.CompensationMethod))
-			c.compensationProcessor.ExecuteCompensate(grpcCompensateCommand.GlobalTxId, grpcCompensateCommand.LocalTxId, grpcCompensateCommand.CompensationMethod, grpcCompensateCommand.Payloads)
+			err = c.compensationProcessor.ExecuteCompensate(grpcCompensateCommand.GlobalTxId, grpcCompensateCommand.LocalTxId, grpcCompensateCommand.CompensationMethod, grpcCompensateCommand.Payloads, c.config().PayloadsMaxLength)
+			if err != nil {
+				// the coordinator sends the compensate command again since the transaction is not compensated
+				c.logger.LogError(fmt.Sprintf("Failed to compensate transaction %s of global tx %s, %v", grpcCompensateCommand.LocalTxId, grpcCompensateCommand.GlobalTxId, redact.Sprint(err)))
+				continue
+			}
 			c.sendTxCompensatedEvent(grpcCompensateCommand.GlobalTxId, grpcCompensateCommand.LocalTxId, grpcCompensateCommand.ParentTxId, grpcCompensateCommand.CompensationMethod)
 		}
 	}()
 	go func() {
-		s := make(chan os.Signal)
+		s := make(chan os.Signal, 1)
 		signal.Notify(s, syscall.SIGINT, syscall.SIGTERM)
 		<-s
-		stopped = true
-		ctx, cancel := context.WithTimeout(context.Background(), constants.GRPC_COMMUNICATE_TIMEOUT)
+		atomic.StoreInt32(&c.stopped, 1)
+		ctx, cancel := context.WithTimeout(context.Background(), c.config().Timeout)
 		defer cancel()
-		c.txEventServiceClient.OnDisconnected(ctx, grpcServiceConfig)
+		c.client().OnDisconnected(ctx, c.grpcServiceConfig())
 
 	}()
-	return nil
 }
 
 func (c *TransportContractor) sendTxCompensatedEvent(globalTxId string, localTxId string, parentTxId string, compensationMethod string) {
@@ -121,9 +263,7 @@ func (c *TransportContractor) sendTxCompensatedEvent(globalTxId string, localTxI
 		Retries:            0,
 		Payloads:           nil,
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), constants.GRPC_COMMUNICATE_TIMEOUT)
-	defer cancel()
-	c.txEventServiceClient.OnTxEvent(ctx, e)
+	c.sendTxEvent(e)
 }
 
 func (c *TransportContractor) SendSagaStartedEvent(sagaAgentCtx *sagactx.SagaAgentContext, timeout int) (bool, error) {
@@ -141,13 +281,7 @@ func (c *TransportContractor) SendSagaStartedEvent(sagaAgentCtx *sagactx.SagaAge
 		Retries:            0,
 		Payloads:           nil,
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), constants.GRPC_COMMUNICATE_TIMEOUT)
-	defer cancel()
-	grpcAck, err := c.txEventServiceClient.OnTxEvent(ctx, e)
-	if err != nil {
-		return false, err
-	}
-	return grpcAck.Aborted, nil
+	return c.sendTxEvent(e)
 }
 
 func (c *TransportContractor) SendSagaEndedEvent(sagaAgentCtx *sagactx.SagaAgentContext) (bool, error) {
@@ -165,19 +299,14 @@ func (c *TransportContractor) SendSagaEndedEvent(sagaAgentCtx *sagactx.SagaAgent
 		Retries:            0,
 		Payloads:           nil,
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), constants.GRPC_COMMUNICATE_TIMEOUT)
-	defer cancel()
-	grpcAck, err := c.txEventServiceClient.OnTxEvent(ctx, e)
-	if err != nil {
-		return false, err
-	}
-	return grpcAck.Aborted, nil
+	return c.sendTxEvent(e)
 }
 
 func (c *TransportContractor) SendTxStartedEvent(sagaAgentCtx *sagactx.SagaAgentContext, parentTxId string, compensationMethod string, timeout int, args []reflect.Value) (bool, error) {
-	b, err := c.s.Serialize(args)
+	cfg := c.config()
+	b, err := c.compensationProcessor.EncodeArgs(compensationMethod, sagaAgentCtx.GlobalTxId, sagaAgentCtx.LocalTxId, args, sagaAgentCtx.Baggage, cfg.CompressThreshold, cfg.PayloadsMaxLength)
 	if err != nil {
-		c.logger.LogError(fmt.Sprintf("%v", err))
+		c.logger.LogError(redact.Sprint(err))
 		return false, err
 	}
 	e := &saga_grpc.GrpcTxEvent{
@@ -194,13 +323,7 @@ func (c *TransportContractor) SendTxStartedEvent(sagaAgentCtx *sagactx.SagaAgent
 		Retries:            0,
 		Payloads:           b,
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), constants.GRPC_COMMUNICATE_TIMEOUT)
-	defer cancel()
-	grpcAck, err := c.txEventServiceClient.OnTxEvent(ctx, e)
-	if err != nil {
-		return false, err
-	}
-	return grpcAck.Aborted, nil
+	return c.sendTxEvent(e)
 }
 
 func (c *TransportContractor) SendTxEndedEvent(sagaAgentCtx *sagactx.SagaAgentContext, parentTxId string, compensationMethod string) (bool, error) {
@@ -218,19 +341,13 @@ func (c *TransportContractor) SendTxEndedEvent(sagaAgentCtx *sagactx.SagaAgentCo
 		Retries:            0,
 		Payloads:           nil,
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), constants.GRPC_COMMUNICATE_TIMEOUT)
-	defer cancel()
-	grpcAck, err := c.txEventServiceClient.OnTxEvent(ctx, e)
-	if err != nil {
-		return false, err
-	}
-	return grpcAck.Aborted, nil
+	return c.sendTxEvent(e)
 }
 
 func (c *TransportContractor) SendTxAbortedEvent(sagaAgentCtx *sagactx.SagaAgentContext, parentTxId string, compensationMethod string, err error) (bool, error) {
-	errStr := err.Error()
-	if len(errStr) > constants.PAYLOADS_MAX_LENGTH {
-		errStr = errStr[0:constants.PAYLOADS_MAX_LENGTH]
+	errStr := redact.Sprint(err)
+	if len(errStr) > c.config().PayloadsMaxLength {
+		errStr = errStr[0:c.config().PayloadsMaxLength]
 	}
 	e := &saga_grpc.GrpcTxEvent{
 		ServiceName:        c.serviceConfig.ServiceName,
@@ -246,54 +363,36 @@ func (c *TransportContractor) SendTxAbortedEvent(sagaAgentCtx *sagactx.SagaAgent
 		Retries:            0,
 		Payloads:           []byte(errStr),
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), constants.GRPC_COMMUNICATE_TIMEOUT)
-	defer cancel()
-	grpcAck, err := c.txEventServiceClient.OnTxEvent(ctx, e)
-	if err != nil {
-		return false, err
-	}
-	return grpcAck.Aborted, nil
+	return c.sendTxEvent(e)
 }
 
 func (c *TransportContractor) scheduleProcessReconnectTask() {
-	for {
-		select {
-		case taskFn := <- c.pendingTasks:
-			taskFn()
-		case <- time.Tick(constants.GRPC_RECONNECT_DELAY):
-			continue
-		}
+	for taskFn := range c.pendingTasks {
+		time.Sleep(c.config().ReconnectDelay)
+		taskFn()
 	}
 }
 
-func (c *TransportContractor) reconnectTask(){
-	grpcServiceConfig := &saga_grpc.GrpcServiceConfig{
-		ServiceName: c.serviceConfig.ServiceName,
-		InstanceId:  c.serviceConfig.InstanceId,
+// scheduleReconnect schedules a reconnect task unless one is already pending.
+func (c *TransportContractor) scheduleReconnect() {
+	select {
+	case c.pendingTasks <- c.reconnectTask:
+	default:
 	}
-	c.logger.LogInfo(fmt.Sprintf("Retry connecting to coordinator at %s", c.coordinatorAddress))
-	ctx, cancel := context.WithTimeout(context.Background(), constants.GRPC_COMMUNICATE_TIMEOUT)
+}
+
+// reconnectTask replaces the broken stream of the compensate commands, the connection is kept,
+// the requests in flight on it are not interrupted.
+func (c *TransportContractor) reconnectTask() {
+	ctx, cancel := context.WithTimeout(context.Background(), c.config().Timeout)
 	defer cancel()
-	c.txEventServiceClient.OnDisconnected(ctx, grpcServiceConfig)
-	var err error
-	err = c.initClient()
-	if err != nil {
-		c.logger.LogError(fmt.Sprintf("Failed to reconnect to coordinator at %s, error: %v", c.coordinatorAddress, err))
-		// create reconnect task
-		c.pendingTasks <- c.reconnectTask
-		return
-	} else {
-		c.logger.LogInfo(fmt.Sprintf("Retry connecting to coordinator at %s is successful", c.coordinatorAddress))
-		return
-	}
-	c.onConnectedClient, err = c.txEventServiceClient.OnConnected(context.Background(), grpcServiceConfig)
-	if err != nil {
+	c.client().OnDisconnected(ctx, c.grpcServiceConfig())
+	c.logger.LogInfo(fmt.Sprintf("Retry connecting to coordinator at %s", c.coordinatorAddress))
+	if err := c.openStream(); err != nil {
 		c.logger.LogError(fmt.Sprintf("Failed to reconnect to coordinator at %s, error: %v", c.coordinatorAddress, err))
 		// create reconnect task
-		c.pendingTasks <- c.reconnectTask
-		return
-	} else {
-		c.logger.LogInfo(fmt.Sprintf("Retry connecting to coordinator at %s is successful", c.coordinatorAddress))
+		c.scheduleReconnect()
 		return
 	}
+	c.logger.LogInfo(fmt.Sprintf("Retry connecting to coordinator at %s is successful", c.coordinatorAddress))
 }
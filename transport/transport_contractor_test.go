@@ -0,0 +1,274 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jeremyxu2010/matrix-saga-go/config"
+	sagactx "github.com/jeremyxu2010/matrix-saga-go/context"
+	"github.com/jeremyxu2010/matrix-saga-go/discovery"
+	"github.com/jeremyxu2010/matrix-saga-go/log"
+	"github.com/jeremyxu2010/matrix-saga-go/processor"
+	"github.com/jeremyxu2010/matrix-saga-go/redact"
+	"github.com/jeremyxu2010/matrix-saga-go/saga_grpc"
+	"github.com/jeremyxu2010/matrix-saga-go/serializer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/status"
+)
+
+// fakeAlpha is a coordinator recording the events and the streams of the compensate commands.
+type fakeAlpha struct {
+	lock    sync.Mutex
+	events  []*saga_grpc.GrpcTxEvent
+	streams int
+	// fail fails the events received with the error it returns, if it is not nil
+	fail func(e *saga_grpc.GrpcTxEvent) error
+}
+
+func (a *fakeAlpha) OnConnected(c *saga_grpc.GrpcServiceConfig, s saga_grpc.TxEventService_OnConnectedServer) error {
+	a.lock.Lock()
+	a.streams++
+	a.lock.Unlock()
+	<-s.Context().Done()
+	return nil
+}
+
+func (a *fakeAlpha) OnTxEvent(ctx context.Context, e *saga_grpc.GrpcTxEvent) (*saga_grpc.GrpcAck, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.events = append(a.events, e)
+	if a.fail != nil {
+		if err := a.fail(e); err != nil {
+			return nil, err
+		}
+	}
+	return &saga_grpc.GrpcAck{}, nil
+}
+
+func (a *fakeAlpha) OnDisconnected(ctx context.Context, c *saga_grpc.GrpcServiceConfig) (*saga_grpc.GrpcAck, error) {
+	return &saga_grpc.GrpcAck{}, nil
+}
+
+func (a *fakeAlpha) counts() (events int, streams int) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return len(a.events), a.streams
+}
+
+// startAlpha starts a coordinator at address, such as "127.0.0.1:0", and returns it, its address and its stop function.
+func startAlpha(t *testing.T, address string) (*fakeAlpha, string, func()) {
+	lis, err := net.Listen("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &fakeAlpha{}
+	s := grpc.NewServer()
+	saga_grpc.RegisterTxEventServiceServer(s, a)
+	go s.Serve(lis)
+	return a, lis.Addr().String(), s.Stop
+}
+
+func newTestContractor(address string) *TransportContractor {
+	c := config.NewAgentConfig()
+	c.ServiceName = "saga-test"
+	c.Resolver = discovery.NewStaticResolver(address)
+	c.ReconnectDelay = 10 * time.Millisecond
+	c.RetryAttempts = 3
+	c.RetryBackoff = time.Millisecond
+	s := serializer.NewGobSerializer()
+	return NewTransportContractor(c, &config.ServiceConfig{ServiceName: "saga-test", InstanceId: "saga-test-1"},
+		processor.NewCompensationProcessor(s, nil), s, log.NewNoopLogger())
+}
+
+func newTestSagaAgentContext(globalTxId string) *sagactx.SagaAgentContext {
+	ctx := sagactx.NewSagaAgentContext()
+	ctx.GlobalTxId = globalTxId
+	ctx.LocalTxId = globalTxId
+	return ctx
+}
+
+func TestReconnectKeepsConnection(t *testing.T) {
+	a, address, stop := startAlpha(t, "127.0.0.1:0")
+	defer stop()
+	c := newTestContractor(address)
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	conn := c.conn
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if c.conn != conn {
+		t.Fatal("connected twice")
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if _, err := c.SendSagaEndedEvent(newTestSagaAgentContext("g")); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 5; i++ {
+		c.reconnectTask()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("event failed while reconnecting, %v", err)
+	}
+	if c.conn != conn {
+		t.Error("reconnect dialed another connection")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		events, streams := a.counts()
+		if events == 200 && streams == 6 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d events and %d streams, want 200 events and 6 streams", events, streams)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRetryReceivedEvents(t *testing.T) {
+	cases := []struct {
+		name  string
+		send  func(c *TransportContractor) error
+		sends int
+		fails bool
+	}{
+		{"saga started", func(c *TransportContractor) error {
+			_, err := c.SendSagaStartedEvent(newTestSagaAgentContext("g"), 0)
+			return err
+		}, 1, true},
+		{"tx started", func(c *TransportContractor) error {
+			_, err := c.SendTxStartedEvent(newTestSagaAgentContext("g"), "g", "cancel", 0, nil)
+			return err
+		}, 1, true},
+		{"tx aborted", func(c *TransportContractor) error {
+			_, err := c.SendTxAbortedEvent(newTestSagaAgentContext("g"), "g", "cancel", errors.New("failed"))
+			return err
+		}, 1, true},
+		{"tx ended", func(c *TransportContractor) error {
+			_, err := c.SendTxEndedEvent(newTestSagaAgentContext("g"), "g", "cancel")
+			return err
+		}, 2, false},
+		{"saga ended", func(c *TransportContractor) error {
+			_, err := c.SendSagaEndedEvent(newTestSagaAgentContext("g"))
+			return err
+		}, 2, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			a, address, stop := startAlpha(t, "127.0.0.1:0")
+			defer stop()
+			failed := false
+			a.fail = func(e *saga_grpc.GrpcTxEvent) error {
+				// the coordinator received the event, but the response is lost
+				if !failed {
+					failed = true
+					return status.Error(codes.Unavailable, "connection reset")
+				}
+				return nil
+			}
+			contractor := newTestContractor(address)
+			if err := contractor.Connect(); err != nil {
+				t.Fatal(err)
+			}
+			err := c.send(contractor)
+			if fails := err != nil; fails != c.fails {
+				t.Errorf("got error %v", err)
+			}
+			if events, _ := a.counts(); events != c.sends {
+				t.Errorf("event is sent %d times, want %d", events, c.sends)
+			}
+		})
+	}
+}
+
+func TestRetryEventsNotSent(t *testing.T) {
+	_, address, stop := startAlpha(t, "127.0.0.1:0")
+	c := newTestContractor(address)
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	stop()
+	// the events sent before the connection is found broken fail, they may have been received
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c.conn.WaitForStateChange(ctx, connectivity.Ready)
+	restarted := make(chan *fakeAlpha)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		a, _, stop := startAlpha(t, address)
+		defer stop()
+		restarted <- a
+		time.Sleep(5 * time.Second)
+	}()
+	if _, err := c.SendTxAbortedEvent(newTestSagaAgentContext("g"), "g", "cancel", errors.New("failed")); err != nil {
+		t.Fatal(err)
+	}
+	a := <-restarted
+	if events, _ := a.counts(); events != 1 {
+		t.Errorf("event is sent %d times, want 1", events)
+	}
+}
+
+// pinError is an error of a compensable method carrying a secret.
+type pinError struct {
+	Pin string `saga:"redact"`
+}
+
+func (e *pinError) Error() string {
+	return "wrong pin " + e.Pin
+}
+
+func TestAbortMessageIsRedacted(t *testing.T) {
+	defer redact.SetPatterns()
+	if err := redact.SetPatterns(`password=(\S+)`); err != nil {
+		t.Fatal(err)
+	}
+	a, address, stop := startAlpha(t, "127.0.0.1:0")
+	defer stop()
+	contractor := newTestContractor(address)
+	if err := contractor.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"tagged field", &pinError{Pin: "1234"}, "wrong pin ******"},
+		{"pattern", errors.New("login with password=secret failed"), "login with password=****** failed"},
+	}
+	for i, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := contractor.SendTxAbortedEvent(newTestSagaAgentContext("g"), "", "", c.err); err != nil {
+				t.Fatal(err)
+			}
+			a.lock.Lock()
+			e := a.events[i]
+			a.lock.Unlock()
+			if got := string(e.Payloads); got != c.want {
+				t.Errorf("got abort message %q, want %q", got, c.want)
+			}
+		})
+	}
+}
@@ -35,3 +35,27 @@ func GetFirstNotLoopbackIPv4Address() (string, error) {
 	}
 	return "", errors.New("can not found not loopback IPv4 address")
 }
+
+// GetFirstNotLoopbackIPv6Address returns the first global unicast IPv6 address of the interfaces which are up.
+func GetFirstNotLoopbackIPv6Address() (string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", err
+	}
+	for _, iface := range ifaces {
+		if (iface.Flags&net.FlagUp == net.FlagUp) && (iface.Flags&net.FlagLoopback != net.FlagLoopback) {
+			addrs, err := iface.Addrs()
+			if err != nil {
+				return "", err
+			}
+			for _, addr := range addrs {
+				if ipAddr, ok := addr.(*net.IPNet); ok {
+					if ipAddr.IP.To4() == nil && ipAddr.IP.IsGlobalUnicast() {
+						return ipAddr.IP.String(), nil
+					}
+				}
+			}
+		}
+	}
+	return "", errors.New("can not found not loopback IPv6 address")
+}
@@ -3,10 +3,22 @@ package utils
 import (
 	"reflect"
 	"runtime"
+	"strings"
 )
 
 func GetFnName(fn interface{}) string {
 	compensedFunc := reflect.ValueOf(fn)
 	fnName := runtime.FuncForPC(compensedFunc.Pointer()).Name()
-	return fnName
+	// method values are named like "pkg.(*T).Method-fm", trim the suffix so that
+	// the name is the same as the one of the method expression
+	return strings.TrimSuffix(fnName, "-fm")
+}
+
+// GetMethodName returns the full name of the method of receiver, such as "pkg.(*T).Method".
+func GetMethodName(receiver interface{}, method string) string {
+	m, ok := reflect.TypeOf(receiver).MethodByName(method)
+	if !ok {
+		return ""
+	}
+	return runtime.FuncForPC(m.Func.Pointer()).Name()
 }